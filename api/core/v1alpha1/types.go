@@ -56,6 +56,10 @@ type Step struct {
 	// argsToRecalculate is a list of argument-names that should be
 	// recalculated upon execution.
 	ArgsToRecalculate []string `json:"argsToRecalculate,omitempty"`
+	// cluster is the name of the cluster (kubeconfig context) the step
+	// targets. If empty, the step targets the active cluster.
+	// +optional
+	Cluster string `json:"cluster,omitempty"`
 }
 
 // KueryFlowStatus defines the observed state of KueryFlow.
@@ -2,85 +2,398 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/kube-agent/kuery/pkg/kuery"
 	"github.com/kube-agent/kuery/pkg/tools/api"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/anthropic"
-	"github.com/tmc/langchaingo/llms/openai"
 
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	crd_discovery "github.com/kube-agent/kuery/pkg/crd-discovery"
-	"github.com/kube-agent/kuery/pkg/flows/steps"
+	llm_providers "github.com/kube-agent/kuery/pkg/llm-providers"
 	operators_db "github.com/kube-agent/kuery/pkg/operators-db"
 	"github.com/kube-agent/kuery/pkg/tools"
+	"github.com/kube-agent/kuery/pkg/tracing"
+	"github.com/kube-agent/kuery/pkg/usage"
 )
 
-const (
-	gptModel       = "gpt-4-1106-preview"
-	anthropicModel = "claude-3-5-sonnet-20241022"
+var (
+	// llmConfigFile is the path of the LLM config file.
+	llmConfigFile string
+	// llmFlags configures the LLM, overriding the LLM config file and
+	// environment.
+	llmFlags llm_providers.Config
+	// metricsBindAddress is the address the metrics endpoint binds to.
+	metricsBindAddress string
 )
 
+func init() {
+	flag.StringVar(&metricsBindAddress, "metrics-bind-address", ":8080",
+		"the address the metrics endpoint binds to, 0 disables it")
+	flag.StringVar(&llmConfigFile, "llm-config", os.Getenv("KUERY_LLM_CONFIG"), "path to an LLM config file")
+	flag.Func("llm-provider", "LLM provider: openai, anthropic, ollama or openai-compatible", func(value string) error {
+		llmFlags.Provider = llm_providers.Provider(strings.ToLower(value))
+		return nil
+	})
+	flag.StringVar(&llmFlags.Model, "llm-model", "", "LLM model name")
+	flag.StringVar(&llmFlags.BaseURL, "llm-base-url", "", "LLM provider API URL, e.g. of a local server")
+	flag.Func("llm-temperature", "LLM sampling temperature", func(value string) error {
+		temperature, err := strconv.ParseFloat(value, 64)
+		llmFlags.Temperature = &temperature
+		return err
+	})
+	flag.IntVar(&llmFlags.MaxTokens, "llm-max-tokens", 0, "maximum number of tokens per LLM response")
+	flag.Func("llm-max-retries", "number of retries of LLM calls failing with transient errors", func(value string) error {
+		maxRetries, err := strconv.Atoi(value)
+		llmFlags.MaxRetries = &maxRetries
+		return err
+	})
+	flag.Func("llm-fallback-provider", "LLM provider to fall back to when the LLM keeps failing", func(value string) error {
+		fallbackFlags().Provider = llm_providers.Provider(strings.ToLower(value))
+		return nil
+	})
+	flag.Func("llm-fallback-model", "LLM model to fall back to when the LLM keeps failing", func(value string) error {
+		fallbackFlags().Model = value
+		return nil
+	})
+	flag.StringVar(&llmFlags.Cassette, "llm-cassette", "", "file to record LLM exchanges to, or replay them from")
+	flag.Func("llm-cassette-mode", "LLM cassette mode: record or replay", func(value string) error {
+		llmFlags.CassetteMode = llm_providers.CassetteMode(strings.ToLower(value))
+		return nil
+	})
+}
+
+// fallbackFlags returns the fallback LLM flags, creating them on first use.
+func fallbackFlags() *llm_providers.Config {
+	if llmFlags.Fallback == nil {
+		llmFlags.Fallback = &llm_providers.Config{}
+	}
+
+	return llmFlags.Fallback
+}
+
+// setupLLM creates the LLM from the environment (LLM, MODEL, ...), overridden
+// by the LLM config file, overridden by the LLM flags.
 func setupLLM(ctx context.Context) (llms.Model, error) {
 	logger := klog.FromContext(ctx)
-	llm := os.Getenv("LLM")
 
-	if llm == "OPENAI" {
-		logger.Info("Using OpenAI LLM", "model", gptModel)
-		return openai.New(openai.WithModel(gptModel))
+	cfg, err := llm_providers.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	if llmConfigFile != "" {
+		fileCfg, err := llm_providers.LoadConfig(llmConfigFile)
+		if err != nil {
+			return nil, err
+		}
+
+		*cfg = cfg.Merge(*fileCfg)
 	}
 
-	if llm == "ANTHROPIC" {
-		logger.Info("Using Anthropic LLM", "model", anthropicModel)
-		return anthropic.New(anthropic.WithModel(anthropicModel))
+	*cfg = cfg.Merge(llmFlags).WithDefaults()
+
+	llm, err := llm_providers.New(*cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("LLM provider not set or invalid: %s", llm)
+	logger.Info("Using LLM", "provider", cfg.Provider, "model", cfg.Model, "baseURL", cfg.BaseURL,
+		"maxRetries", *cfg.MaxRetries)
+	if cfg.Fallback != nil {
+		logger.Info("Using fallback LLM", "provider", cfg.Fallback.Provider, "model", cfg.Fallback.Model,
+			"baseURL", cfg.Fallback.BaseURL)
+	}
+	return llm, nil
 }
 
 func main() {
 	ctx := context.Background()
 	// init verbosity flag
 	klog.InitFlags(nil)
+	flag.Parse()
+	ctrl.SetLogger(klog.NewKlogr())
 
 	logger := klog.FromContext(ctx)
 
+	setupMetrics(ctx)
+
+	if shutdown := setupTracing(ctx); shutdown != nil {
+		defer func() {
+			if err := shutdown(ctx); err != nil {
+				logger.Error(err, "Failed to flush traces")
+			}
+		}()
+	}
+
 	llm, err := setupLLM(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	cfg, err := ctrl.GetConfig()
-	if err != nil {
-		logger.Error(err, "Failed to get kubeconfig, K8s tools won't be enabled")
-	}
+	clusters := setupClusters(ctx)
 
-	toolsMgr := setupToolsMgr(ctx, cfg)
+	toolsMgr := setupToolsMgr(ctx)
 	logger.Info("Tools manager initialized")
 
-	flow := kuery.NewConversationalFlow(systemPrompt, llm, toolsMgr, cfg)
-	logger.Info("Conversational flow initialized", "tools", toolsMgr.GetToolNames())
+	if readOnly, _ := strconv.ParseBool(os.Getenv("KUERY_READ_ONLY")); readOnly {
+		toolsMgr = toolsMgr.WithReadOnly(true)
+		logger.Info("Read-only mode enabled, tool calls that modify the cluster will be refused")
+	}
+
+	if policyFile := os.Getenv("KUERY_POLICY_FILE"); policyFile != "" {
+		policy, err := api.LoadPolicy(policyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		toolsMgr = toolsMgr.WithPolicy(policy)
+		logger.Info("Tool policy loaded", "file", policyFile, "rules", len(policy.Rules))
+	}
+
+	if redactionFile := os.Getenv("KUERY_REDACTION_FILE"); redactionFile != "" {
+		patterns, err := api.LoadRedactionPatterns(redactionFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		toolsMgr = toolsMgr.WithRedactor(api.NewRedactor(patterns...))
+		logger.Info("Redaction config loaded", "file", redactionFile, "patterns", len(patterns))
+	}
+
+	if auditSink := setupAudit(ctx, clusters); auditSink != nil {
+		toolsMgr = toolsMgr.WithAuditSink(auditSink)
+	}
+
+	session := setupSession()
+	flow := kuery.NewConversationalFlow(session, systemPrompt, llm, toolsMgr, clusters)
+	defer flow.Close()
+	logger.Info("Conversational flow initialized", "session", session.ID, "user", session.User,
+		"cluster", flow.Cluster(), "tools", flow.ToolManager().GetToolNames())
+
+	if err := setupUsage(ctx, flow.Usage()); err != nil {
+		log.Fatal(err)
+	}
+
 	// Sample human step of a user that has a cluster with several services and the need for a high performance message
 	// bus operator:
 	// I have a cluster with several services and I think I need a high performance message bus operator for event-driven communication.
-	flow.HumanStep(steps.ReadFromSTDIN)
+	flow.HumanStep(flow.ReadFromSTDIN)
 
 	logger.Info("Running flow")
 
 	_, err = flow.Loop(ctx)
-	if err != nil {
+	if errors.Is(err, usage.ErrBudgetExceeded) {
+		logger.Info("Session stopped", "reason", err.Error())
+	} else if err != nil {
 		logger.Error(err, "Failed to loop flow")
 	}
 }
 
-func setupToolsMgr(ctx context.Context, cfg *rest.Config) *api.ToolManager {
+// setupMetrics serves the Kuery (and client-go) metrics of the
+// controller-runtime registry on metricsBindAddress.
+func setupMetrics(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+
+	server, err := metricsserver.NewServer(metricsserver.Options{BindAddress: metricsBindAddress}, nil, nil)
+	if err != nil {
+		logger.Error(err, "Failed to create metrics server, metrics won't be served")
+		return
+	}
+
+	if server == nil {
+		return // disabled
+	}
+
+	go func() {
+		if err := server.Start(ctx); err != nil {
+			logger.Error(err, "Metrics server failed")
+		}
+	}()
+}
+
+// setupTracing exports traces via OTLP if an OTLP endpoint is set in the
+// standard OTEL_EXPORTER_OTLP_ENDPOINT (or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT)
+// environment variable, and returns the function flushing them.
+func setupTracing(ctx context.Context) func(context.Context) error {
+	logger := klog.FromContext(ctx)
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil
+	}
+
+	shutdown, err := tracing.Setup(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to set up tracing, traces won't be exported")
+		return nil
+	}
+
+	logger.Info("Tracing enabled")
+	return shutdown
+}
+
+// setupUsage configures the usage accounting of the session: the price table
+// in KUERY_PRICE_TABLE extends the default one, and KUERY_SESSION_MAX_TOKENS and
+// KUERY_SESSION_MAX_COST (in USD) limit the session.
+func setupUsage(ctx context.Context, tracker *usage.Tracker) error {
+	logger := klog.FromContext(ctx)
+
+	if priceTableFile := os.Getenv("KUERY_PRICE_TABLE"); priceTableFile != "" {
+		prices, err := usage.LoadPriceTable(priceTableFile)
+		if err != nil {
+			return err
+		}
+
+		tracker.WithPrices(usage.DefaultPriceTable().Merge(prices))
+		logger.Info("Price table loaded", "file", priceTableFile, "models", len(prices))
+	}
+
+	var budget usage.Budget
+	if maxTokens := os.Getenv("KUERY_SESSION_MAX_TOKENS"); maxTokens != "" {
+		value, err := strconv.Atoi(maxTokens)
+		if err != nil {
+			return fmt.Errorf("invalid KUERY_SESSION_MAX_TOKENS: %w", err)
+		}
+
+		budget.MaxTokens = value
+	}
+
+	if maxCost := os.Getenv("KUERY_SESSION_MAX_COST"); maxCost != "" {
+		value, err := strconv.ParseFloat(maxCost, 64)
+		if err != nil {
+			return fmt.Errorf("invalid KUERY_SESSION_MAX_COST: %w", err)
+		}
+
+		budget.MaxCost = value
+	}
+
+	if budget != (usage.Budget{}) {
+		tracker.WithBudget(budget)
+		logger.Info("Session budget set", "maxTokens", budget.MaxTokens, "maxCost", budget.MaxCost)
+	}
+
+	return nil
+}
+
+// inClusterName is the name of the cluster Kuery runs in, when no kubeconfig
+// contexts are available.
+const inClusterName = "in-cluster"
+
+// setupClusters loads a cluster per kubeconfig context, starting on
+// KUERY_CONTEXT if set. Without a kubeconfig, it falls back to the cluster Kuery
+// runs in, if any.
+func setupClusters(ctx context.Context) *kuery.Clusters {
+	logger := klog.FromContext(ctx)
+
+	clusters, err := kuery.LoadClusters(ctx, os.Getenv("KUERY_CONTEXT"))
+	if err == nil {
+		logger.Info("Clusters loaded from kubeconfig", "clusters", clusters.Names(), "current", clusters.Current())
+		return clusters
+	}
+
+	logger.Info("Failed to load kubeconfig contexts, falling back to the default config", "error", err)
+
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		logger.Error(err, "Failed to get kubeconfig, K8s tools won't be enabled")
+		return nil
+	}
+
+	return kuery.NewClusters(inClusterName, cfg)
+}
+
+// setupAudit creates the sink of the audit records of cluster-affecting tool
+// calls: a JSONL file (KUERY_AUDIT_LOG), Kubernetes Events on the affected
+// objects (KUERY_AUDIT_EVENTS) and/or an HTTP webhook (KUERY_AUDIT_WEBHOOK,
+// authenticated with the bearer token in KUERY_AUDIT_WEBHOOK_TOKEN).
+// It returns nil if auditing is not configured.
+func setupAudit(ctx context.Context, clusters *kuery.Clusters) api.AuditSink {
+	logger := klog.FromContext(ctx)
+	var sinks api.MultiAuditSink
+
+	if auditLog := os.Getenv("KUERY_AUDIT_LOG"); auditLog != "" {
+		sink, err := api.NewJSONLAuditSink(auditLog)
+		if err != nil {
+			log.Fatal(err) // refuse to run unaudited when auditing is required
+		}
+
+		sinks = append(sinks, sink)
+		logger.Info("Auditing to file", "file", auditLog)
+	}
+
+	if auditEvents, _ := strconv.ParseBool(os.Getenv("KUERY_AUDIT_EVENTS")); auditEvents && clusters != nil {
+		var mu sync.Mutex
+		clients := make(map[string]kubernetes.Interface)
+
+		sinks = append(sinks, api.NewEventAuditSink(func(cluster string) (kubernetes.Interface, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if client, ok := clients[cluster]; ok {
+				return client, nil
+			}
+
+			cfg, ok := clusters.Config(cluster)
+			if !ok {
+				return nil, fmt.Errorf("unknown cluster %q", cluster)
+			}
+
+			client, err := kubernetes.NewForConfig(cfg) // as Kuery, users may not be allowed to create events
+			if err != nil {
+				return nil, err
+			}
+
+			clients[cluster] = client
+			return client, nil
+		}))
+		logger.Info("Auditing to Kubernetes Events")
+	}
+
+	if webhook := os.Getenv("KUERY_AUDIT_WEBHOOK"); webhook != "" {
+		sink := api.NewWebhookAuditSink(webhook)
+		if token := os.Getenv("KUERY_AUDIT_WEBHOOK_TOKEN"); token != "" {
+			sink = sink.WithHeader("Authorization", "Bearer "+token)
+		}
+
+		sinks = append(sinks, sink)
+		logger.Info("Auditing to webhook", "url", webhook)
+	}
+
+	if len(sinks) == 0 {
+		return nil
+	}
+
+	return sinks
+}
+
+// setupSession creates the session of the terminal user.
+// If KUERY_IMPERSONATE_USER is set, the session acts against the cluster as that
+// user (and the comma-separated KUERY_IMPERSONATE_GROUPS), instead of as Kuery.
+func setupSession() kuery.Session {
+	var groups []string
+	for _, group := range strings.Split(os.Getenv("KUERY_IMPERSONATE_GROUPS"), ",") {
+		if group = strings.TrimSpace(group); group != "" { // e.g., "devs, ops," lists two groups
+			groups = append(groups, group)
+		}
+	}
+
+	return kuery.NewSession(os.Getenv("KUERY_IMPERSONATE_USER"), groups)
+}
+
+// setupToolsMgr creates the tools manager holding the tools shared by all
+// sessions. Cluster tools are session-scoped, and are added by the flow.
+func setupToolsMgr(ctx context.Context) *api.ToolManager {
 	logger := klog.FromContext(ctx)
 	var callables []api.Tool
 	var maxRetries []int
@@ -94,17 +407,6 @@ func setupToolsMgr(ctx context.Context, cfg *rest.Config) *api.ToolManager {
 		maxRetries = append(maxRetries, 1)
 	}
 
-	if cfg != nil {
-		dynamicKubeClient, err := dynamic.NewForConfig(cfg)
-		if err != nil {
-			logger.Error(err, "Failed to create dynamic K8s client, K8s tools won't be enabled")
-		} else {
-			logger.Info("Dynamic K8s client initialized")
-			callables = append(callables, tools.NewK8sDynamicClient(dynamicKubeClient))
-			maxRetries = append(maxRetries, 3)
-		}
-	}
-
 	apiDiscovery, err := crd_discovery.NewMilvusStore(ctx)
 	if err != nil {
 		logger.Error(err, "Failed to create API discovery, tool won't be enabled")
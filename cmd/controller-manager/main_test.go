@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSetupClustersStartsOnKueryContext(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: staging
+  cluster: {server: "https://staging.example.com"}
+- name: prod
+  cluster: {server: "https://prod.example.com"}
+contexts:
+- name: staging
+  context: {cluster: staging}
+- name: prod
+  context: {cluster: prod}
+`
+	file := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(file, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", file)
+
+	for kueryContext, want := range map[string]string{"": "prod", "staging": "staging"} {
+		t.Setenv("KUERY_CONTEXT", kueryContext)
+
+		clusters := setupClusters(context.Background())
+		if clusters == nil || clusters.Current() != want {
+			t.Errorf("KUERY_CONTEXT=%q: setupClusters() = %v, want to start on %s", kueryContext, clusters, want)
+		}
+	}
+}
+
+func TestSetupSessionImpersonatesConfiguredIdentity(t *testing.T) {
+	t.Setenv("KUERY_IMPERSONATE_USER", "alice")
+	t.Setenv("KUERY_IMPERSONATE_GROUPS", " devs, ops,,")
+
+	session := setupSession()
+	if session.User != "alice" || !slices.Equal(session.Groups, []string{"devs", "ops"}) {
+		t.Errorf("setupSession() = %+v, want alice of [devs ops]", session)
+	}
+}
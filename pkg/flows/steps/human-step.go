@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/tmc/langchaingo/llms"
 )
@@ -60,10 +61,15 @@ func (s *HumanStep) WithCallOptions(callOptions []llms.CallOption) Step {
 }
 
 // ReadFromSTDIN reads a string from the standard input.
-func ReadFromSTDIN(_ context.Context) string {
+func ReadFromSTDIN(ctx context.Context) string {
+	return PromptSTDIN(ctx, "User Input: ")
+}
+
+// PromptSTDIN prints the prompt and reads a string from the standard input.
+func PromptSTDIN(_ context.Context, prompt string) string {
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("User Input: ")
+	fmt.Print(prompt)
 	text, _ := reader.ReadString('\n')
 
-	return text[:len(text)-1] // remove the newline character
+	return strings.TrimSuffix(text, "\n") // remove the newline character
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Step abstracts a step in a flow.
@@ -27,3 +28,26 @@ const (
 	StepTypeLLM   StepType = "llm"
 	StepTypeHuman StepType = "human"
 )
+
+// ParentSpanner is implemented by steps whose span has an explicit parent,
+// e.g. the steps of a KueryFlow run, rather than the span of the flow.
+type ParentSpanner interface {
+	// ParentSpan returns the span context the span of the step is a child of.
+	ParentSpan() trace.SpanContext
+}
+
+// WithParentSpan returns the step with parent as the parent of its span.
+func WithParentSpan(step Step, parent trace.SpanContext) Step {
+	return &parentedStep{Step: step, parent: parent}
+}
+
+// parentedStep is a step whose span has an explicit parent.
+type parentedStep struct {
+	Step
+	parent trace.SpanContext
+}
+
+// ParentSpan returns the span context the span of the step is a child of.
+func (s *parentedStep) ParentSpan() trace.SpanContext {
+	return s.parent
+}
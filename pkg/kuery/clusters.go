@@ -0,0 +1,112 @@
+package kuery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+// Clusters holds the Kubernetes clusters Kuery can operate on, by name.
+// Clusters is immutable and may be shared between sessions, each of which
+// keeps track of its own active cluster.
+type Clusters struct {
+	configs map[string]*rest.Config
+	names   []string
+	current string
+}
+
+// NewClusters creates Clusters holding a single cluster.
+func NewClusters(name string, cfg *rest.Config) *Clusters {
+	return &Clusters{
+		configs: map[string]*rest.Config{name: cfg},
+		names:   []string{name},
+		current: name,
+	}
+}
+
+// LoadClusters loads a cluster per context of the kubeconfig, following the
+// kubectl loading rules (e.g., the KUBECONFIG environment variable).
+// Contexts that fail to load are logged and skipped, and an error is returned
+// only if none loads. The current cluster is the given context, or the
+// current context of the kubeconfig if empty (the first loaded context if the
+// current one is unset or fails to load).
+func LoadClusters(ctx context.Context, current string) (*Clusters, error) {
+	logger := klog.FromContext(ctx)
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+
+	kubeconfig, err := rules.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	if len(kubeconfig.Contexts) == 0 {
+		return nil, fmt.Errorf("kubeconfig has no contexts")
+	}
+
+	clusters := &Clusters{
+		configs: make(map[string]*rest.Config, len(kubeconfig.Contexts)),
+		current: current,
+	}
+
+	var errs []error
+	failures := make(map[string]error)
+	for _, name := range slices.Sorted(maps.Keys(kubeconfig.Contexts)) {
+		cfg, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, name, &clientcmd.ConfigOverrides{},
+			rules).ClientConfig()
+		if err != nil {
+			logger.Error(err, "Skipping kubeconfig context that failed to load", "context", name)
+			failures[name] = fmt.Errorf("failed to load context %s: %w", name, err)
+			errs = append(errs, failures[name])
+			continue
+		}
+
+		clusters.configs[name] = cfg
+		clusters.names = append(clusters.names, name)
+	}
+
+	if len(clusters.names) == 0 {
+		return nil, fmt.Errorf("no kubeconfig context could be loaded: %w", errors.Join(errs...))
+	}
+
+	if current != "" { // asked for explicitly, there is no other cluster to start on
+		if err, ok := failures[current]; ok {
+			return nil, err
+		}
+		if _, ok := clusters.configs[current]; !ok {
+			return nil, fmt.Errorf("context %q not found in kubeconfig", current)
+		}
+
+		return clusters, nil
+	}
+
+	clusters.current = kubeconfig.CurrentContext
+	if _, ok := clusters.configs[clusters.current]; !ok {
+		clusters.current = clusters.names[0]
+		logger.Info("Current kubeconfig context is unavailable, starting on another context",
+			"currentContext", kubeconfig.CurrentContext, "context", clusters.current)
+	}
+
+	return clusters, nil
+}
+
+// Names returns the sorted names of the clusters.
+func (c *Clusters) Names() []string {
+	return append([]string{}, c.names...)
+}
+
+// Current returns the name of the cluster sessions start on.
+func (c *Clusters) Current() string {
+	return c.current
+}
+
+// Config returns the rest.Config of the cluster with the given name.
+func (c *Clusters) Config(name string) (*rest.Config, bool) {
+	cfg, ok := c.configs[name]
+	return cfg, ok
+}
@@ -0,0 +1,193 @@
+package kuery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+	"k8s.io/client-go/rest"
+
+	llmproviders "github.com/kube-agent/kuery/pkg/llm-providers"
+	"github.com/kube-agent/kuery/pkg/tools/api"
+)
+
+// writeKubeconfig writes a kubeconfig with the given current context and the
+// staging and prod contexts, plus a broken context referring to a cluster it
+// does not define, and points KUBECONFIG to it.
+func writeKubeconfig(t *testing.T, currentContext string) {
+	t.Helper()
+
+	kubeconfig := `apiVersion: v1
+kind: Config
+current-context: ` + currentContext + `
+clusters:
+- name: staging
+  cluster: {server: "https://staging.example.com"}
+- name: prod
+  cluster: {server: "https://prod.example.com"}
+users:
+- name: admin
+  user: {token: secret}
+contexts:
+- name: staging
+  context: {cluster: staging, user: admin}
+- name: prod
+  context: {cluster: prod, user: admin}
+- name: broken
+  context: {cluster: deleted, user: admin}
+`
+
+	file := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(file, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("KUBECONFIG", file)
+}
+
+func TestLoadClustersSkipsBrokenContexts(t *testing.T) {
+	writeKubeconfig(t, "prod")
+
+	clusters, err := LoadClusters(context.Background(), "")
+	if err != nil {
+		t.Fatalf("LoadClusters() error = %v", err)
+	}
+
+	if names := clusters.Names(); !slices.Equal(names, []string{"prod", "staging"}) {
+		t.Errorf("Names() = %v, want the contexts that load", names)
+	}
+
+	if clusters.Current() != "prod" {
+		t.Errorf("Current() = %q, want the current context of the kubeconfig", clusters.Current())
+	}
+
+	if cfg, ok := clusters.Config("staging"); !ok || cfg.Host != "https://staging.example.com" {
+		t.Errorf("Config(staging) = %+v, %v, want the staging cluster", cfg, ok)
+	}
+}
+
+func TestLoadClustersCurrentContext(t *testing.T) {
+	for _, tc := range []struct {
+		name, currentContext, context, want, wantErr string
+	}{
+		{name: "given context", currentContext: "prod", context: "staging", want: "staging"},
+		{name: "unknown context", currentContext: "prod", context: "dev", wantErr: `context "dev" not found`},
+		{name: "broken context", currentContext: "prod", context: "broken", wantErr: "failed to load context broken"},
+		{name: "broken current context", currentContext: "broken", want: "prod"},
+		{name: "no current context", want: "prod"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			writeKubeconfig(t, tc.currentContext)
+
+			clusters, err := LoadClusters(context.Background(), tc.context)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("LoadClusters(%q) error = %v, want %q", tc.context, err, tc.wantErr)
+				}
+				return
+			}
+
+			if err != nil || clusters.Current() != tc.want {
+				t.Errorf("LoadClusters(%q) = %v, %v, want to start on %s", tc.context, clusters, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadClustersFailsWithoutLoadableContexts(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "kubeconfig")
+	kubeconfig := "apiVersion: v1\nkind: Config\ncontexts:\n- name: broken\n  context: {cluster: deleted}\n"
+	if err := os.WriteFile(file, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", file)
+
+	if _, err := LoadClusters(context.Background(), ""); err == nil ||
+		!strings.Contains(err.Error(), "failed to load context broken") {
+		t.Errorf("LoadClusters() error = %v, want the failure of the broken context", err)
+	}
+}
+
+// requestRecorder is an API server that records the paths it is requested.
+type requestRecorder struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (r *requestRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.paths = append(r.paths, req.URL.Path)
+	r.mu.Unlock()
+
+	http.NotFound(w, req)
+}
+
+// reset returns the recorded paths and forgets them.
+func (r *requestRecorder) reset() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paths := r.paths
+	r.paths = nil
+	return paths
+}
+
+func TestSwitchCluster(t *testing.T) {
+	staging, prod := &requestRecorder{}, &requestRecorder{}
+	stagingServer, prodServer := httptest.NewServer(staging), httptest.NewServer(prod)
+	defer stagingServer.Close()
+	defer prodServer.Close()
+
+	clusters := &Clusters{
+		configs: map[string]*rest.Config{
+			"staging": {Host: stagingServer.URL},
+			"prod":    {Host: prodServer.URL},
+			"broken":  {Host: prodServer.URL, TLSClientConfig: rest.TLSClientConfig{CAFile: "/nonexistent/ca.crt"}},
+		},
+		names:   []string{"broken", "prod", "staging"},
+		current: "staging",
+	}
+
+	flow := NewConversationalFlow(NewSession("", nil), "", llmproviders.NewScriptedModel(), api.NewToolManager(),
+		clusters)
+	defer flow.Close()
+
+	if flow.Cluster() != "staging" || !flow.ToolManager().HasTool("K8sPodLogs") {
+		t.Fatalf("the flow starts on %q, want the K8s tools of staging", flow.Cluster())
+	}
+
+	if err := flow.SwitchCluster("prod"); err != nil {
+		t.Fatalf("SwitchCluster(prod) error = %v", err)
+	}
+
+	for _, name := range []string{"dev", "broken"} {
+		if err := flow.SwitchCluster(name); err == nil {
+			t.Errorf("SwitchCluster(%s) succeeded, want an error", name)
+		}
+	}
+
+	if flow.Cluster() != "prod" {
+		t.Errorf("Cluster() = %q, want prod to remain active after failed switches", flow.Cluster())
+	}
+
+	// the tools of the session now read the logs of prod
+	flow.ToolManager().ExecuteToolCalls(context.Background(), &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		ToolCalls: []llms.ToolCall{{ID: "1", Type: "function", FunctionCall: &llms.FunctionCall{
+			Name: "K8sPodLogs", Arguments: `{"namespace":"default","pod":"web"}`}}},
+	}}})
+
+	if paths := prod.reset(); !slices.Contains(paths, "/api/v1/namespaces/default/pods/web") {
+		t.Errorf("prod was requested %v, want the pod to be read from prod", paths)
+	}
+
+	if paths := staging.reset(); len(paths) != 0 {
+		t.Errorf("staging was requested %v after switching to prod", paths)
+	}
+}
@@ -2,58 +2,220 @@ package kuery
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+
 	"github.com/fatih/color"
 	"github.com/kr/pretty"
 	"github.com/kube-agent/kuery/pkg/flows"
 	"github.com/kube-agent/kuery/pkg/tools/api"
 	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 
+	corev1alpha1 "github.com/kube-agent/kuery/api/core/v1alpha1"
 	"github.com/kube-agent/kuery/pkg/flows/steps"
 	clientset "github.com/kube-agent/kuery/pkg/generated/clientset/versioned"
+	"github.com/kube-agent/kuery/pkg/metrics"
 	"github.com/kube-agent/kuery/pkg/tools"
+	"github.com/kube-agent/kuery/pkg/tracing"
+	"github.com/kube-agent/kuery/pkg/usage"
 )
 
+// usageCommand is the user input that shows the usage of the session.
+const usageCommand = "/usage"
+
+// backgroundResultPrefix introduces the system messages reporting the results
+// of background tasks to the model.
+const backgroundResultPrefix = "A background task ended, tell the user about it: "
+
 // ConversationalFlow implements flow for pure-conversation flows.
+// A ConversationalFlow serves a single session and is not safe for concurrent
+// use, but multiple flows may run concurrently on top of the same ToolManager.
 type ConversationalFlow struct {
-	llm     llms.Model
-	chain   flows.Chain
-	toolMgr *api.ToolManager
+	session  Session
+	llm      llms.Model
+	chain    flows.Chain
+	toolMgr  *api.ToolManager
+	clusters *Clusters
+	tracker  *usage.Tracker
+
+	// background runs the background tasks of the session, e.g. watches.
+	background *tools.BackgroundTasks
+
+	// activeRun is the KueryFlow run in progress, which lasts until the end
+	// of the turn it was started in, or until another run starts.
+	activeRun string
 
 	systemPrompt string
 }
 
-// NewConversationalFlow creates a new conversational flow.
-func NewConversationalFlow(systemPrompt string, llm llms.Model, toolMgr *api.ToolManager,
-	cfg *rest.Config) *ConversationalFlow {
-	chain := flows.NewChain(nil)
-
-	planner := tools.NewAddStepTool(chain, llm)
-	toolMgr = toolMgr.WithTool(planner, 1)
+var (
+	_ tools.ClusterSwitcher = &ConversationalFlow{}
+	_ tools.KueryFlowRunner = &ConversationalFlow{}
+)
 
-	if cfg != nil {
-		coreClient, err := clientset.NewForConfig(cfg)
-		if err == nil {
-			importKueryFlowTool := tools.NewImportKueryFlowTool(coreClient, chain, toolMgr, llm)
+// NewConversationalFlow creates a new conversational flow for the given session.
+// The flow operates on a session-scoped copy of toolMgr, therefore toolMgr
+// itself is never mutated and may be shared between flows.
+// Kubernetes tools are created by the flow for the current cluster of
+// clusters, impersonating the session's identity, and are recreated whenever
+// the session switches clusters.
+func NewConversationalFlow(session Session, systemPrompt string, llm llms.Model, toolMgr *api.ToolManager,
+	clusters *Clusters) *ConversationalFlow {
+	f := &ConversationalFlow{
+		session:      session,
+		llm:          llm,
+		chain:        flows.NewChain(nil),
+		toolMgr:      toolMgr.ForSession(session.ID).WithUser(session.User),
+		clusters:     clusters,
+		tracker:      usage.NewTracker(usage.DefaultPriceTable()),
+		background:   tools.NewBackgroundTasks(context.Background()),
+		systemPrompt: systemPrompt,
+	}
 
-			exportKueryFlowTool := tools.NewExportKueryFlowTool(coreClient, toolMgr.GetToolCall)
+	planner := tools.NewAddStepTool(f.chain, llm)
+	f.toolMgr.WithTool(planner, 1)
 
-			toolMgr = toolMgr.WithTool(importKueryFlowTool, 3).WithTool(exportKueryFlowTool, 3)
-		} else {
-			klog.Error("failed to create core client", "error", err)
+	if clusters != nil {
+		if err := f.SwitchCluster(clusters.Current()); err != nil {
+			klog.Error("failed to create K8s tools", "error", err)
 		}
+
+		f.toolMgr.WithTool(tools.NewK8sContextTool(f), 2)
 	}
 
-	toolsApprovalTool := tools.NewToolApprovalTool(chain, llm, toolMgr)
-	toolMgr = toolMgr.WithTool(toolsApprovalTool, 2)
+	toolsApprovalTool := tools.NewToolApprovalTool(f.chain, llm, f.toolMgr)
+	f.toolMgr.WithTool(toolsApprovalTool, 2)
 
-	return &ConversationalFlow{
-		llm:          llm,
-		chain:        chain,
-		toolMgr:      toolMgr,
-		systemPrompt: systemPrompt,
+	return f
+}
+
+// Clusters returns the names of the clusters the session can operate on.
+func (f *ConversationalFlow) Clusters() []string {
+	if f.clusters == nil {
+		return nil
+	}
+
+	return f.clusters.Names()
+}
+
+// Cluster returns the name of the cluster the session operates on.
+func (f *ConversationalFlow) Cluster() string {
+	return f.toolMgr.Cluster()
+}
+
+// SwitchCluster recreates the Kubernetes tools of the session for the cluster
+// with the given name. The tools of the previous cluster remain in place if
+// those of the new one cannot be created.
+func (f *ConversationalFlow) SwitchCluster(name string) error {
+	if f.clusters == nil {
+		return fmt.Errorf("no clusters are configured")
+	}
+
+	cfg, ok := f.clusters.Config(name)
+	if !ok {
+		return fmt.Errorf("unknown cluster %q, available clusters: %v", name, f.clusters.Names())
+	}
+
+	clusterTools, maxRetries, err := f.clusterTools(tracing.WrapConfig(f.session.RESTConfig(cfg)))
+	if err != nil {
+		return fmt.Errorf("failed to create the tools of cluster %s: %w", name, err)
+	}
+
+	f.toolMgr.WithTools(clusterTools, maxRetries).WithCluster(name)
+	return nil
+}
+
+// clusterTools creates the Kubernetes tools operating on the cluster of cfg,
+// along with their maximum retries.
+func (f *ConversationalFlow) clusterTools(cfg *rest.Config) ([]api.Tool, []int, error) {
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create K8s client: %w", err)
+	}
+
+	dynamicKubeClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create dynamic K8s client: %w", err)
+	}
+
+	coreClient, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create core client: %w", err)
+	}
+
+	readOnly := f.toolMgr.ReadOnly()
+	resolver := tools.NewResourceResolver(kubeClient.Discovery())
+	dynamicClientTool := tools.NewK8sDynamicClient(dynamicKubeClient).WithReadOnly(readOnly).
+		WithAccessReview(kubeClient.AuthorizationV1()).
+		WithResolver(resolver)
+	importKueryFlowTool := tools.NewImportKueryFlowTool(coreClient, f.chain, f.toolMgr, f.llm).
+		WithReadOnly(readOnly).
+		WithRunner(f)
+
+	clusterTools := []api.Tool{
+		tools.NewK8sPermissionsTool(kubeClient.AuthorizationV1()),
+		tools.NewK8sLogsTool(kubeClient.CoreV1()),
+		tools.NewK8sDiagnoseTool(kubeClient),
+		tools.NewK8sWatchTool(dynamicKubeClient, resolver).WithBackgroundTasks(f.background),
+		dynamicClientTool,
+		importKueryFlowTool,
+		tools.NewK8sRevealTool(kubeClient.CoreV1(), f.toolMgr),
+	}
+	maxRetries := []int{2, 2, 2, 2, 3, 3, 1}
+
+	if !readOnly { // applying and exporting are all about modifying the cluster
+		applyTool := tools.NewK8sApplyTool(dynamicKubeClient, resolver).
+			WithAccessReview(kubeClient.AuthorizationV1())
+		exportKueryFlowTool := tools.NewExportKueryFlowTool(coreClient, f.toolMgr.GetToolCall).
+			WithClusterGetter(f.toolMgr.GetToolCallCluster)
+
+		clusterTools = append(clusterTools, applyTool, exportKueryFlowTool)
+		maxRetries = append(maxRetries, 2, 3)
+	}
+
+	return clusterTools, maxRetries, nil
+}
+
+// Session returns the session the flow serves.
+func (f *ConversationalFlow) Session() Session {
+	return f.session
+}
+
+// ToolManager returns the session-scoped ToolManager of the flow.
+func (f *ConversationalFlow) ToolManager() *api.ToolManager {
+	return f.toolMgr
+}
+
+// Usage returns the tracker of the token usage and cost of the session, whose
+// price table and budget may be configured.
+func (f *ConversationalFlow) Usage() *usage.Tracker {
+	return f.tracker
+}
+
+// Close stops the background tasks of the session, e.g. watches. The flow must
+// not be executed afterwards.
+func (f *ConversationalFlow) Close() {
+	f.background.Stop()
+}
+
+// ReadFromSTDIN reads the user input from the standard input, like
+// steps.ReadFromSTDIN, and shows the usage of the session whenever the user
+// enters /usage.
+func (f *ConversationalFlow) ReadFromSTDIN(ctx context.Context) string {
+	for {
+		input := steps.ReadFromSTDIN(ctx)
+		if strings.TrimSpace(input) != usageCommand {
+			return input
+		}
+
+		color.New(color.FgHiYellow).Print(f.tracker.Report())
 	}
 }
 
@@ -88,6 +250,11 @@ func (f *ConversationalFlow) Loop(ctx context.Context) ([]llms.MessageContent, e
 			f.chain.Reset()
 			executionHistory, err := f.execute(ctx, history)
 			history = executionHistory
+			if errors.Is(err, usage.ErrBudgetExceeded) {
+				color.New(color.FgHiRed, color.Bold).Printf("Stopping: %v\n", err)
+				color.New(color.FgHiYellow).Print(f.tracker.Report())
+				return history, err
+			}
 			if err != nil {
 				logger.Error(err, "failed to execute flow")
 			}
@@ -96,8 +263,15 @@ func (f *ConversationalFlow) Loop(ctx context.Context) ([]llms.MessageContent, e
 }
 
 func (f *ConversationalFlow) execute(ctx context.Context,
-	history []llms.MessageContent) ([]llms.MessageContent, error) {
-	logger := klog.FromContext(ctx)
+	history []llms.MessageContent) (_ []llms.MessageContent, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Kuery turn", trace.WithAttributes(
+		tracing.SessionIDKey.String(f.session.ID),
+		tracing.ClusterKey.String(f.toolMgr.Cluster()),
+	))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	defer func() { f.endRun(ctx, err) }() // KueryFlow runs last until the end of the turn
+
 	// iterate over chn.Next() until nil
 	for {
 		step := f.chain.Next()
@@ -107,28 +281,123 @@ func (f *ConversationalFlow) execute(ctx context.Context,
 
 		if step.Type() == steps.StepTypeHuman {
 			f.toolMgr.ResetToolRetries() // done here to avoid the LLM rampage with tool calls in consecutive turns
+			f.toolMgr.ClearApprovals()   // approvals expire unless consumed in the turn following them
+		}
+
+		if step.Type() == steps.StepTypeLLM {
+			if err := f.tracker.CheckBudget(); err != nil {
+				return history, err
+			}
+
+			history = f.appendBackgroundResults(ctx, history)
 		}
 
-		response, err := step.
-			WithHistory(history, true).
-			WithCallOptions([]llms.CallOption{llms.WithTools(f.toolMgr.GetLLMTools())}).
-			Execute(ctx)
+		history, err = f.executeStep(ctx, step, history)
 		if err != nil {
-			return history, fmt.Errorf("failed to execute step: %w", err)
+			return history, err
 		}
+	}
 
-		history = appendHistory(ctx, history, step.ToMessageContent(response))
+	return history, nil
+}
 
-		msgs, requiresClarificationStep := f.toolMgr.ExecuteToolCalls(ctx, response)
-		for _, msg := range msgs { // this could potentially add a step
-			logger.V(4).Info("Tool Used", "content", msg.Parts)
-			history = appendHistory(ctx, history, msg)
-		}
+// appendBackgroundResults appends the results of the background tasks that
+// ended since the last LLM step to the history, redacted like the responses of
+// the tool calls that started them, for the model to tell the user about.
+func (f *ConversationalFlow) appendBackgroundResults(ctx context.Context,
+	history []llms.MessageContent) []llms.MessageContent {
+	for _, result := range f.background.Results() {
+		summary := f.toolMgr.RedactResponse(&result.ToolCall, result.Summary)
+		history = appendHistory(ctx, history, llms.TextParts(llms.ChatMessageTypeSystem,
+			backgroundResultPrefix+summary))
+	}
+
+	return history
+}
+
+// StartRun starts a run of the KueryFlow, whose usage is that of the remainder
+// of the turn, ending the run in progress, if any, as failed. It returns the
+// span context the steps of the run are parented by.
+func (f *ConversationalFlow) StartRun(ctx context.Context, kueryFlow *corev1alpha1.KueryFlow) trace.SpanContext {
+	run := fmt.Sprintf("%s/%s-%s", kueryFlow.Namespace, kueryFlow.Name, string(uuid.NewUUID())[:8])
+	if f.activeRun != "" {
+		f.endRun(ctx, fmt.Errorf("superseded by KueryFlow run %s", run))
+	}
+
+	f.activeRun = run
+	f.tracker.StartRun(run)
+	metrics.KueryFlowRuns.WithLabelValues(metrics.KueryFlowRunStarted).Inc()
+	klog.FromContext(ctx).V(2).Info("KueryFlow run started", "run", run)
+
+	return tracing.StartKueryFlowRun(ctx, run, kueryFlow.Namespace, kueryFlow.Name, kueryFlow.Annotations)
+}
+
+// endRun ends the KueryFlow run in progress, if any, as failed if err is not
+// nil.
+func (f *ConversationalFlow) endRun(ctx context.Context, err error) {
+	if f.activeRun == "" {
+		return
+	}
+
+	phase := metrics.KueryFlowRunSucceeded
+	if err != nil {
+		phase = metrics.KueryFlowRunFailed
+	}
+
+	metrics.KueryFlowRuns.WithLabelValues(phase).Inc()
+	tracing.EndKueryFlowRun(f.activeRun, err)
+	f.tracker.EndRun()
+	klog.FromContext(ctx).V(2).Info("KueryFlow run ended", "run", f.activeRun, "phase", phase)
+
+	f.activeRun = ""
+}
+
+// executeStep executes a single step of the chain, and the tool calls of its
+// response, in a span of its own.
+func (f *ConversationalFlow) executeStep(ctx context.Context, step steps.Step,
+	history []llms.MessageContent) (_ []llms.MessageContent, err error) {
+	logger := klog.FromContext(ctx)
+
+	parent, hasParent := step.(steps.ParentSpanner)
+	if hasParent { // e.g., a step of a KueryFlow run
+		ctx = trace.ContextWithSpanContext(ctx, parent.ParentSpan())
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, fmt.Sprintf("Step %s", step.Type()),
+		trace.WithAttributes(tracing.StepTypeKey.String(string(step.Type()))))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	response, err := step.
+		WithHistory(history, true).
+		WithCallOptions([]llms.CallOption{llms.WithTools(f.toolMgr.GetLLMTools())}).
+		Execute(ctx)
+	if err != nil {
+		return history, fmt.Errorf("failed to execute step: %w", err)
+	}
 
-		if requiresClarificationStep {
-			logger.V(2).Info("Added AI Step")
-			f.chain.PushNext(steps.NewLLMStep(f.llm), true)
+	if step.Type() == steps.StepTypeLLM {
+		record := f.tracker.Record(response)
+		logger.V(2).Info("LLM step usage", "model", record.Model, "run", record.Run,
+			"promptTokens", record.Usage.PromptTokens, "completionTokens", record.Usage.CompletionTokens,
+			"cost", record.Cost)
+	}
+
+	history = appendHistory(ctx, history, step.ToMessageContent(response))
+
+	msgs, requiresClarificationStep := f.toolMgr.ExecuteToolCalls(ctx, response)
+	for _, msg := range msgs { // this could potentially add a step
+		logger.V(4).Info("Tool Used", "content", msg.Parts)
+		history = appendHistory(ctx, history, msg)
+	}
+
+	if requiresClarificationStep {
+		logger.V(2).Info("Added AI Step")
+		var clarificationStep steps.Step = steps.NewLLMStep(f.llm)
+		if hasParent { // the clarification is part of the same KueryFlow run
+			clarificationStep = steps.WithParentSpan(clarificationStep, parent.ParentSpan())
 		}
+
+		f.chain.PushNext(clarificationStep, true)
 	}
 
 	return history, nil
@@ -0,0 +1,49 @@
+package kuery
+
+import (
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/rest"
+)
+
+// Session identifies a single user's conversation with Kuery.
+// Every ConversationalFlow is bound to one session, and owns the tool state
+// (approvals, retries, tool-call history) of that session.
+type Session struct {
+	// ID uniquely identifies the session.
+	ID string
+	// User is the Kubernetes username the session acts as. If empty, the
+	// session acts with Kuery's own identity.
+	User string
+	// Groups are the Kubernetes groups the session acts as, in addition to
+	// User.
+	Groups []string
+}
+
+// NewSession creates a new session with a random ID that acts as the given
+// user and groups.
+func NewSession(user string, groups []string) Session {
+	return Session{
+		ID:     string(uuid.NewUUID()),
+		User:   user,
+		Groups: groups,
+	}
+}
+
+// RESTConfig returns a copy of cfg that impersonates the session's identity,
+// so that the API server enforces the RBAC of the end user rather than that of
+// Kuery. If the session has no user, a plain copy of cfg is returned.
+func (s Session) RESTConfig(cfg *rest.Config) *rest.Config {
+	if cfg == nil {
+		return nil
+	}
+
+	sessionCfg := rest.CopyConfig(cfg)
+	if s.User != "" {
+		sessionCfg.Impersonate = rest.ImpersonationConfig{
+			UserName: s.User,
+			Groups:   s.Groups,
+		}
+	}
+
+	return sessionCfg
+}
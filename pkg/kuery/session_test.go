@@ -0,0 +1,81 @@
+package kuery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+	"k8s.io/client-go/rest"
+
+	llmproviders "github.com/kube-agent/kuery/pkg/llm-providers"
+	"github.com/kube-agent/kuery/pkg/tools/api"
+)
+
+func TestSessionRESTConfig(t *testing.T) {
+	cfg := &rest.Config{Host: "https://cluster.example.com", BearerToken: "kuery"}
+
+	sessionCfg := NewSession("alice", []string{"devs", "ops"}).RESTConfig(cfg)
+	impersonate := sessionCfg.Impersonate
+	if impersonate.UserName != "alice" || !slices.Equal(impersonate.Groups, []string{"devs", "ops"}) {
+		t.Errorf("RESTConfig() impersonates %+v, want alice of [devs ops]", impersonate)
+	}
+
+	if sessionCfg.Host != cfg.Host || sessionCfg.BearerToken != cfg.BearerToken {
+		t.Errorf("RESTConfig() = %+v, want a copy of %+v", sessionCfg, cfg)
+	}
+
+	if cfg.Impersonate.UserName != "" {
+		t.Errorf("RESTConfig() modified the shared config to impersonate %q", cfg.Impersonate.UserName)
+	}
+
+	if anonymousCfg := NewSession("", []string{"devs"}).RESTConfig(cfg); anonymousCfg == cfg ||
+		anonymousCfg.Impersonate.UserName != "" || len(anonymousCfg.Impersonate.Groups) != 0 {
+		t.Errorf("RESTConfig() of a session without a user impersonates %+v, want a plain copy",
+			anonymousCfg.Impersonate)
+	}
+
+	if NewSession("alice", nil).RESTConfig(nil) != nil {
+		t.Error("RESTConfig(nil) != nil")
+	}
+}
+
+func TestConversationalFlowImpersonatesSessionUser(t *testing.T) {
+	var mu sync.Mutex
+	var users []string
+	var groups [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		users = append(users, req.Header.Get("Impersonate-User"))
+		groups = append(groups, req.Header.Values("Impersonate-Group"))
+		mu.Unlock()
+
+		http.NotFound(w, req)
+	}))
+	defer server.Close()
+
+	flow := NewConversationalFlow(NewSession("alice", []string{"devs"}), "", llmproviders.NewScriptedModel(),
+		api.NewToolManager(), NewClusters("test", &rest.Config{Host: server.URL}))
+	defer flow.Close()
+
+	flow.ToolManager().ExecuteToolCalls(context.Background(), &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		ToolCalls: []llms.ToolCall{{ID: "1", Type: "function", FunctionCall: &llms.FunctionCall{
+			Name: "K8sPodLogs", Arguments: `{"namespace":"default","pod":"web"}`}}},
+	}}})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(users) == 0 {
+		t.Fatal("the tools of the session did not call the cluster")
+	}
+
+	for i, user := range users {
+		if user != "alice" || !slices.Equal(groups[i], []string{"devs"}) {
+			t.Errorf("request %d impersonated %q of %v, want alice of [devs]", i, user, groups[i])
+		}
+	}
+}
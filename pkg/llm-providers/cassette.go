@@ -0,0 +1,320 @@
+package llm_providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// CassetteMode is the mode a cassette is used in.
+type CassetteMode string
+
+const (
+	// CassetteModeRecord calls the provider and records every exchange to the
+	// cassette.
+	CassetteModeRecord CassetteMode = "record"
+	// CassetteModeReplay plays the exchanges of the cassette back instead of
+	// calling a provider.
+	CassetteModeReplay CassetteMode = "replay"
+)
+
+// Cassette is a recording of the exchanges with a model.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single recorded exchange with a model.
+type Interaction struct {
+	// RequestHash identifies the request (see requestHash).
+	RequestHash string `json:"requestHash"`
+	// Messages are the messages of the request, recorded for review only.
+	Messages json.RawMessage `json:"messages"`
+	// Tools are the names of the tools offered in the request.
+	Tools []string `json:"tools,omitempty"`
+	// Choices are the response choices of the model, unless Error is set.
+	Choices []RecordedChoice `json:"choices,omitempty"`
+	// Error is the error the model returned.
+	Error string `json:"error,omitempty"`
+}
+
+// RecordedChoice is a recorded llms.ContentChoice. It is recorded separately
+// since llms.ToolCall does not survive a JSON round-trip.
+type RecordedChoice struct {
+	Content        string             `json:"content,omitempty"`
+	StopReason     string             `json:"stopReason,omitempty"`
+	GenerationInfo map[string]any     `json:"generationInfo,omitempty"`
+	ToolCalls      []RecordedToolCall `json:"toolCalls,omitempty"`
+}
+
+// RecordedToolCall is a recorded llms.ToolCall.
+type RecordedToolCall struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// recordResponse converts a response to its recorded choices.
+func recordResponse(response *llms.ContentResponse) []RecordedChoice {
+	if response == nil {
+		return nil
+	}
+
+	choices := make([]RecordedChoice, 0, len(response.Choices))
+	for _, choice := range response.Choices {
+		recorded := RecordedChoice{
+			Content:        choice.Content,
+			StopReason:     choice.StopReason,
+			GenerationInfo: choice.GenerationInfo,
+		}
+
+		for _, toolCall := range choice.ToolCalls {
+			recordedCall := RecordedToolCall{ID: toolCall.ID, Type: toolCall.Type}
+			if toolCall.FunctionCall != nil {
+				recordedCall.Name = toolCall.FunctionCall.Name
+				recordedCall.Arguments = toolCall.FunctionCall.Arguments
+			}
+
+			recorded.ToolCalls = append(recorded.ToolCalls, recordedCall)
+		}
+
+		choices = append(choices, recorded)
+	}
+
+	return choices
+}
+
+// response converts the recorded choices of the interaction back to a
+// response.
+func (i Interaction) response() *llms.ContentResponse {
+	response := &llms.ContentResponse{}
+	for _, recorded := range i.Choices {
+		choice := &llms.ContentChoice{
+			Content:        recorded.Content,
+			StopReason:     recorded.StopReason,
+			GenerationInfo: recorded.GenerationInfo,
+		}
+
+		for _, toolCall := range recorded.ToolCalls {
+			choice.ToolCalls = append(choice.ToolCalls, llms.ToolCall{
+				ID:           toolCall.ID,
+				Type:         toolCall.Type,
+				FunctionCall: &llms.FunctionCall{Name: toolCall.Name, Arguments: toolCall.Arguments},
+			})
+		}
+
+		if len(choice.ToolCalls) > 0 {
+			choice.FuncCall = choice.ToolCalls[0].FunctionCall
+		}
+
+		response.Choices = append(response.Choices, choice)
+	}
+
+	return response
+}
+
+// LoadCassette reads a cassette from the given file.
+func LoadCassette(file string) (*Cassette, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	var cassette Cassette
+	if err := yaml.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cassette: %w", err)
+	}
+
+	return &cassette, nil
+}
+
+// Save writes the cassette to the given file.
+func (c *Cassette) Save(file string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+
+	return nil
+}
+
+var _ llms.Model = &RecordingModel{}
+
+// RecordingModel is a model that records every exchange with the model it
+// wraps to a cassette file, which is rewritten after every exchange.
+// A RecordingModel is safe for concurrent use.
+type RecordingModel struct {
+	model llms.Model
+	file  string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecordingModel creates a new RecordingModel recording the exchanges with
+// model to file.
+func NewRecordingModel(model llms.Model, file string) *RecordingModel {
+	return &RecordingModel{
+		model: model,
+		file:  file,
+	}
+}
+
+// GenerateContent calls the wrapped model and records the exchange.
+func (m *RecordingModel) GenerateContent(ctx context.Context, messages []llms.MessageContent,
+	options ...llms.CallOption) (*llms.ContentResponse, error) {
+	response, err := m.model.GenerateContent(ctx, messages, options...)
+
+	interaction, hashErr := newInteraction(messages, options)
+	if hashErr != nil {
+		klog.FromContext(ctx).Error(hashErr, "failed to record LLM interaction")
+		return response, err
+	}
+
+	interaction.Choices = recordResponse(response)
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cassette.Interactions = append(m.cassette.Interactions, interaction)
+	if saveErr := m.cassette.Save(m.file); saveErr != nil {
+		klog.FromContext(ctx).Error(saveErr, "failed to save cassette", "file", m.file)
+	}
+
+	return response, err
+}
+
+// Call calls the wrapped model through GenerateContent, recording the
+// exchange.
+func (m *RecordingModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+var _ llms.Model = &ReplayingModel{}
+
+// ReplayingModel is a model that plays the exchanges of a cassette back.
+// Every request is answered with the first unplayed interaction recorded for
+// an identical request, or, if there is none (e.g., the tool outputs of the
+// replay differ from those of the recording), with the next unplayed
+// interaction in order.
+// A ReplayingModel is safe for concurrent use.
+type ReplayingModel struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	played   []bool
+}
+
+// NewReplayingModel creates a new ReplayingModel playing the given cassette
+// back.
+func NewReplayingModel(cassette *Cassette) *ReplayingModel {
+	return &ReplayingModel{
+		cassette: cassette,
+		played:   make([]bool, len(cassette.Interactions)),
+	}
+}
+
+// GenerateContent returns the recorded response to the request.
+func (m *ReplayingModel) GenerateContent(ctx context.Context, messages []llms.MessageContent,
+	options ...llms.CallOption) (*llms.ContentResponse, error) {
+	request, err := newInteraction(messages, options)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := -1
+	for idx, interaction := range m.cassette.Interactions {
+		if m.played[idx] {
+			continue
+		}
+
+		if next == -1 {
+			next = idx
+		}
+
+		if interaction.RequestHash == request.RequestHash {
+			next = idx
+			break
+		}
+	}
+
+	if next == -1 {
+		return nil, fmt.Errorf("cassette exhausted after %d interactions", len(m.cassette.Interactions))
+	}
+
+	interaction := m.cassette.Interactions[next]
+	if interaction.RequestHash != request.RequestHash {
+		klog.FromContext(ctx).V(2).Info("Replaying LLM interaction recorded for a different request",
+			"interaction", next)
+	}
+
+	m.played[next] = true
+	if interaction.Error != "" {
+		return nil, fmt.Errorf("%s", interaction.Error)
+	}
+
+	return interaction.response(), nil
+}
+
+// Call returns the text of the recorded response to the prompt.
+func (m *ReplayingModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// newInteraction creates the interaction of a request, without its response.
+func newInteraction(messages []llms.MessageContent, options []llms.CallOption) (Interaction, error) {
+	callOptions := llms.CallOptions{}
+	for _, option := range options {
+		option(&callOptions)
+	}
+
+	tools := make([]string, 0, len(callOptions.Tools))
+	for _, tool := range callOptions.Tools {
+		if tool.Function != nil {
+			tools = append(tools, tool.Function.Name)
+		}
+	}
+	sort.Strings(tools) // tools are offered in no particular order
+
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return Interaction{}, fmt.Errorf("failed to marshal request messages: %w", err)
+	}
+
+	return Interaction{
+		RequestHash: requestHash(data, tools),
+		Messages:    data,
+		Tools:       tools,
+	}, nil
+}
+
+// requestHash returns a hash identifying a request by its marshaled messages
+// and the names of the tools it offers.
+func requestHash(messages []byte, tools []string) string {
+	hash := sha256.New()
+	hash.Write(messages)
+	for _, tool := range tools {
+		hash.Write([]byte("\x00" + tool))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,114 @@
+package llm_providers
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestCassetteRecordReplayRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "cassette.yaml")
+	options := []llms.CallOption{llms.WithTools([]llms.Tool{
+		{Type: "function", Function: &llms.FunctionDefinition{Name: "K8sLogs"}},
+		{Type: "function", Function: &llms.FunctionDefinition{Name: "K8sDynamicClient"}},
+	})}
+
+	first := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "why is web crashing?")}
+	second := append(first, llms.TextParts(llms.ChatMessageTypeTool, "OOMKilled"))
+	third := append(second, llms.TextParts(llms.ChatMessageTypeHuman, "thanks"))
+
+	recorder := NewRecordingModel(NewScriptedModel(
+		ToolCallsResponse(llms.FunctionCall{Name: "K8sLogs", Arguments: `{"namespace":"default","name":"web"}`}),
+		TextResponse("web runs out of memory"),
+		ScriptedResponse{Err: errors.New("overloaded")},
+	), file)
+
+	var recorded []*llms.ContentResponse
+	for _, messages := range [][]llms.MessageContent{first, second} {
+		response, err := recorder.GenerateContent(ctx, messages, options...)
+		if err != nil {
+			t.Fatalf("recording GenerateContent() error = %v", err)
+		}
+
+		recorded = append(recorded, response)
+	}
+
+	if _, err := recorder.GenerateContent(ctx, third, options...); err == nil {
+		t.Fatal("recording GenerateContent() did not return the error of the model")
+	}
+
+	cassette, err := LoadCassette(file)
+	if err != nil {
+		t.Fatalf("LoadCassette() error = %v", err)
+	}
+
+	if len(cassette.Interactions) != 3 {
+		t.Fatalf("cassette has %d interactions, want 3", len(cassette.Interactions))
+	}
+
+	if tools := cassette.Interactions[0].Tools; !reflect.DeepEqual(tools, []string{"K8sDynamicClient", "K8sLogs"}) {
+		t.Errorf("recorded tools = %v, want them sorted", tools)
+	}
+
+	// requests are matched by hash, regardless of the order they are replayed in
+	replayer := NewReplayingModel(cassette)
+	for _, idx := range []int{1, 0} {
+		messages := [][]llms.MessageContent{first, second}[idx]
+		response, err := replayer.GenerateContent(ctx, messages, options...)
+		if err != nil {
+			t.Fatalf("replaying GenerateContent() error = %v", err)
+		}
+
+		assertSameResponse(t, response, recorded[idx])
+	}
+
+	if _, err := replayer.GenerateContent(ctx, third, options...); err == nil || err.Error() != "overloaded" {
+		t.Errorf("replaying GenerateContent() error = %v, want the recorded error", err)
+	}
+
+	if _, err := replayer.GenerateContent(ctx, first, options...); err == nil {
+		t.Error("replaying GenerateContent() of an exhausted cassette succeeded")
+	}
+}
+
+func TestReplayingModelFallsBackToNextInteraction(t *testing.T) {
+	cassette := &Cassette{Interactions: []Interaction{
+		{RequestHash: "recorded", Choices: []RecordedChoice{{Content: "first"}}},
+		{RequestHash: "recorded", Choices: []RecordedChoice{{Content: "second"}}},
+	}}
+	replayer := NewReplayingModel(cassette)
+
+	for _, want := range []string{"first", "second"} {
+		text, err := replayer.Call(context.Background(), "a prompt that differs from the recording")
+		if err != nil || text != want {
+			t.Errorf("Call() = %q, %v, want %q", text, err, want)
+		}
+	}
+}
+
+// assertSameResponse fails the test if the replayed response differs from the
+// recorded one in its content or tool calls.
+func assertSameResponse(t *testing.T, replayed, recorded *llms.ContentResponse) {
+	t.Helper()
+
+	if len(replayed.Choices) != len(recorded.Choices) {
+		t.Fatalf("replayed %d choices, want %d", len(replayed.Choices), len(recorded.Choices))
+	}
+
+	for idx, choice := range replayed.Choices {
+		want := recorded.Choices[idx]
+		if choice.Content != want.Content || choice.StopReason != want.StopReason {
+			t.Errorf("replayed choice %d = %q (%s), want %q (%s)", idx, choice.Content, choice.StopReason,
+				want.Content, want.StopReason)
+		}
+
+		if !reflect.DeepEqual(choice.ToolCalls, want.ToolCalls) {
+			t.Errorf("replayed tool calls %+v, want %+v", choice.ToolCalls, want.ToolCalls)
+		}
+	}
+}
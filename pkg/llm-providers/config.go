@@ -0,0 +1,246 @@
+package llm_providers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Provider is an LLM provider Kuery can converse with.
+type Provider string
+
+const (
+	// ProviderOpenAI is the OpenAI API.
+	ProviderOpenAI Provider = "openai"
+	// ProviderAnthropic is the Anthropic API.
+	ProviderAnthropic Provider = "anthropic"
+	// ProviderOllama is a local Ollama server, used through its
+	// OpenAI-compatible API.
+	ProviderOllama Provider = "ollama"
+	// ProviderOpenAICompatible is any server implementing the OpenAI chat
+	// completions API (e.g., vLLM, LocalAI, LM Studio), at BaseURL.
+	ProviderOpenAICompatible Provider = "openai-compatible"
+)
+
+// Config configures the LLM Kuery converses with.
+type Config struct {
+	// Provider is the provider of the model.
+	Provider Provider `json:"provider"`
+	// Model is the name of the model, defaults to a provider-specific model.
+	Model string `json:"model,omitempty"`
+	// BaseURL is the URL of the provider API, defaults to the provider's
+	// public (or for Ollama, local) endpoint.
+	BaseURL string `json:"baseURL,omitempty"`
+	// APIKeyEnv is the environment variable holding the API key, defaults to
+	// the provider's standard variable (e.g., OPENAI_API_KEY).
+	APIKeyEnv string `json:"apiKeyEnv,omitempty"`
+	// Temperature is the sampling temperature, defaults to the provider's.
+	Temperature *float64 `json:"temperature,omitempty"`
+	// MaxTokens is the maximum number of tokens per response, defaults to
+	// the provider's.
+	MaxTokens int `json:"maxTokens,omitempty"`
+
+	// MaxRetries is the number of times a call failing with a transient error
+	// (e.g., rate limiting or a 5xx) is retried, defaults to 3. Zero disables
+	// retries.
+	MaxRetries *int `json:"maxRetries,omitempty"`
+	// RetryBackoff is the delay before the first retry, doubled on every
+	// retry, defaults to 1s.
+	RetryBackoff *metav1.Duration `json:"retryBackoff,omitempty"`
+	// MaxRetryBackoff is the maximum delay between retries, defaults to 30s.
+	MaxRetryBackoff *metav1.Duration `json:"maxRetryBackoff,omitempty"`
+	// Fallback is the LLM to fall back to when calls keep failing with
+	// transient errors after the retries, e.g. another provider. Fields it
+	// does not set are not inherited, and it is retried like the primary LLM.
+	Fallback *Config `json:"fallback,omitempty"`
+
+	// Cassette is the file exchanges with the model are recorded to or
+	// replayed from, depending on CassetteMode.
+	Cassette string `json:"cassette,omitempty"`
+	// CassetteMode is the mode the cassette is used in, record or replay.
+	// When replaying, no provider is called.
+	CassetteMode CassetteMode `json:"cassetteMode,omitempty"`
+}
+
+// LoadConfig reads a YAML (or JSON) LLM configuration from the given file.
+func LoadConfig(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LLM config file: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal LLM config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// ConfigFromEnv reads the LLM configuration from the LLM, MODEL, LLM_BASE_URL,
+// LLM_TEMPERATURE, LLM_MAX_TOKENS, LLM_MAX_RETRIES, LLM_FALLBACK,
+// LLM_FALLBACK_MODEL, LLM_CASSETTE and LLM_CASSETTE_MODE environment
+// variables.
+func ConfigFromEnv() (*Config, error) {
+	cfg := &Config{
+		Provider:     Provider(strings.ToLower(os.Getenv("LLM"))),
+		Model:        os.Getenv("MODEL"),
+		BaseURL:      os.Getenv("LLM_BASE_URL"),
+		Cassette:     os.Getenv("LLM_CASSETTE"),
+		CassetteMode: CassetteMode(strings.ToLower(os.Getenv("LLM_CASSETTE_MODE"))),
+	}
+
+	if temperature := os.Getenv("LLM_TEMPERATURE"); temperature != "" {
+		value, err := strconv.ParseFloat(temperature, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LLM_TEMPERATURE: %w", err)
+		}
+
+		cfg.Temperature = &value
+	}
+
+	if maxTokens := os.Getenv("LLM_MAX_TOKENS"); maxTokens != "" {
+		value, err := strconv.Atoi(maxTokens)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LLM_MAX_TOKENS: %w", err)
+		}
+
+		cfg.MaxTokens = value
+	}
+
+	if maxRetries := os.Getenv("LLM_MAX_RETRIES"); maxRetries != "" {
+		value, err := strconv.Atoi(maxRetries)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LLM_MAX_RETRIES: %w", err)
+		}
+
+		cfg.MaxRetries = &value
+	}
+
+	if fallback := os.Getenv("LLM_FALLBACK"); fallback != "" {
+		cfg.Fallback = &Config{
+			Provider: Provider(strings.ToLower(fallback)),
+			Model:    os.Getenv("LLM_FALLBACK_MODEL"),
+		}
+	}
+
+	return cfg, nil
+}
+
+// Merge returns a copy of c with the fields set in override replacing its
+// own.
+func (c Config) Merge(override Config) Config {
+	if override.Provider != "" {
+		c.Provider = override.Provider
+	}
+	if override.Model != "" {
+		c.Model = override.Model
+	}
+	if override.BaseURL != "" {
+		c.BaseURL = override.BaseURL
+	}
+	if override.APIKeyEnv != "" {
+		c.APIKeyEnv = override.APIKeyEnv
+	}
+	if override.Temperature != nil {
+		c.Temperature = override.Temperature
+	}
+	if override.MaxTokens != 0 {
+		c.MaxTokens = override.MaxTokens
+	}
+	if override.MaxRetries != nil {
+		c.MaxRetries = override.MaxRetries
+	}
+	if override.RetryBackoff != nil {
+		c.RetryBackoff = override.RetryBackoff
+	}
+	if override.MaxRetryBackoff != nil {
+		c.MaxRetryBackoff = override.MaxRetryBackoff
+	}
+	if override.Fallback != nil {
+		if c.Fallback == nil || override.Fallback.Provider != "" && override.Fallback.Provider != c.Fallback.Provider {
+			c.Fallback = override.Fallback // a different fallback LLM altogether
+		} else {
+			fallback := c.Fallback.Merge(*override.Fallback)
+			c.Fallback = &fallback
+		}
+	}
+	if override.Cassette != "" {
+		c.Cassette = override.Cassette
+	}
+	if override.CassetteMode != "" {
+		c.CassetteMode = override.CassetteMode
+	}
+
+	return c
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c Config) Validate() error {
+	switch c.CassetteMode {
+	case "":
+	case CassetteModeRecord, CassetteModeReplay:
+		if c.Cassette == "" {
+			return fmt.Errorf("cassette is required for cassette mode %s", c.CassetteMode)
+		}
+
+		if c.CassetteMode == CassetteModeReplay {
+			return nil // no provider is called
+		}
+	default:
+		return fmt.Errorf("invalid cassette mode %q, expected %s or %s", c.CassetteMode,
+			CassetteModeRecord, CassetteModeReplay)
+	}
+
+	switch c.Provider {
+	case ProviderOpenAI, ProviderAnthropic, ProviderOllama:
+	case ProviderOpenAICompatible:
+		if c.BaseURL == "" {
+			return fmt.Errorf("baseURL is required for provider %s", c.Provider)
+		}
+		if c.Model == "" {
+			return fmt.Errorf("model is required for provider %s", c.Provider)
+		}
+	case "":
+		return fmt.Errorf("LLM provider not set")
+	default:
+		return fmt.Errorf("invalid LLM provider %q, expected one of: %s, %s, %s, %s", c.Provider,
+			ProviderOpenAI, ProviderAnthropic, ProviderOllama, ProviderOpenAICompatible)
+	}
+
+	if c.Temperature != nil && (*c.Temperature < 0 || *c.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2, got %v", *c.Temperature)
+	}
+
+	if c.MaxTokens < 0 {
+		return fmt.Errorf("maxTokens must not be negative, got %d", c.MaxTokens)
+	}
+
+	if c.MaxRetries != nil && *c.MaxRetries < 0 {
+		return fmt.Errorf("maxRetries must not be negative, got %d", *c.MaxRetries)
+	}
+
+	if c.RetryBackoff != nil && c.RetryBackoff.Duration <= 0 {
+		return fmt.Errorf("retryBackoff must be positive, got %v", c.RetryBackoff.Duration)
+	}
+
+	if c.MaxRetryBackoff != nil && c.MaxRetryBackoff.Duration <= 0 {
+		return fmt.Errorf("maxRetryBackoff must be positive, got %v", c.MaxRetryBackoff.Duration)
+	}
+
+	if c.Fallback != nil {
+		if c.Fallback.Fallback != nil || c.Fallback.Cassette != "" || c.Fallback.CassetteMode != "" {
+			return fmt.Errorf("fallback LLM must not have a fallback or a cassette")
+		}
+
+		if err := c.Fallback.Validate(); err != nil {
+			return fmt.Errorf("invalid fallback LLM: %w", err)
+		}
+	}
+
+	return nil
+}
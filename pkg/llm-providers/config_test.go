@@ -0,0 +1,182 @@
+package llm_providers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// writeConfig writes the LLM configuration to a file and returns its path.
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "llm.yaml")
+	if err := os.WriteFile(file, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	t.Setenv("LLM", "OpenAI")
+	t.Setenv("MODEL", "gpt-4o")
+	t.Setenv("LLM_BASE_URL", "https://proxy.example.com/v1")
+	t.Setenv("LLM_TEMPERATURE", "0.5")
+	t.Setenv("LLM_MAX_RETRIES", "5")
+	t.Setenv("LLM_FALLBACK", "anthropic")
+	t.Setenv("LLM_FALLBACK_MODEL", "claude-3-5-haiku-20241022")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv() error = %v", err)
+	}
+
+	fileCfg, err := LoadConfig(writeConfig(t, `
+model: gpt-4o-mini
+maxTokens: 1024
+retryBackoff: 2s
+fallback:
+  provider: anthropic
+  maxTokens: 512
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	temperature := 0.1
+	merged := cfg.Merge(*fileCfg).Merge(Config{Temperature: &temperature}) // the flags override the file
+
+	if merged.Provider != ProviderOpenAI || merged.BaseURL != "https://proxy.example.com/v1" ||
+		*merged.MaxRetries != 5 {
+		t.Errorf("merged config = %+v, want the provider, base URL and retries of the environment", merged)
+	}
+
+	if merged.Model != "gpt-4o-mini" || merged.MaxTokens != 1024 || merged.RetryBackoff.Duration != 2*time.Second {
+		t.Errorf("merged config = %+v, want the model, max tokens and backoff of the file", merged)
+	}
+
+	if *merged.Temperature != 0.1 {
+		t.Errorf("merged temperature = %v, want that of the flags", *merged.Temperature)
+	}
+
+	// the file configures the same fallback LLM as the environment, and refines it
+	if fallback := merged.Fallback; fallback.Provider != ProviderAnthropic ||
+		fallback.Model != "claude-3-5-haiku-20241022" || fallback.MaxTokens != 512 {
+		t.Errorf("merged fallback = %+v, want the model of the environment and the max tokens of the file", fallback)
+	}
+
+	if cfg.Model != "gpt-4o" || cfg.Fallback.MaxTokens != 0 {
+		t.Errorf("Merge() modified the config it merged into: %+v", cfg)
+	}
+
+	if err := merged.Validate(); err != nil {
+		t.Errorf("Validate() of the merged config = %v", err)
+	}
+}
+
+func TestConfigMergeReplacesDifferentFallback(t *testing.T) {
+	cfg := Config{Provider: ProviderOpenAI, Fallback: &Config{Provider: ProviderAnthropic, Model: "claude"}}
+
+	merged := cfg.Merge(Config{Fallback: &Config{Provider: ProviderOllama}})
+	if merged.Fallback.Provider != ProviderOllama || merged.Fallback.Model != "" {
+		t.Errorf("merged fallback = %+v, want the Ollama fallback without the model of the Anthropic one",
+			merged.Fallback)
+	}
+}
+
+func TestConfigFromEnvRejectsInvalidNumbers(t *testing.T) {
+	for _, variable := range []string{"LLM_TEMPERATURE", "LLM_MAX_TOKENS", "LLM_MAX_RETRIES"} {
+		t.Run(variable, func(t *testing.T) {
+			t.Setenv(variable, "many")
+
+			if _, err := ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), "invalid "+variable) {
+				t.Errorf("ConfigFromEnv() error = %v, want %s rejected", err, variable)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRejectsUnknownFields(t *testing.T) {
+	if _, err := LoadConfig(writeConfig(t, "provider: openai\ntemprature: 0.2\n")); err == nil {
+		t.Error("LoadConfig() of a misspelled field succeeded, want an error")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	negative, tooHot := -1, 2.5
+
+	for _, tc := range []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{name: "openai", cfg: Config{Provider: ProviderOpenAI}},
+		{name: "ollama", cfg: Config{Provider: ProviderOllama}},
+		{name: "no provider", wantErr: "LLM provider not set"},
+		{name: "unknown provider", cfg: Config{Provider: "gemini"}, wantErr: `invalid LLM provider "gemini"`},
+		{name: "openai-compatible without base URL", cfg: Config{Provider: ProviderOpenAICompatible, Model: "m"},
+			wantErr: "baseURL is required"},
+		{name: "openai-compatible without model",
+			cfg:     Config{Provider: ProviderOpenAICompatible, BaseURL: "http://vllm:8000/v1"},
+			wantErr: "model is required"},
+		{name: "temperature", cfg: Config{Provider: ProviderOpenAI, Temperature: &tooHot},
+			wantErr: "temperature must be between 0 and 2"},
+		{name: "max tokens", cfg: Config{Provider: ProviderOpenAI, MaxTokens: -1},
+			wantErr: "maxTokens must not be negative"},
+		{name: "max retries", cfg: Config{Provider: ProviderOpenAI, MaxRetries: &negative},
+			wantErr: "maxRetries must not be negative"},
+		{name: "retry backoff", cfg: Config{Provider: ProviderOpenAI, RetryBackoff: &metav1.Duration{}},
+			wantErr: "retryBackoff must be positive"},
+		{name: "max retry backoff", cfg: Config{Provider: ProviderOpenAI, MaxRetryBackoff: &metav1.Duration{}},
+			wantErr: "maxRetryBackoff must be positive"},
+		{name: "invalid fallback", cfg: Config{Provider: ProviderOpenAI, Fallback: &Config{Provider: "gemini"}},
+			wantErr: "invalid fallback LLM"},
+		{name: "nested fallback", cfg: Config{Provider: ProviderOpenAI, Fallback: &Config{
+			Provider: ProviderAnthropic, Fallback: &Config{Provider: ProviderOllama}}},
+			wantErr: "fallback LLM must not have a fallback"},
+		{name: "replay without provider", cfg: Config{Cassette: "session.yaml", CassetteMode: CassetteModeReplay}},
+		{name: "record without cassette", cfg: Config{Provider: ProviderOpenAI, CassetteMode: CassetteModeRecord},
+			wantErr: "cassette is required"},
+		{name: "unknown cassette mode", cfg: Config{Provider: ProviderOpenAI, Cassette: "session.yaml",
+			CassetteMode: "rewind"}, wantErr: `invalid cassette mode "rewind"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("Validate() = %v, want no error", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("Validate() = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigWithDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		cfg                    Config
+		wantModel, wantBaseURL string
+		wantAPIKeyEnv          string
+	}{
+		{cfg: Config{Provider: ProviderOpenAI}, wantModel: defaultOpenAIModel, wantAPIKeyEnv: "OPENAI_API_KEY"},
+		{cfg: Config{Provider: ProviderAnthropic, Model: "claude-3-opus"}, wantModel: "claude-3-opus",
+			wantAPIKeyEnv: "ANTHROPIC_API_KEY"},
+		{cfg: Config{Provider: ProviderOllama}, wantModel: defaultOllamaModel, wantBaseURL: defaultOllamaBaseURL},
+	} {
+		cfg := tc.cfg.WithDefaults()
+		if cfg.Model != tc.wantModel || cfg.BaseURL != tc.wantBaseURL || cfg.APIKeyEnv != tc.wantAPIKeyEnv {
+			t.Errorf("WithDefaults() of %s = %+v, want model %q, base URL %q and API key from %q", tc.cfg.Provider,
+				cfg, tc.wantModel, tc.wantBaseURL, tc.wantAPIKeyEnv)
+		}
+
+		if *cfg.MaxRetries != defaultMaxRetries || cfg.RetryBackoff.Duration != defaultRetryBackoff ||
+			cfg.MaxRetryBackoff.Duration != defaultMaxRetryBackoff {
+			t.Errorf("WithDefaults() of %s = %+v, want the default retries", tc.cfg.Provider, cfg)
+		}
+	}
+}
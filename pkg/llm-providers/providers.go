@@ -0,0 +1,206 @@
+package llm_providers
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/openai"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	defaultOpenAIModel    = "gpt-4-1106-preview"
+	defaultAnthropicModel = "claude-3-5-sonnet-20241022"
+	defaultOllamaModel    = "llama3.1"
+
+	// defaultOllamaBaseURL is the OpenAI-compatible endpoint of a local Ollama
+	// server. The native Ollama API does not support tool calls.
+	defaultOllamaBaseURL = "http://localhost:11434/v1"
+	// localAPIKey is sent to local servers that do not require an API key,
+	// since the OpenAI client refuses to run without one.
+	localAPIKey = "local"
+)
+
+// New creates the model the configuration describes, with the defaults it
+// specifies applied to every call. Calls failing with transient errors are
+// retried, and then sent to the fallback model if configured. With a
+// cassette, the exchanges with the model are recorded, or replayed instead of
+// calling the provider.
+func New(cfg Config) (llms.Model, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.CassetteMode == CassetteModeReplay {
+		cassette, err := LoadCassette(cfg.Cassette)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewReplayingModel(cassette), nil
+	}
+
+	model, err := newResilientModel(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.CassetteMode == CassetteModeRecord {
+		return NewRecordingModel(model, cfg.Cassette), nil
+	}
+
+	return model, nil
+}
+
+// newResilientModel creates the model of the configured provider, retrying
+// transient errors and falling back to the configured fallback model.
+func newResilientModel(cfg Config) (llms.Model, error) {
+	cfg = cfg.WithDefaults()
+
+	model, err := newProviderModel(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resilient := NewResilientModel(model, cfg.name(), *cfg.MaxRetries, cfg.RetryBackoff.Duration,
+		cfg.MaxRetryBackoff.Duration)
+
+	if cfg.Fallback != nil {
+		fallback, err := newProviderModel(*cfg.Fallback)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create fallback LLM: %w", err)
+		}
+
+		resilient = resilient.WithFallback(fallback, cfg.Fallback.name())
+	}
+
+	return resilient, nil
+}
+
+// newProviderModel creates the model of the configured provider.
+func newProviderModel(cfg Config) (llms.Model, error) {
+	cfg = cfg.WithDefaults()
+
+	var (
+		model llms.Model
+		err   error
+	)
+
+	switch cfg.Provider {
+	case ProviderAnthropic:
+		opts := []anthropic.Option{anthropic.WithModel(cfg.Model)}
+		if cfg.BaseURL != "" {
+			opts = append(opts, anthropic.WithBaseURL(cfg.BaseURL))
+		}
+		if apiKey := os.Getenv(cfg.APIKeyEnv); apiKey != "" {
+			opts = append(opts, anthropic.WithToken(apiKey))
+		}
+
+		model, err = anthropic.New(opts...)
+	default: // OpenAI and OpenAI-compatible servers
+		opts := []openai.Option{openai.WithModel(cfg.Model)}
+		if cfg.BaseURL != "" {
+			opts = append(opts, openai.WithBaseURL(cfg.BaseURL))
+		}
+
+		apiKey := os.Getenv(cfg.APIKeyEnv)
+		if apiKey == "" && cfg.Provider != ProviderOpenAI {
+			apiKey = localAPIKey
+		}
+		if apiKey != "" {
+			opts = append(opts, openai.WithToken(apiKey))
+		}
+
+		model, err = openai.New(opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s LLM: %w", cfg.Provider, err)
+	}
+
+	var defaults []llms.CallOption
+	if cfg.Temperature != nil {
+		defaults = append(defaults, llms.WithTemperature(*cfg.Temperature))
+	}
+	if cfg.MaxTokens > 0 {
+		defaults = append(defaults, llms.WithMaxTokens(cfg.MaxTokens))
+	}
+
+	if len(defaults) == 0 {
+		return model, nil
+	}
+
+	return &defaultsModel{Model: model, defaults: defaults}, nil
+}
+
+// WithDefaults returns a copy of the configuration with the provider defaults
+// filled in.
+func (c Config) WithDefaults() Config {
+	switch c.Provider {
+	case ProviderOpenAI:
+		if c.Model == "" {
+			c.Model = defaultOpenAIModel
+		}
+		if c.APIKeyEnv == "" {
+			c.APIKeyEnv = "OPENAI_API_KEY"
+		}
+	case ProviderAnthropic:
+		if c.Model == "" {
+			c.Model = defaultAnthropicModel
+		}
+		if c.APIKeyEnv == "" {
+			c.APIKeyEnv = "ANTHROPIC_API_KEY"
+		}
+	case ProviderOllama:
+		if c.Model == "" {
+			c.Model = defaultOllamaModel
+		}
+		if c.BaseURL == "" {
+			c.BaseURL = defaultOllamaBaseURL
+		}
+	}
+
+	if c.MaxRetries == nil {
+		maxRetries := defaultMaxRetries
+		c.MaxRetries = &maxRetries
+	}
+	if c.RetryBackoff == nil {
+		c.RetryBackoff = &metav1.Duration{Duration: defaultRetryBackoff}
+	}
+	if c.MaxRetryBackoff == nil {
+		c.MaxRetryBackoff = &metav1.Duration{Duration: defaultMaxRetryBackoff}
+	}
+	if c.Fallback != nil {
+		fallback := c.Fallback.WithDefaults()
+		c.Fallback = &fallback
+	}
+
+	return c
+}
+
+// name identifies the configured model in logs.
+func (c Config) name() string {
+	return fmt.Sprintf("%s/%s", c.Provider, c.Model)
+}
+
+// defaultsModel is a model that applies default call options to every call.
+// Options passed to a call take precedence over the defaults.
+type defaultsModel struct {
+	llms.Model
+	defaults []llms.CallOption
+}
+
+// GenerateContent generates content with the default options, overridden by
+// the given options.
+func (m *defaultsModel) GenerateContent(ctx context.Context, messages []llms.MessageContent,
+	options ...llms.CallOption) (*llms.ContentResponse, error) {
+	return m.Model.GenerateContent(ctx, messages, append(append([]llms.CallOption{}, m.defaults...), options...)...)
+}
+
+// Call generates a completion of the prompt with the default options,
+// overridden by the given options.
+func (m *defaultsModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
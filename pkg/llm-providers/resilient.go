@@ -0,0 +1,221 @@
+package llm_providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"github.com/kube-agent/kuery/pkg/metrics"
+	"github.com/kube-agent/kuery/pkg/tracing"
+	"github.com/kube-agent/kuery/pkg/usage"
+)
+
+const (
+	defaultMaxRetries      = 3
+	defaultRetryBackoff    = time.Second
+	defaultMaxRetryBackoff = 30 * time.Second
+)
+
+// transientStatusPattern matches the errors the provider clients return for
+// rate limiting (429) and server-side (5xx, e.g. Anthropic's 529 overloaded)
+// responses.
+var transientStatusPattern = regexp.MustCompile(`status code: (429|5\d\d)\b`)
+
+// IsTransient returns whether err is a provider error worth retrying: rate
+// limiting, server-side errors, timeouts and dropped connections.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	return transientStatusPattern.MatchString(err.Error())
+}
+
+// ResilientModel is a model that retries calls failing with a transient error
+// with exponential backoff, and then optionally falls back to a secondary
+// model. Both models get the original messages and options.
+type ResilientModel struct {
+	primary      llms.Model
+	primaryName  string
+	fallback     llms.Model
+	fallbackName string
+	maxRetries   int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+}
+
+var _ llms.Model = &ResilientModel{}
+
+// NewResilientModel creates a ResilientModel retrying calls to the given
+// model up to maxRetries times, starting with a delay of backoff and doubling
+// it up to maxBackoff. The name identifies the model in logs.
+func NewResilientModel(model llms.Model, name string, maxRetries int,
+	backoff, maxBackoff time.Duration) *ResilientModel {
+	return &ResilientModel{
+		primary:     model,
+		primaryName: name,
+		maxRetries:  maxRetries,
+		backoff:     backoff,
+		maxBackoff:  maxBackoff,
+	}
+}
+
+// WithFallback sets the model to fall back to when the primary model keeps
+// failing with transient errors. It is retried the same way.
+func (m *ResilientModel) WithFallback(model llms.Model, name string) *ResilientModel {
+	m.fallback = model
+	m.fallbackName = name
+	return m
+}
+
+// GenerateContent generates content with the primary model, or the fallback
+// model if the primary one keeps failing with transient errors.
+func (m *ResilientModel) GenerateContent(ctx context.Context, messages []llms.MessageContent,
+	options ...llms.CallOption) (*llms.ContentResponse, error) {
+	response, err := m.generateWithRetries(ctx, m.primary, m.primaryName, messages, options)
+	if err == nil || m.fallback == nil || !IsTransient(err) || ctx.Err() != nil {
+		return response, err
+	}
+
+	klog.FromContext(ctx).Info("Falling back to the secondary LLM", "primary", m.primaryName,
+		"fallback", m.fallbackName, "error", err.Error())
+	trace.SpanFromContext(ctx).AddEvent("LLM fallback", trace.WithAttributes(
+		attribute.String("primary", m.primaryName),
+		attribute.String("fallback", m.fallbackName),
+		attribute.String("error", err.Error()),
+	))
+
+	response, fallbackErr := m.generateWithRetries(ctx, m.fallback, m.fallbackName, messages, options)
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("fallback LLM %s failed: %w (primary LLM %s failed: %v)", m.fallbackName,
+			fallbackErr, m.primaryName, err)
+	}
+
+	return response, nil
+}
+
+// Call generates a completion of the prompt, retrying and falling back like
+// GenerateContent.
+func (m *ResilientModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// generateWithRetries calls the model until it succeeds, fails with a
+// non-transient error, or the retries are exhausted.
+func (m *ResilientModel) generateWithRetries(ctx context.Context, model llms.Model, name string,
+	messages []llms.MessageContent, options []llms.CallOption) (*llms.ContentResponse, error) {
+	logger := klog.FromContext(ctx)
+	backoff := m.backoff
+
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		response, err := m.generate(ctx, model, name, attempt, messages, options)
+		observeCall(name, time.Since(start), response, err)
+		if err == nil {
+			annotateModel(response, name)
+			return response, nil
+		}
+		if !IsTransient(err) || attempt > m.maxRetries {
+			return nil, err
+		}
+
+		delay := wait.Jitter(backoff, 0.2)
+		backoff = min(2*backoff, m.maxBackoff)
+
+		logger.Info("LLM call failed with a transient error, retrying", "llm", name, "attempt", attempt,
+			"backoff", delay, "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// generate makes a single call to the model with the given
+// provider-qualified name, in a span of its own.
+func (m *ResilientModel) generate(ctx context.Context, model llms.Model, name string, attempt int,
+	messages []llms.MessageContent, options []llms.CallOption) (_ *llms.ContentResponse, err error) {
+	provider, modelName, _ := strings.Cut(name, "/")
+
+	ctx, span := tracing.Tracer().Start(ctx, "LLM "+name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.LLMProviderKey.String(provider),
+			tracing.LLMModelKey.String(modelName),
+			tracing.LLMAttemptKey.Int(attempt),
+		))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	response, err := model.GenerateContent(ctx, messages, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	callUsage, _ := usage.FromResponse(response)
+	span.SetAttributes(
+		tracing.LLMPromptTokensKey.Int(callUsage.PromptTokens),
+		tracing.LLMCompletionTokensKey.Int(callUsage.CompletionTokens),
+	)
+
+	return response, nil
+}
+
+// annotateModel records the model that generated the response in the
+// GenerationInfo of its choices, so that usage is priced by the model that
+// served the call.
+func annotateModel(response *llms.ContentResponse, name string) {
+	if response == nil {
+		return
+	}
+
+	for _, choice := range response.Choices {
+		if choice == nil {
+			continue
+		}
+
+		if choice.GenerationInfo == nil {
+			choice.GenerationInfo = map[string]any{}
+		}
+		choice.GenerationInfo[usage.ModelInfoKey] = name
+	}
+}
+
+// observeCall records the metrics of a call to the model with the given
+// provider-qualified name.
+func observeCall(name string, duration time.Duration, response *llms.ContentResponse, err error) {
+	provider, model, _ := strings.Cut(name, "/")
+
+	outcome := metrics.LLMCallSuccess
+	if err != nil {
+		outcome = metrics.LLMCallError
+		if IsTransient(err) {
+			outcome = metrics.LLMCallTransientError
+		}
+	}
+
+	metrics.LLMCalls.WithLabelValues(provider, model, outcome).Inc()
+	metrics.LLMCallDuration.WithLabelValues(provider, model).Observe(duration.Seconds())
+
+	if err == nil {
+		callUsage, _ := usage.FromResponse(response)
+		metrics.LLMTokens.WithLabelValues(provider, model, "prompt").Add(float64(callUsage.PromptTokens))
+		metrics.LLMTokens.WithLabelValues(provider, model, "completion").Add(float64(callUsage.CompletionTokens))
+	}
+}
@@ -0,0 +1,155 @@
+package llm_providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// optionsRecordingModel is a model that records the options of its calls
+// before passing them on.
+type optionsRecordingModel struct {
+	llms.Model
+	options []llms.CallOptions
+}
+
+func (m *optionsRecordingModel) GenerateContent(ctx context.Context, messages []llms.MessageContent,
+	options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	m.options = append(m.options, opts)
+
+	return m.Model.GenerateContent(ctx, messages, options...)
+}
+
+func TestIsTransient(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("API returned unexpected status code: 429: rate limit exceeded"), true},
+		{errors.New("API returned unexpected status code: 529: overloaded"), true},
+		{errors.New("API returned unexpected status code: 500: internal error"), true},
+		{errors.New("API returned unexpected status code: 503"), true},
+		{fmt.Errorf("openai: %w", &url.Error{Op: "Post", URL: "https://api", Err: io.EOF}), true},
+		{fmt.Errorf("reading response: %w", io.ErrUnexpectedEOF), true},
+		{fmt.Errorf("calling the LLM: %w", context.DeadlineExceeded), true},
+		{errors.New("API returned unexpected status code: 400: invalid request"), false},
+		{errors.New("API returned unexpected status code: 401: invalid api key"), false},
+		{errors.New("API returned unexpected status code: 5000"), false},
+		{context.Canceled, false},
+		{nil, false},
+	} {
+		if got := IsTransient(tc.err); got != tc.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestResilientModelRetriesTransientErrors(t *testing.T) {
+	overloaded := ScriptedResponse{Err: errors.New("API returned unexpected status code: 529: overloaded")}
+	primary := NewScriptedModel(overloaded, overloaded, TextResponse("done"))
+	model := NewResilientModel(primary, "anthropic/claude", 2, 0, 0)
+
+	text, err := model.Call(context.Background(), "hello")
+	if err != nil || text != "done" {
+		t.Errorf("Call() = %q, %v, want %q", text, err, "done")
+	}
+
+	if calls := len(primary.Requests()); calls != 3 {
+		t.Errorf("the model was called %d times, want 3", calls)
+	}
+}
+
+func TestResilientModelDoesNotRetryPermanentErrors(t *testing.T) {
+	invalid := errors.New("API returned unexpected status code: 400: invalid request")
+	primary := NewScriptedModel(ScriptedResponse{Err: invalid}, TextResponse("unreachable"))
+	fallback := NewScriptedModel(TextResponse("unreachable"))
+	model := NewResilientModel(primary, "openai/gpt-4o", 3, 0, 0).WithFallback(fallback, "anthropic/claude")
+
+	if _, err := model.Call(context.Background(), "hello"); !errors.Is(err, invalid) {
+		t.Errorf("Call() error = %v, want %v", err, invalid)
+	}
+
+	if calls, fallbackCalls := len(primary.Requests()), len(fallback.Requests()); calls != 1 || fallbackCalls != 0 {
+		t.Errorf("the models were called %d and %d times, want once and never", calls, fallbackCalls)
+	}
+}
+
+func TestResilientModelStopsAfterMaxRetries(t *testing.T) {
+	limited := errors.New("API returned unexpected status code: 429: rate limited")
+	primary := NewScriptedModel()
+	for range 5 {
+		primary.WithResponses(ScriptedResponse{Err: limited})
+	}
+	model := NewResilientModel(primary, "openai/gpt-4o", 2, 0, 0)
+
+	if _, err := model.Call(context.Background(), "hello"); !errors.Is(err, limited) {
+		t.Errorf("Call() error = %v, want %v", err, limited)
+	}
+
+	if calls := len(primary.Requests()); calls != 3 {
+		t.Errorf("the model was called %d times, want 3 (the call and 2 retries)", calls)
+	}
+}
+
+func TestResilientModelFallsBackWithOriginalRequest(t *testing.T) {
+	limited := ScriptedResponse{Err: errors.New("API returned unexpected status code: 429: rate limited")}
+	primary := &optionsRecordingModel{Model: NewScriptedModel(limited, limited)}
+	fallback := &optionsRecordingModel{Model: NewScriptedModel(TextResponse("from the fallback"))}
+	model := NewResilientModel(primary, "openai/gpt-4o", 1, 0, 0).WithFallback(fallback, "anthropic/claude")
+
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "you are Kuery"),
+		llms.TextParts(llms.ChatMessageTypeHuman, "why is web crashing?"),
+	}
+	tools := []llms.Tool{{Type: "function", Function: &llms.FunctionDefinition{Name: "K8sLogs"}}}
+
+	response, err := model.GenerateContent(context.Background(), messages, llms.WithTools(tools),
+		llms.WithTemperature(0.2))
+	if err != nil || response.Choices[0].Content != "from the fallback" {
+		t.Fatalf("GenerateContent() = %v, %v, want the response of the fallback", response, err)
+	}
+
+	if requests := fallback.Model.(*ScriptedModel).Requests(); !reflect.DeepEqual(requests[0], messages) {
+		t.Errorf("the fallback was called with %v, want the original messages", requests[0])
+	}
+
+	if len(primary.options) != 2 || !reflect.DeepEqual(fallback.options[0], primary.options[0]) ||
+		fallback.options[0].Temperature != 0.2 || len(fallback.options[0].Tools) != 1 {
+		t.Errorf("the fallback was called with options %+v, want the original ones", fallback.options[0])
+	}
+}
+
+func TestResilientModelCancellationAbortsBackoff(t *testing.T) {
+	limited := ScriptedResponse{Err: errors.New("API returned unexpected status code: 429: rate limited")}
+	primary := NewScriptedModel(limited, limited)
+	fallback := NewScriptedModel(TextResponse("unreachable"))
+	model := NewResilientModel(primary, "openai/gpt-4o", 1, time.Hour, time.Hour).
+		WithFallback(fallback, "anthropic/claude")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := model.Call(ctx, "hello"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Call() error = %v, want %v", err, context.Canceled)
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Call() returned after %s, want the backoff to be aborted", elapsed)
+	}
+
+	if calls, fallbackCalls := len(primary.Requests()), len(fallback.Requests()); calls != 1 || fallbackCalls != 0 {
+		t.Errorf("the models were called %d and %d times, want once and never", calls, fallbackCalls)
+	}
+}
@@ -0,0 +1,110 @@
+package llm_providers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+var _ llms.Model = &ScriptedModel{}
+
+// ScriptedResponse is a response a ScriptedModel plays back.
+type ScriptedResponse struct {
+	// Response is the response returned, unless Err is set.
+	Response *llms.ContentResponse
+	// Err is the error returned instead of a response, e.g. to simulate
+	// provider failures.
+	Err error
+}
+
+// TextResponse returns a scripted response with the given text content.
+func TextResponse(content string) ScriptedResponse {
+	return ScriptedResponse{
+		Response: &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: content, StopReason: "stop"}}},
+	}
+}
+
+// ToolCallsResponse returns a scripted response requesting the given tool
+// calls, with IDs assigned in order.
+func ToolCallsResponse(calls ...llms.FunctionCall) ScriptedResponse {
+	toolCalls := make([]llms.ToolCall, 0, len(calls))
+	for idx, call := range calls {
+		toolCalls = append(toolCalls, llms.ToolCall{
+			ID:           fmt.Sprintf("call_%d", idx+1),
+			Type:         "function",
+			FunctionCall: &llms.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+		})
+	}
+
+	return ScriptedResponse{
+		Response: &llms.ContentResponse{Choices: []*llms.ContentChoice{{ToolCalls: toolCalls, StopReason: "tool_calls"}}},
+	}
+}
+
+// ScriptedModel is a fake model that plays back scripted responses in order,
+// for deterministic runs without a provider. It records the messages it is
+// called with for later inspection.
+// A ScriptedModel is safe for concurrent use.
+type ScriptedModel struct {
+	mu        sync.Mutex
+	responses []ScriptedResponse
+	requests  [][]llms.MessageContent
+}
+
+// NewScriptedModel creates a new ScriptedModel playing back the given
+// responses.
+func NewScriptedModel(responses ...ScriptedResponse) *ScriptedModel {
+	return &ScriptedModel{
+		responses: responses,
+	}
+}
+
+// WithResponses appends responses to the script.
+func (m *ScriptedModel) WithResponses(responses ...ScriptedResponse) *ScriptedModel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.responses = append(m.responses, responses...)
+	return m
+}
+
+// GenerateContent returns the next scripted response, or an error if the
+// script is exhausted.
+func (m *ScriptedModel) GenerateContent(_ context.Context, messages []llms.MessageContent,
+	_ ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests = append(m.requests, append([]llms.MessageContent{}, messages...))
+	if len(m.responses) == 0 {
+		return nil, fmt.Errorf("scripted model exhausted after %d calls", len(m.requests)-1)
+	}
+
+	next := m.responses[0]
+	m.responses = m.responses[1:]
+
+	return next.Response, next.Err
+}
+
+// Call returns the text of the next scripted response.
+func (m *ScriptedModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// Requests returns the messages of every call made to the model, in order.
+func (m *ScriptedModel) Requests() [][]llms.MessageContent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([][]llms.MessageContent{}, m.requests...)
+}
+
+// Remaining returns the number of responses left in the script.
+func (m *ScriptedModel) Remaining() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.responses)
+}
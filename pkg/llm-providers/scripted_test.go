@@ -0,0 +1,56 @@
+package llm_providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestScriptedModelPlaysResponsesInOrder(t *testing.T) {
+	failure := errors.New("rate limited")
+	model := NewScriptedModel(
+		ToolCallsResponse(llms.FunctionCall{Name: "K8sDynamicClient", Arguments: `{"operation":"LIST"}`}),
+		ScriptedResponse{Err: failure},
+	).WithResponses(TextResponse("done"))
+
+	ctx := context.Background()
+	prompt := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "list pods")}
+
+	response, err := model.GenerateContent(ctx, prompt)
+	if err != nil {
+		t.Fatalf("GenerateContent() error = %v", err)
+	}
+
+	toolCalls := response.Choices[0].ToolCalls
+	if len(toolCalls) != 1 || toolCalls[0].ID != "call_1" || toolCalls[0].FunctionCall.Name != "K8sDynamicClient" {
+		t.Errorf("GenerateContent() tool calls = %+v, want a single call_1 to K8sDynamicClient", toolCalls)
+	}
+
+	if _, err := model.GenerateContent(ctx, prompt); !errors.Is(err, failure) {
+		t.Errorf("GenerateContent() error = %v, want %v", err, failure)
+	}
+
+	text, err := model.Call(ctx, "and now?")
+	if err != nil || text != "done" {
+		t.Errorf("Call() = %q, %v, want %q", text, err, "done")
+	}
+
+	if model.Remaining() != 0 {
+		t.Errorf("Remaining() = %d, want 0", model.Remaining())
+	}
+
+	if _, err := model.GenerateContent(ctx, prompt); err == nil {
+		t.Error("GenerateContent() of an exhausted script succeeded")
+	}
+
+	requests := model.Requests()
+	if len(requests) != 4 {
+		t.Fatalf("Requests() = %d requests, want 4", len(requests))
+	}
+
+	if part := requests[2][0].Parts[0].(llms.TextContent); part.Text != "and now?" {
+		t.Errorf("Requests()[2] = %q, want %q", part.Text, "and now?")
+	}
+}
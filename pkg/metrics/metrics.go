@@ -0,0 +1,88 @@
+// Package metrics defines the Prometheus metrics of Kuery. The metrics are
+// registered in the controller-runtime metrics registry, and are therefore
+// served by the controller-runtime metrics server.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Outcomes of LLM calls.
+const (
+	LLMCallSuccess        = "success"
+	LLMCallTransientError = "transient_error"
+	LLMCallError          = "error"
+)
+
+// Outcomes of tool calls.
+const (
+	ToolCallSuccess             = "success"
+	ToolCallFailure             = "failure"
+	ToolCallNotFound            = "not_found"
+	ToolCallBlockedByRetries    = "blocked_by_retries"
+	ToolCallBlockedByReadOnly   = "blocked_by_read_only"
+	ToolCallDeniedByPolicy      = "denied_by_policy"
+	ToolCallRejectedByPreflight = "rejected_by_preflight"
+	ToolCallBlockedByApproval   = "blocked_by_approval"
+)
+
+// Decisions of approval requests.
+const (
+	ApprovalGranted = "granted"
+	ApprovalDenied  = "denied"
+)
+
+// Phases of KueryFlow runs.
+const (
+	KueryFlowRunStarted   = "Started"
+	KueryFlowRunSucceeded = "Succeeded"
+	KueryFlowRunFailed    = "Failed"
+)
+
+var (
+	// LLMCalls counts the calls to LLM providers, by provider, model and
+	// outcome. Every retry is a call.
+	LLMCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kuery_llm_calls_total",
+		Help: "Number of calls to LLM providers, by provider, model and outcome.",
+	}, []string{"provider", "model", "outcome"})
+
+	// LLMCallDuration observes the latency of the calls to LLM providers, by
+	// provider and model.
+	LLMCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kuery_llm_call_duration_seconds",
+		Help:    "Latency of calls to LLM providers, by provider and model.",
+		Buckets: prometheus.ExponentialBuckets(0.25, 2, 10), // 0.25s to ~2m
+	}, []string{"provider", "model"})
+
+	// LLMTokens counts the tokens consumed by LLM calls, by provider, model
+	// and type (prompt or completion).
+	LLMTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kuery_llm_tokens_total",
+		Help: "Number of tokens consumed by LLM calls, by provider, model and type.",
+	}, []string{"provider", "model", "type"})
+
+	// ToolCalls counts the tool calls made by the LLM, by tool and outcome.
+	ToolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kuery_tool_calls_total",
+		Help: "Number of tool calls, by tool and outcome.",
+	}, []string{"tool", "outcome"})
+
+	// Approvals counts the decisions of users on tool-call approval requests,
+	// by tool and decision.
+	Approvals = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kuery_tool_approvals_total",
+		Help: "Number of tool-call approval decisions, by tool and decision.",
+	}, []string{"tool", "decision"})
+
+	// KueryFlowRuns counts the KueryFlow runs by phase.
+	KueryFlowRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kuery_kueryflow_runs_total",
+		Help: "Number of KueryFlow runs that reached each phase.",
+	}, []string{"phase"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(LLMCalls, LLMCallDuration, LLMTokens, ToolCalls, Approvals, KueryFlowRuns)
+}
@@ -0,0 +1,130 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultMaxStringLength is the length beyond which string fields are
+	// truncated.
+	DefaultMaxStringLength = 512
+	// DefaultMaxListItems is the number of items beyond which lists are
+	// summarized.
+	DefaultMaxListItems = 20
+)
+
+// noisyAnnotations are annotations that are of no use to the model, yet are
+// often large.
+var noisyAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"deployment.kubernetes.io/revision-history",
+}
+
+// Options configures the rendering of objects.
+type Options struct {
+	// MaxStringLength is the length beyond which string fields are truncated.
+	MaxStringLength int
+	// MaxListItems is the number of items beyond which lists are summarized.
+	MaxListItems int
+	// Expand lists the paths of fields (e.g. ".data.config" or
+	// ".spec.containers[0]") that are rendered in full.
+	Expand []string
+}
+
+// DefaultOptions returns the default rendering options, expanding the given
+// paths.
+func DefaultOptions(expand ...string) Options {
+	return Options{
+		MaxStringLength: DefaultMaxStringLength,
+		MaxListItems:    DefaultMaxListItems,
+		Expand:          expand,
+	}
+}
+
+// Object renders the object as YAML for the model to read.
+// Noisy metadata (managedFields, last-applied-configuration) is stripped, long
+// strings are truncated and long lists are summarized. Truncated fields are
+// marked with their path, which can be passed back in Options.Expand.
+func Object(obj *unstructured.Unstructured, opts Options) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+
+	obj = obj.DeepCopy()
+	obj.SetManagedFields(nil)
+	obj.SetSelfLink("")
+
+	annotations := obj.GetAnnotations()
+	for _, annotation := range noisyAnnotations {
+		delete(annotations, annotation)
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+
+	data, err := yaml.Marshal(opts.shorten(obj.Object, ""))
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal object: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// shorten returns a copy of value with long strings truncated and long lists
+// summarized, unless under an expanded path.
+func (o Options) shorten(value any, path string) any {
+	if o.expanded(path) {
+		return value
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		shortened := make(map[string]any, len(typed))
+		for key, field := range typed {
+			shortened[key] = o.shorten(field, path+"."+key)
+		}
+
+		return shortened
+	case []any:
+		items := typed
+		if o.MaxListItems > 0 && len(items) > o.MaxListItems {
+			items = items[:o.MaxListItems]
+		}
+
+		shortened := make([]any, 0, len(items)+1)
+		for idx, item := range items {
+			shortened = append(shortened, o.shorten(item, fmt.Sprintf("%s[%d]", path, idx)))
+		}
+
+		if len(items) < len(typed) {
+			shortened = append(shortened, fmt.Sprintf("...[%d more items, expand %s to see all]",
+				len(typed)-len(items), path))
+		}
+
+		return shortened
+	case string:
+		if o.MaxStringLength > 0 && len(typed) > o.MaxStringLength {
+			return fmt.Sprintf("%s...[truncated %d characters, expand %s to see all]",
+				strings.ToValidUTF8(typed[:o.MaxStringLength], ""), len(typed)-o.MaxStringLength, path)
+		}
+	}
+
+	return value
+}
+
+// expanded returns whether the path is, or is under, an expanded path.
+func (o Options) expanded(path string) bool {
+	for _, expand := range o.Expand {
+		expand = "." + strings.TrimPrefix(expand, ".")
+		if path == expand || strings.HasPrefix(path, expand+".") || strings.HasPrefix(path, expand+"[") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,117 @@
+package render
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// testObject returns a ConfigMap with a long config, a long list of hosts,
+// and noisy metadata.
+func testObject() *unstructured.Unstructured {
+	hosts := make([]any, 0, 25)
+	for range 25 {
+		hosts = append(hosts, "host")
+	}
+
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]any{
+			"name":          "app",
+			"namespace":     "default",
+			"managedFields": []any{map[string]any{"manager": "kubectl"}},
+			"annotations": map[string]any{
+				"kubectl.kubernetes.io/last-applied-configuration": `{"apiVersion":"v1"}`,
+				"team": "web",
+			},
+		},
+		"data": map[string]any{
+			"config": strings.Repeat("a", 600),
+			"short":  "b",
+			"hosts":  hosts,
+		},
+	}}
+}
+
+func TestObjectTruncatesLongFields(t *testing.T) {
+	obj := testObject()
+
+	rendered, err := Object(obj, DefaultOptions())
+	if err != nil {
+		t.Fatalf("Object() error = %v", err)
+	}
+
+	var parsed struct {
+		Data struct {
+			Config string `json:"config"`
+		} `json:"data"`
+	}
+	if err := yaml.Unmarshal([]byte(rendered), &parsed); err != nil {
+		t.Fatalf("Object() rendered invalid YAML: %v", err)
+	}
+	if want := strings.Repeat("a", DefaultMaxStringLength) +
+		"...[truncated 88 characters, expand .data.config to see all]"; parsed.Data.Config != want {
+		t.Errorf("rendered config = %q, want %q", parsed.Data.Config, want)
+	}
+
+	for _, want := range []string{
+		"...[5 more items, expand .data.hosts to see all]",
+		"short: b",
+		"team: web",
+	} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("Object() =\n%s\nwant it to contain %q", rendered, want)
+		}
+	}
+
+	for _, unwanted := range []string{"managedFields", "last-applied-configuration"} {
+		if strings.Contains(rendered, unwanted) {
+			t.Errorf("Object() =\n%s\nwant %s stripped", rendered, unwanted)
+		}
+	}
+
+	if config, _, _ := unstructured.NestedString(obj.Object, "data", "config"); len(config) != 600 ||
+		len(obj.GetManagedFields()) != 1 {
+		t.Error("Object() modified the object it rendered")
+	}
+}
+
+func TestObjectExpandsPaths(t *testing.T) {
+	for _, expand := range [][]string{{".data.config", ".data.hosts"}, {"data"}} {
+		rendered, err := Object(testObject(), DefaultOptions(expand...))
+		if err != nil {
+			t.Fatalf("Object() error = %v", err)
+		}
+
+		if strings.Contains(rendered, "expand") || !strings.Contains(rendered, strings.Repeat("a", 600)) ||
+			strings.Count(rendered, "- host") != 25 {
+			t.Errorf("Object() expanding %v =\n%s\nwant the expanded fields in full", expand, rendered)
+		}
+	}
+
+	rendered, err := Object(testObject(), DefaultOptions(".data.hosts[0]"))
+	if err != nil || !strings.Contains(rendered, "expand .data.hosts to see all") {
+		t.Errorf("Object() expanding an item = %q, %v, want the list summarized still", rendered, err)
+	}
+}
+
+func TestObjectTruncatesMultiByteStrings(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"data": map[string]any{"greeting": strings.Repeat("é", 10)}, // 2 bytes per character
+	}}
+
+	rendered, err := Object(obj, Options{MaxStringLength: 5})
+	if err != nil || !utf8.ValidString(rendered) || !strings.Contains(rendered, "éé...[truncated 15 characters") {
+		t.Errorf("Object() = %q, %v, want the string cut at a character boundary", rendered, err)
+	}
+}
+
+func TestObjectOfNil(t *testing.T) {
+	if rendered, err := Object(nil, DefaultOptions()); rendered != "" || err != nil {
+		t.Errorf("Object(nil) = %q, %v, want nothing", rendered, err)
+	}
+}
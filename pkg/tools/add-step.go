@@ -12,7 +12,10 @@ import (
 	"github.com/kube-agent/kuery/pkg/flows/steps"
 )
 
-var _ api.Tool = &AddStepTool{}
+var (
+	_ api.Tool    = &AddStepTool{}
+	_ api.Mutator = &AddStepTool{}
+)
 
 // AddStepTool is a tool that can add a step of planning to a given chain.
 type AddStepTool struct {
@@ -99,3 +102,6 @@ func (t *AddStepTool) RequiresExplaining() bool {
 // RequiresApproval returns whether the tool requires approval before
 // execution.
 func (t *AddStepTool) RequiresApproval() bool { return false }
+
+// Mutates returns whether the tool call may modify the cluster.
+func (t *AddStepTool) Mutates(_ *llms.ToolCall) bool { return false }
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kube-agent/kuery/pkg/metrics"
+)
+
+// AuditRecord records a tool call that may affect a cluster.
+type AuditRecord struct {
+	// Time is when the tool call completed.
+	Time time.Time `json:"time"`
+	// SessionID is the ID of the session that made the call.
+	SessionID string `json:"sessionID,omitempty"`
+	// User is the user the session acts as, empty if Kuery's own identity.
+	User string `json:"user,omitempty"`
+	// Cluster is the cluster the call targeted.
+	Cluster string `json:"cluster,omitempty"`
+	// Tool is the name of the tool.
+	Tool string `json:"tool"`
+	// ToolCallID is the ID the LLM assigned to the call.
+	ToolCallID string `json:"toolCallID,omitempty"`
+	// CallID is the ID Kuery assigned to the call (see GetToolCall).
+	CallID int `json:"callID"`
+	// Arguments are the arguments of the call, with secrets redacted.
+	Arguments string `json:"arguments"`
+	// Targets are the objects the call operates on, as resolved by the tool.
+	Targets []PolicyTarget `json:"targets,omitempty"`
+	// Policy is the action the policy decided on for the call, empty if the
+	// call was blocked before the policy was evaluated.
+	Policy PolicyAction `json:"policy,omitempty"`
+	// PolicyReason is the reason of the policy decision, if any.
+	PolicyReason string `json:"policyReason,omitempty"`
+	// Approval is the approval of the call, if it was approved.
+	Approval *AuditApproval `json:"approval,omitempty"`
+	// Outcome is the outcome of the call (see the metrics.ToolCall*
+	// outcomes).
+	Outcome string `json:"outcome"`
+}
+
+// AuditApproval records the approval of a tool call.
+type AuditApproval struct {
+	// Time is when the call was approved.
+	Time time.Time `json:"time"`
+	// Input is the input the call was approved by, e.g. the answer of the
+	// user to the approval request.
+	Input string `json:"input"`
+}
+
+// AuditSink receives the audit records of tool calls.
+type AuditSink interface {
+	// Write writes the record to the sink.
+	Write(ctx context.Context, record AuditRecord) error
+}
+
+// MultiAuditSink writes audit records to all of its sinks.
+type MultiAuditSink []AuditSink
+
+// Write writes the record to every sink, and returns the errors of those that
+// failed.
+func (s MultiAuditSink) Write(ctx context.Context, record AuditRecord) error {
+	var errs []error
+	for _, sink := range s {
+		if err := sink.Write(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// JSONLAuditSink appends audit records to a file, one JSON object per line.
+type JSONLAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewJSONLAuditSink creates a JSONLAuditSink appending to the given file,
+// which is created if missing.
+func NewJSONLAuditSink(path string) (*JSONLAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &JSONLAuditSink{file: file}, nil
+}
+
+// Write appends the record to the file, and syncs it to disk.
+func (s *JSONLAuditSink) Write(_ context.Context, record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+
+	return s.file.Sync()
+}
+
+// Close closes the file.
+func (s *JSONLAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// EventAuditSink records audit records as Kubernetes Events on the objects
+// the tool calls affected, in the cluster they targeted: one Event per object,
+// e.g. per applied document. Targets whose object cannot be determined are
+// recorded on their namespace, if any.
+type EventAuditSink struct {
+	clientFor func(cluster string) (kubernetes.Interface, error)
+}
+
+// NewEventAuditSink creates an EventAuditSink creating Events with the client
+// of each cluster.
+func NewEventAuditSink(clientFor func(cluster string) (kubernetes.Interface, error)) *EventAuditSink {
+	return &EventAuditSink{clientFor: clientFor}
+}
+
+// Write creates an Event for the record on every object it affected.
+func (s *EventAuditSink) Write(ctx context.Context, record AuditRecord) error {
+	involved := involvedObjects(record.Targets)
+	if len(involved) == 0 {
+		return nil // no object to record the event on
+	}
+
+	client, err := s.clientFor(record.Cluster)
+	if err != nil {
+		return fmt.Errorf("failed to get client of cluster %s: %w", record.Cluster, err)
+	}
+
+	eventType := corev1.EventTypeNormal
+	if record.Outcome != metrics.ToolCallSuccess {
+		eventType = corev1.EventTypeWarning
+	}
+
+	actor := record.User
+	if actor == "" {
+		actor = "kuery"
+	}
+
+	now := metav1.NewTime(record.Time)
+	message := truncate(fmt.Sprintf("%s called %s (session %s, outcome %s): %s", actor, record.Tool,
+		record.SessionID, record.Outcome, record.Arguments), maxEventMessageLength)
+
+	var errs []error
+	for _, object := range involved {
+		namespace := object.Namespace
+		if object.Kind == "Namespace" {
+			namespace = object.Name
+		}
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+
+		event := &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "kuery-audit-",
+				Namespace:    namespace,
+			},
+			InvolvedObject: object,
+			Reason:         "KueryToolCall",
+			Message:        message,
+			Source:         corev1.EventSource{Component: "kuery"},
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+			Count:          1,
+			Type:           eventType,
+		}
+
+		if _, err := client.CoreV1().Events(namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to create audit event on %s %s: %w", object.Kind,
+				object.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// involvedObjects returns the objects the Events of the targets are recorded
+// on: the targets of known kind and name, and otherwise their namespace, each
+// once.
+func involvedObjects(targets []PolicyTarget) []corev1.ObjectReference {
+	var involved []corev1.ObjectReference
+	seen := make(map[corev1.ObjectReference]bool)
+
+	for _, target := range targets {
+		object := corev1.ObjectReference{
+			APIVersion: metav1.GroupVersion{Group: target.Group, Version: target.Version}.String(),
+			Kind:       target.Kind,
+			Namespace:  target.Namespace,
+			Name:       target.Name,
+		}
+
+		if object.Kind == "" || object.Name == "" || target.Version == "" {
+			if target.Namespace == "" {
+				continue
+			}
+
+			object = corev1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: target.Namespace}
+		}
+
+		if !seen[object] {
+			seen[object] = true
+			involved = append(involved, object)
+		}
+	}
+
+	return involved
+}
+
+// maxEventMessageLength is the maximum length of the message of an audit
+// Event, like the Events recorded by client-go.
+const maxEventMessageLength = 1024
+
+// truncate truncates s to at most n bytes, marking the truncation.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	return s[:n-3] + "..."
+}
+
+// WebhookAuditSink posts audit records as JSON to an HTTP endpoint.
+type WebhookAuditSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhookAuditSink creates a WebhookAuditSink posting to the given URL.
+func NewWebhookAuditSink(url string) *WebhookAuditSink {
+	return &WebhookAuditSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WithHeader sets a header of the requests, e.g. Authorization.
+func (s *WebhookAuditSink) WithHeader(key, value string) *WebhookAuditSink {
+	if s.headers == nil {
+		s.headers = make(map[string]string)
+	}
+
+	s.headers[key] = value
+	return s
+}
+
+// Write posts the record to the endpoint.
+func (s *WebhookAuditSink) Write(ctx context.Context, record AuditRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create audit webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post audit record: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
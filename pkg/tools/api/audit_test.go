@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/kube-agent/kuery/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// recordingAuditSink is an AuditSink that keeps the records written to it.
+type recordingAuditSink struct {
+	records []AuditRecord
+}
+
+func (s *recordingAuditSink) Write(_ context.Context, record AuditRecord) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestEventAuditSinkRecordsEveryTarget(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	created := 0
+	client.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		event := action.(k8stesting.CreateAction).GetObject().(*corev1.Event)
+		created++
+		event.Name = fmt.Sprintf("%s%d", event.GenerateName, created) // the fake does not generate names
+		return false, nil, nil
+	})
+	sink := NewEventAuditSink(func(string) (kubernetes.Interface, error) { return client, nil })
+
+	record := AuditRecord{
+		Tool:    "K8sApplyManifests",
+		Outcome: metrics.ToolCallSuccess,
+		Targets: []PolicyTarget{
+			{Operation: "APPLY", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "default",
+				Name: "web", Kind: "Deployment"},
+			{Operation: "APPLY", Version: "v1", Resource: "services", Namespace: "default", Name: "web",
+				Kind: "Service"},
+			{Operation: "APPLY", Version: "v1", Resource: "configmaps", Namespace: "prod"},
+			{Operation: "APPLY", Version: "v1", Resource: "secrets", Namespace: "prod"},
+		},
+	}
+	if err := sink.Write(context.Background(), record); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	events, err := client.CoreV1().Events(metav1.NamespaceAll).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list events: %v", err)
+	}
+
+	want := map[string]string{
+		"apps/v1 Deployment default/web": "default",
+		"v1 Service default/web":         "default",
+		"v1 Namespace /prod":             "prod", // once for both targets without a name
+	}
+	if len(events.Items) != len(want) {
+		t.Fatalf("Write() created %d events, want %d", len(events.Items), len(want))
+	}
+
+	for _, event := range events.Items {
+		object := event.InvolvedObject
+		key := object.APIVersion + " " + object.Kind + " " + object.Namespace + "/" + object.Name
+		if namespace, ok := want[key]; !ok || event.Namespace != namespace {
+			t.Errorf("unexpected event on %s in namespace %s", key, event.Namespace)
+		}
+	}
+}
+
+func TestAuditRecordsDecisionUsed(t *testing.T) {
+	sink := &recordingAuditSink{}
+	policy := &Policy{Rules: []PolicyRule{{Tools: []string{"reveal"}, Action: PolicyActionAllow, Reason: "trusted"}}}
+	mgr := NewToolManager().WithPolicy(policy).WithAuditSink(sink).
+		WithTool(&fakeEnforcingTool{fakeTool{name: "reveal", requiresApproval: true}}, 1)
+
+	_, result := mgr.callTool(context.Background(), newToolCall("1", "reveal", "{}"))
+	mgr.audit(context.Background(), newToolCall("1", "reveal", "{}"), 1, "", nil, result)
+
+	if len(sink.records) != 1 {
+		t.Fatalf("audit() wrote %d records, want 1", len(sink.records))
+	}
+
+	// the policy allows the call, but the tool enforces its approval
+	if record := sink.records[0]; record.Policy != PolicyActionRequireApproval ||
+		record.Outcome != metrics.ToolCallBlockedByApproval {
+		t.Errorf("audit() recorded policy %s with outcome %s, want %s with outcome %s", record.Policy,
+			record.Outcome, PolicyActionRequireApproval, metrics.ToolCallBlockedByApproval)
+	}
+}
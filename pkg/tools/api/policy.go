@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// PolicyAction is the action a Policy takes on a tool call.
+type PolicyAction string
+
+const (
+	// PolicyActionAllow lets the tool call execute without approval.
+	PolicyActionAllow PolicyAction = "allow"
+	// PolicyActionRequireApproval lets the tool call execute after explicit
+	// user approval.
+	PolicyActionRequireApproval PolicyAction = "require-approval"
+	// PolicyActionDeny blocks the tool call.
+	PolicyActionDeny PolicyAction = "deny"
+)
+
+// Policy is an ordered list of rules that decide what happens with tool
+// calls. The first rule that matches a tool call decides on it.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule matches tool calls by tool name and the objects they target (see
+// PolicyTarget). Every matcher is a list of glob patterns (see path.Match),
+// matched case-insensitively against the attribute of the same name. An empty
+// matcher matches everything, and a missing attribute is matched as an empty
+// string.
+type PolicyRule struct {
+	// Tools matches the name of the tool.
+	Tools []string `json:"tools,omitempty"`
+	// Operations matches the operation, e.g. GET or DELETE.
+	Operations []string `json:"operations,omitempty"`
+	// Groups matches the API group.
+	Groups []string `json:"groups,omitempty"`
+	// Versions matches the API version.
+	Versions []string `json:"versions,omitempty"`
+	// Resources matches the resource, e.g. secrets.
+	Resources []string `json:"resources,omitempty"`
+	// Namespaces matches the namespace.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Names matches the name.
+	Names []string `json:"names,omitempty"`
+
+	// Action is the action taken on matching tool calls.
+	Action PolicyAction `json:"action"`
+	// Reason explains the action to the model and the user.
+	Reason string `json:"reason,omitempty"`
+}
+
+// PolicyTarget is an object a tool call operates on, as matched by policy
+// rules.
+type PolicyTarget struct {
+	Operation string `json:"operation,omitempty"`
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Resource  string `json:"resource,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	// Kind is the kind of the object, if known. Policies do not match on it,
+	// audit records do.
+	Kind string `json:"kind,omitempty"`
+}
+
+// PolicyTargetFromArguments returns the target of a tool call from its raw
+// "operation", "group", "version", "resource", "namespace" and "name"
+// arguments, for tools that do not resolve their targets (see PolicyTargeter).
+func PolicyTargetFromArguments(arguments string) PolicyTarget {
+	args := parsePolicyArguments(arguments)
+
+	return PolicyTarget{
+		Operation: args["operation"],
+		Group:     args["group"],
+		Version:   args["version"],
+		Resource:  args["resource"],
+		Namespace: args["namespace"],
+		Name:      args["name"],
+	}
+}
+
+// PolicyDecision is the outcome of evaluating a Policy on a tool call.
+type PolicyDecision struct {
+	Action PolicyAction
+	Reason string
+}
+
+// LoadPolicy reads a YAML (or JSON) policy from the given file.
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var policy Policy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy: %w", err)
+	}
+
+	for idx, rule := range policy.Rules {
+		switch rule.Action {
+		case PolicyActionAllow, PolicyActionRequireApproval, PolicyActionDeny:
+		default:
+			return nil, fmt.Errorf("invalid action in policy rule %d: %q", idx, rule.Action)
+		}
+
+		for _, pattern := range rule.patterns() {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern in policy rule %d: %q", idx, pattern)
+			}
+		}
+	}
+
+	return &policy, nil
+}
+
+// Evaluate returns the decision of the first rule matching the tool call, by
+// its raw arguments (see PolicyTargetFromArguments), and whether any rule
+// matched.
+func (p *Policy) Evaluate(toolName, arguments string) (PolicyDecision, bool) {
+	return p.EvaluateTargets(toolName, []PolicyTarget{PolicyTargetFromArguments(arguments)})
+}
+
+// EvaluateTargets evaluates the policy on every target of a tool call, and
+// returns the most restrictive decision along with whether it applies: the
+// call is denied if any target is, requires approval if any target does, and
+// is allowed only if every target is. Otherwise, no decision applies.
+func (p *Policy) EvaluateTargets(toolName string, targets []PolicyTarget) (PolicyDecision, bool) {
+	if p == nil {
+		return PolicyDecision{}, false
+	}
+
+	var approval *PolicyDecision
+	allowed := 0
+	for _, target := range targets {
+		decision, ok := p.evaluate(toolName, target)
+		if !ok {
+			continue
+		}
+
+		switch decision.Action {
+		case PolicyActionDeny:
+			return decision, true
+		case PolicyActionRequireApproval:
+			if approval == nil {
+				approval = &decision
+			}
+		case PolicyActionAllow:
+			allowed++
+		}
+	}
+
+	switch {
+	case approval != nil:
+		return *approval, true
+	case allowed > 0 && allowed == len(targets):
+		return PolicyDecision{Action: PolicyActionAllow}, true
+	default:
+		return PolicyDecision{}, false
+	}
+}
+
+// evaluate returns the decision of the first rule matching the target, and
+// whether any rule matched.
+func (p *Policy) evaluate(toolName string, target PolicyTarget) (PolicyDecision, bool) {
+	for _, rule := range p.Rules {
+		if rule.matches(toolName, target) {
+			return PolicyDecision{Action: rule.Action, Reason: rule.Reason}, true
+		}
+	}
+
+	return PolicyDecision{}, false
+}
+
+func (r *PolicyRule) matches(toolName string, target PolicyTarget) bool {
+	return matchesAny(r.Tools, toolName) &&
+		matchesAny(r.Operations, target.Operation) &&
+		matchesAny(r.Groups, target.Group) &&
+		matchesAny(r.Versions, target.Version) &&
+		matchesAny(r.Resources, target.Resource) &&
+		matchesAny(r.Namespaces, target.Namespace) &&
+		matchesAny(r.Names, target.Name)
+}
+
+func (r *PolicyRule) patterns() []string {
+	var patterns []string
+	for _, matcher := range [][]string{r.Tools, r.Operations, r.Groups, r.Versions, r.Resources,
+		r.Namespaces, r.Names} {
+		patterns = append(patterns, matcher...)
+	}
+
+	return patterns
+}
+
+func matchesAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(value)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parsePolicyArguments returns the string arguments of a tool call.
+// Arguments that are not strings cannot be matched on, and are dropped.
+func parsePolicyArguments(arguments string) map[string]string {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(arguments), &raw); err != nil {
+		return nil
+	}
+
+	args := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if str, ok := value.(string); ok {
+			args[key] = str
+		}
+	}
+
+	return args
+}
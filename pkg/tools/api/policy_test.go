@@ -0,0 +1,32 @@
+package api
+
+import "testing"
+
+func TestExamplePolicy(t *testing.T) {
+	policy, err := LoadPolicy("../../../config/policy/example-policy.yaml")
+	if err != nil {
+		t.Fatalf("LoadPolicy() error = %v", err)
+	}
+
+	for _, tc := range []struct {
+		tool, arguments string
+		want            PolicyAction
+	}{
+		{"K8sDynamicClient", `{"operation":"GET","resource":"pods","namespace":"default"}`, PolicyActionAllow},
+		{"K8sDynamicClient", `{"operation":"GET","resource":"secrets","namespace":"default"}`,
+			PolicyActionRequireApproval},
+		{"K8sDynamicClient", `{"operation":"DELETE","resource":"pods","namespace":"kube-system"}`, PolicyActionDeny},
+		{"K8sDynamicClient", `{"operation":"ROLLOUT_UNDO","resource":"deployments","namespace":"prod-eu"}`,
+			PolicyActionDeny},
+		{"ImportKueryFlow", `{"operation":"LIST","namespace":"default"}`, PolicyActionAllow},
+	} {
+		decision, ok := policy.Evaluate(tc.tool, tc.arguments)
+		if !ok || decision.Action != tc.want {
+			t.Errorf("Evaluate(%s, %s) = %v, %v, want %s", tc.tool, tc.arguments, decision, ok, tc.want)
+		}
+	}
+
+	if decision, ok := policy.Evaluate("ImportKueryFlow", `{"operation":"EXECUTE"}`); ok {
+		t.Errorf("Evaluate(ImportKueryFlow EXECUTE) = %v, want the built-in approval requirement", decision)
+	}
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Redacted replaces redacted values.
+const Redacted = "<redacted>"
+
+// sensitiveKeyPattern matches the keys whose values are secrets wherever they
+// appear, e.g. in a ConfigMap or an environment variable list.
+var sensitiveKeyPattern = regexp.MustCompile(
+	`(?i)^(password|passwd|token|secret|api[-_]?key|access[-_]?key|secret[-_]?key|private[-_]?key|credentials?)$`)
+
+// sensitiveDataKeyPattern matches the keys of ConfigMap data whose values are
+// secrets, e.g. DB_PASSWORD or github-token.
+var sensitiveDataKeyPattern = regexp.MustCompile(
+	`(?i)(password|passwd|token|secret|api[-_]?key|access[-_]?key|private[-_]?key|credentials?|connection[-_]?string)`)
+
+// lastAppliedAnnotation holds the full manifest an object was last applied
+// with, including the data of Secrets.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// documentSeparator separates the documents of a YAML stream.
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// revealFunc returns whether a value was revealed, and must not be redacted.
+type revealFunc func(value string) bool
+
+// RedactArguments returns the JSON arguments of a tool call with the data of
+// Secrets and the values of sensitive keys redacted, including within the
+// manifests (JSON or YAML) passed as string arguments.
+// Arguments that are not a JSON object are returned as is.
+func RedactArguments(arguments string) string {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return arguments
+	}
+
+	secret := targetsSecrets(args)
+	for key, value := range args {
+		if manifests, ok := value.(string); ok && looksLikeManifest(manifests) {
+			args[key] = redactManifests(manifests, secret, nil)
+			continue
+		}
+
+		args[key] = redactValue(key, value, nil)
+	}
+
+	redacted, err := json.Marshal(args)
+	if err != nil {
+		return arguments
+	}
+
+	return string(redacted)
+}
+
+// targetsSecrets returns whether the arguments of a tool call address Secrets:
+// the object of a call on the secrets resource is a Secret even without its
+// kind.
+func targetsSecrets(args map[string]any) bool {
+	resource, _ := args["resource"].(string)
+	kind, _ := args["kind"].(string)
+
+	return resource == "secrets" || kind == "Secret"
+}
+
+// looksLikeManifest returns whether the string is a Kubernetes object manifest,
+// or a multi-document stream of them.
+func looksLikeManifest(value string) bool {
+	return strings.Contains(value, "kind") || strings.Contains(value, "data")
+}
+
+// redactManifests redacts the YAML (or JSON) documents of the manifests,
+// keeping the values reveal returns true for (reveal may be nil).
+// Documents that cannot be parsed are redacted entirely, if secret, and kept
+// verbatim otherwise, as are documents with nothing to redact.
+func redactManifests(manifests string, secret bool, reveal revealFunc) string {
+	documents := documentSeparator.Split(manifests, -1)
+	separators := documentSeparator.FindAllString(manifests, -1)
+
+	var redacted strings.Builder
+	for i, document := range documents {
+		if i > 0 {
+			redacted.WriteString(separators[i-1])
+		}
+
+		redacted.WriteString(redactDocument(document, secret, reveal))
+	}
+
+	return redacted.String()
+}
+
+// redactDocument redacts a single YAML (or JSON) document of manifests.
+func redactDocument(document string, secret bool, reveal revealFunc) string {
+	var object map[string]any
+	if err := yaml.Unmarshal([]byte(document), &object); err != nil || object == nil {
+		if secret {
+			return leadingNewline(document) + Redacted + "\n"
+		}
+
+		return document
+	}
+
+	original, err := yaml.Marshal(object)
+	if err != nil {
+		return leadingNewline(document) + Redacted + "\n"
+	}
+
+	redacted, err := yaml.Marshal(redactObject(object, secret, reveal))
+	if err != nil {
+		return leadingNewline(document) + Redacted + "\n"
+	}
+
+	if bytes.Equal(original, redacted) { // keep documents with nothing to redact verbatim
+		return document
+	}
+
+	return leadingNewline(document) + string(redacted)
+}
+
+// leadingNewline returns the newline that follows the separator of a document,
+// if any, so that redacted documents stay on their own lines.
+func leadingNewline(document string) string {
+	if strings.HasPrefix(document, "\n") {
+		return "\n"
+	}
+
+	return ""
+}
+
+// redactObject redacts the data of the object if it is a Secret, the
+// sensitive keys of its data if it is a ConfigMap, and the values of its
+// sensitive keys.
+func redactObject(object map[string]any, secret bool, reveal revealFunc) map[string]any {
+	kind, _ := object["kind"].(string)
+	secret = secret || kind == "Secret"
+
+	for key, value := range object {
+		switch {
+		case secret && (key == "data" || key == "stringData"):
+			object[key] = redactData(value, nil, reveal)
+		case kind == "ConfigMap" && (key == "data" || key == "binaryData"):
+			object[key] = redactData(value, sensitiveDataKeyPattern, reveal)
+		case secret && key == "metadata":
+			object[key] = redactLastApplied(value)
+		default:
+			object[key] = redactValue(key, value, reveal)
+		}
+	}
+
+	return object
+}
+
+// redactValue redacts the value of the given key if sensitive, and otherwise
+// the objects and sensitive keys nested in it.
+func redactValue(key string, value any, reveal revealFunc) any {
+	switch v := value.(type) {
+	case map[string]any:
+		if _, isObject := v["kind"]; isObject {
+			return redactObject(v, false, reveal)
+		}
+
+		for nestedKey, nestedValue := range v {
+			v[nestedKey] = redactValue(nestedKey, nestedValue, reveal)
+		}
+
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(key, item, reveal)
+		}
+
+		return v
+	case string:
+		if sensitiveKeyPattern.MatchString(key) && !revealed(reveal, v) {
+			return Redacted
+		}
+
+		return v
+	default:
+		return v
+	}
+}
+
+// redactData redacts the values of a map (e.g., the data of a Secret) whose
+// keys match the given pattern, or every value if the pattern is nil, keeping
+// its keys and the revealed values.
+func redactData(value any, keys *regexp.Regexp, reveal revealFunc) any {
+	data, ok := value.(map[string]any)
+	if !ok {
+		if keys != nil {
+			return value
+		}
+
+		return Redacted
+	}
+
+	for key, item := range data {
+		if keys != nil && !keys.MatchString(key) {
+			continue
+		}
+
+		if str, ok := item.(string); ok && revealed(reveal, str) {
+			continue
+		}
+
+		data[key] = Redacted
+	}
+
+	return data
+}
+
+// redactLastApplied redacts the last-applied-configuration annotation of the
+// metadata of a Secret, which holds its data.
+func redactLastApplied(value any) any {
+	metadata, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+
+	annotations, ok := metadata["annotations"].(map[string]any)
+	if !ok {
+		return metadata
+	}
+
+	if _, ok := annotations[lastAppliedAnnotation]; ok {
+		annotations[lastAppliedAnnotation] = Redacted
+	}
+
+	return metadata
+}
+
+// revealed returns whether the value was revealed.
+func revealed(reveal revealFunc, value string) bool {
+	return reveal != nil && reveal(value)
+}
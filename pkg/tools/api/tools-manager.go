@@ -1,42 +1,197 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"sync"
+	"time"
+
 	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+
+	"github.com/kube-agent/kuery/pkg/metrics"
+	"github.com/kube-agent/kuery/pkg/tracing"
 )
 
 // ToolManager holds all available tools and streamlines operating them.
+// A ToolManager is safe for concurrent use. Tool definitions may be shared
+// between sessions through ForSession, while the approval, retry and
+// tool-call bookkeeping is always owned by a single session.
 type ToolManager struct {
-	tools map[string]Tool
+	mu sync.RWMutex
+
+	sessionID string
+	// user is the user the session acts as, empty if Kuery's own identity.
+	user      string
+	tools     map[string]Tool
+	auditSink AuditSink
+	redactor  *Redactor
+	policy    *Policy
+	readOnly  bool
+	// cluster is the name of the cluster the tools currently target.
+	cluster string
 
-	toolCallCache map[string]llms.ToolCall
-	nextCallID    int
+	toolCallCache    map[string]llms.ToolCall
+	toolCallClusters map[string]string
+	nextCallID       int
 
 	// TODO: combine maps
 	toolMaxRetries map[string]int
-	toolApprovals  map[string]bool
 	toolRetries    map[string]int // for starters, retries are global per LLM step
+	// approvedCalls holds the approvals of the tool calls the user approved, by
+	// their hashes (see ToolCallHash) prefixed by the cluster they were
+	// approved on, until their successful execution or until they are cleared
+	// (see ClearApprovals).
+	approvedCalls map[string]*AuditApproval
 }
 
 // NewToolManager creates a new ToolManager.
 func NewToolManager() *ToolManager {
 	return &ToolManager{
-		tools:          make(map[string]Tool),
-		toolCallCache:  make(map[string]llms.ToolCall),
-		nextCallID:     1,
-		toolMaxRetries: make(map[string]int),
-		toolApprovals:  make(map[string]bool),
-		toolRetries:    make(map[string]int),
+		tools:            make(map[string]Tool),
+		toolCallCache:    make(map[string]llms.ToolCall),
+		toolCallClusters: make(map[string]string),
+		nextCallID:       1,
+		toolMaxRetries:   make(map[string]int),
+		toolRetries:      make(map[string]int),
+		approvedCalls:    make(map[string]*AuditApproval),
+		redactor:         NewRedactor(),
 	}
 }
 
+// ForSession returns a new ToolManager for the given session.
+// The returned manager starts with the tools and retry limits of m, but owns
+// its own approvals, retries, revealed values and tool-call cache. Tools added
+// to either manager afterward are not visible to the other.
+func (m *ToolManager) ForSession(sessionID string) *ToolManager {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session := NewToolManager()
+	session.sessionID = sessionID
+	session.policy = m.policy
+	session.auditSink = m.auditSink
+	session.redactor = m.redactor.ForSession()
+	session.readOnly = m.readOnly
+	session.cluster = m.cluster
+	session.tools = maps.Clone(m.tools)
+	session.toolMaxRetries = maps.Clone(m.toolMaxRetries)
+	for name := range m.toolRetries {
+		session.toolRetries[name] = 0
+	}
+
+	return session
+}
+
+// SessionID returns the ID of the session the manager belongs to, or an empty
+// string if the manager is not bound to a session.
+func (m *ToolManager) SessionID() string {
+	return m.sessionID
+}
+
+// WithUser sets the user the session of the manager acts as, for auditing.
+func (m *ToolManager) WithUser(user string) *ToolManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.user = user
+	return m
+}
+
+// WithAuditSink sets the sink the audit records of the tool calls that may
+// affect a cluster are written to.
+func (m *ToolManager) WithAuditSink(sink AuditSink) *ToolManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.auditSink = sink
+	return m
+}
+
+// WithRedactor sets the redactor that masks secrets in tool responses before
+// they reach the LLM. A nil redactor disables redaction.
+func (m *ToolManager) WithRedactor(redactor *Redactor) *ToolManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.redactor = redactor
+	return m
+}
+
+// RevealValues stops redacting the given values in the tool responses of the
+// session, once the user explicitly agreed to share them with the LLM.
+func (m *ToolManager) RevealValues(values ...string) {
+	m.mu.RLock()
+	redactor := m.redactor
+	m.mu.RUnlock()
+
+	if redactor != nil {
+		redactor.Reveal(values...)
+	}
+}
+
+// WithPolicy sets the policy that decides whether tool calls are allowed,
+// require approval or are denied. Tool calls that no rule matches fall back to
+// the tool's RequiresApproval.
+func (m *ToolManager) WithPolicy(policy *Policy) *ToolManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.policy = policy
+	return m
+}
+
+// WithReadOnly sets whether the manager is in read-only mode, in which it
+// refuses every tool call that may modify state, including every call of
+// tools that do not implement Mutator.
+func (m *ToolManager) WithReadOnly(readOnly bool) *ToolManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.readOnly = readOnly
+	return m
+}
+
+// ReadOnly returns whether the manager is in read-only mode.
+func (m *ToolManager) ReadOnly() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.readOnly
+}
+
+// WithCluster sets the name of the cluster the tools of the manager target.
+// Tool calls are tagged with it, and approvals only hold on the cluster they
+// were given on.
+func (m *ToolManager) WithCluster(cluster string) *ToolManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cluster = cluster
+	return m
+}
+
+// Cluster returns the name of the cluster the tools of the manager target.
+func (m *ToolManager) Cluster() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.cluster
+}
+
 // WithTool adds a tool to the manager.
 // The maxRetries parameter specifies the maximum number of consecutive runs a tool can have.
 func (m *ToolManager) WithTool(tool Tool, maxRetries int) *ToolManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.tools[tool.Name()] = tool
 	if tool.RequiresApproval() {
-		m.toolApprovals[tool.Name()] = false
 		m.toolRetries[tool.Name()] = 0
 		m.toolMaxRetries[tool.Name()] = maxRetries
 	}
@@ -60,12 +215,27 @@ func (m *ToolManager) WithTools(tools []Tool, maxRetries []int) *ToolManager {
 
 // GetToolCall returns the tool call with the given ID.
 func (m *ToolManager) GetToolCall(id string) (*llms.ToolCall, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	toolCall, ok := m.toolCallCache[id]
 	return &toolCall, ok
 }
 
+// GetToolCallCluster returns the name of the cluster the tool call with the
+// given ID targeted, or an empty string if unknown.
+func (m *ToolManager) GetToolCallCluster(id string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.toolCallClusters[id]
+}
+
 // GetLLMTools returns all tools as LLM tools.
 func (m *ToolManager) GetLLMTools() []llms.Tool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	llmTools := make([]llms.Tool, 0, len(m.tools))
 	for _, tool := range m.tools {
 		llmTools = append(llmTools, *tool.LLMTool())
@@ -76,6 +246,9 @@ func (m *ToolManager) GetLLMTools() []llms.Tool {
 
 // GetToolNames returns the names of all tools.
 func (m *ToolManager) GetToolNames() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	names := make([]string, 0, len(m.tools))
 	for name := range m.tools {
 		names = append(names, name)
@@ -84,6 +257,11 @@ func (m *ToolManager) GetToolNames() []string {
 	return names
 }
 
+// HasTool returns whether a tool with the given name is registered.
+func (m *ToolManager) HasTool(name string) bool {
+	return m.getTool(name) != nil
+}
+
 // ExecuteToolCalls executes the tool calls in the response and returns:
 // - The new messages
 // - A boolean indicating whether the response requires further processing (LLMStep).
@@ -93,16 +271,38 @@ func (m *ToolManager) ExecuteToolCalls(ctx context.Context, resp *llms.ContentRe
 	newMessages := make([]llms.MessageContent, 0)
 	requireFurtherProcessing := false
 
-	usedTools := []string{}
-
 	for _, choice := range resp.Choices {
 		for _, toolCall := range choice.ToolCalls {
-			toolCallResponse, ok, requiresExplaining := m.callTool(ctx, &toolCall)
+			cluster := m.Cluster()                        // captured before the call, which may switch clusters
+			approval := m.getApproval(cluster, &toolCall) // consumed by a successful call
+			toolCtx, span := tracing.Tracer().Start(ctx, "Tool "+toolCall.FunctionCall.Name, trace.WithAttributes(
+				tracing.ToolNameKey.String(toolCall.FunctionCall.Name),
+				tracing.ToolCallIDKey.String(toolCall.ID),
+				tracing.ClusterKey.String(cluster),
+			))
+
+			toolCallResponse, result := m.callTool(toolCtx, &toolCall)
+			outcome := result.outcome
+			toolCallResponse.Content = m.RedactResponse(&toolCall, toolCallResponse.Content)
+			callID := m.recordToolCall(toolCall, outcome == metrics.ToolCallSuccess, cluster)
+			observeToolCall(toolCall.FunctionCall.Name, outcome)
+			m.audit(ctx, &toolCall, callID, cluster, approval, result)
+
+			span.SetAttributes(tracing.ToolOutcomeKey.String(outcome))
+			if outcome != metrics.ToolCallSuccess {
+				span.SetStatus(codes.Error, outcome)
+			}
+			span.End()
+
+			executed := fmt.Sprintf("[ID: %d] Tool-Call %s executed", callID, toolCall.FunctionCall.Name)
+			if cluster != "" {
+				executed += fmt.Sprintf(" on cluster %s", cluster)
+			}
+
 			newMessages = append(newMessages, llms.MessageContent{ // tool call message is always appended
 				Role: llms.ChatMessageTypeAI,
 				Parts: []llms.ContentPart{
-					llms.TextPart(fmt.Sprintf("[ID: %d] Tool-Call %s executed\n",
-						m.nextCallID, toolCall.FunctionCall.Name)),
+					llms.TextPart(executed + "\n"),
 					llms.ToolCall{
 						ID:   toolCall.ID,
 						Type: toolCall.Type,
@@ -112,78 +312,356 @@ func (m *ToolManager) ExecuteToolCalls(ctx context.Context, resp *llms.ContentRe
 						},
 					}}})
 
-			requireFurtherProcessing = requireFurtherProcessing || requiresExplaining
+			requireFurtherProcessing = requireFurtherProcessing || result.requiresExplaining
 			newMessages = append(newMessages, llms.MessageContent{
 				Role:  llms.ChatMessageTypeTool,
 				Parts: []llms.ContentPart{toolCallResponse}})
-
-			if !ok {
-				m.toolRetries[toolCall.FunctionCall.Name]++
-				m.nextCallID++
-				continue
-			}
-
-			// Bookkeeping, TODO: make this more maintainable
-			m.toolCallCache[fmt.Sprintf("%d", m.nextCallID)] = toolCall // safe since execution blocks Kuery
-			m.toolRetries[toolCall.FunctionCall.Name] = 0               // reset retries because tool was successful
-			m.toolApprovals[toolCall.FunctionCall.Name] = false         // reset approval because tool was successful
-			usedTools = append(usedTools, toolCall.FunctionCall.Name)
-			m.nextCallID++
 		}
 	}
 
 	return newMessages, requireFurtherProcessing
 }
 
+// RedactResponse masks the secrets in the content of a response to the tool
+// call, e.g. the summary of a task the call left running in the background.
+func (m *ToolManager) RedactResponse(toolCall *llms.ToolCall, content string) string {
+	m.mu.RLock()
+	redactor := m.redactor
+	m.mu.RUnlock()
+
+	if redactor == nil {
+		return content
+	}
+
+	return redactor.Redact(toolCall.FunctionCall.Arguments, content)
+}
+
+// observeToolCall records the metrics of a tool call. Calls to unknown tools
+// are not labeled by name, which the LLM may make up.
+func observeToolCall(name, outcome string) {
+	if outcome == metrics.ToolCallNotFound {
+		name = "unknown"
+	}
+
+	metrics.ToolCalls.WithLabelValues(name, outcome).Inc()
+}
+
+// recordToolCall does the bookkeeping that follows a tool call on the given
+// cluster and returns the ID assigned to the call.
+func (m *ToolManager) recordToolCall(toolCall llms.ToolCall, ok bool, cluster string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	callID := m.nextCallID
+	m.nextCallID++
+
+	if !ok {
+		m.toolRetries[toolCall.FunctionCall.Name]++
+		return callID
+	}
+
+	// Bookkeeping, TODO: make this more maintainable
+	m.toolCallCache[fmt.Sprintf("%d", callID)] = toolCall
+	m.toolCallClusters[fmt.Sprintf("%d", callID)] = cluster
+	m.toolRetries[toolCall.FunctionCall.Name] = 0 // reset retries because tool was successful
+	delete(m.approvedCalls, approvalKey(cluster, toolCall.FunctionCall.Name, toolCall.FunctionCall.Arguments))
+
+	return callID
+}
+
 // getTool returns the tool with the given name.
 func (m *ToolManager) getTool(name string) Tool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	return m.tools[name]
 }
 
-// callTool calls the tool with the given tool call, if conditions allow.
-// The returned tuple consists of:
-// - The tool call response
-// - A boolean indicating whether the tool call went through
-// - A boolean indicating whether the tool call requires explaining
-//
+// toolCallResult is the result of a tool call, besides its response.
+type toolCallResult struct {
+	// outcome is the outcome of the call, metrics.ToolCallSuccess if it went
+	// through.
+	outcome string
+	// requiresExplaining is whether the call requires explaining.
+	requiresExplaining bool
+	// decision is the policy decision the call was subject to, nil if it was
+	// blocked before the policy was evaluated.
+	decision *PolicyDecision
+	// targets are the objects the call operates on, see targets.
+	targets []PolicyTarget
+}
+
+// callTool calls the tool with the given tool call, if conditions allow, and
+// returns its response along with the result of the call.
 // If a toolcall is blocked, the response would contain the reason.
-func (m *ToolManager) callTool(ctx context.Context, toolCall *llms.ToolCall) (llms.ToolCallResponse, bool, bool) {
+func (m *ToolManager) callTool(ctx context.Context, toolCall *llms.ToolCall) (llms.ToolCallResponse, toolCallResult) {
 	tool := m.getTool(toolCall.FunctionCall.Name)
 	if tool == nil {
 		return llms.ToolCallResponse{
 			ToolCallID: toolCall.ID,
 			Name:       toolCall.FunctionCall.Name,
 			Content:    fmt.Sprintf("tool not found: %s", toolCall.FunctionCall.Name),
-		}, false, true
+		}, toolCallResult{outcome: metrics.ToolCallNotFound, requiresExplaining: true}
 	}
 
-	if m.toolRetries[tool.Name()] > m.toolMaxRetries[tool.Name()] {
+	m.mu.RLock()
+	retriesExceeded := m.toolRetries[tool.Name()] > m.toolMaxRetries[tool.Name()]
+	approved := m.approvedCalls[approvalKey(m.cluster, toolCall.FunctionCall.Name, toolCall.FunctionCall.Arguments)] != nil
+	m.mu.RUnlock()
+
+	targets := m.targets(tool, toolCall)
+	if retriesExceeded {
 		return llms.ToolCallResponse{
 			ToolCallID: toolCall.ID,
 			Name:       toolCall.FunctionCall.Name,
 			Content:    "tool has reached the maximum number of consecutive runs. Context should return to the user.",
-		}, false, true
+		}, toolCallResult{outcome: metrics.ToolCallBlockedByRetries, requiresExplaining: true, targets: targets}
 	} // this must be first to block AI retries in explanation windows
 
-	if tool.RequiresApproval() && !m.toolApprovals[tool.Name()] {
+	if m.ReadOnly() && mutates(tool, toolCall) {
 		return llms.ToolCallResponse{
 			ToolCallID: toolCall.ID,
 			Name:       toolCall.FunctionCall.Name,
-			Content:    "tool requires explicit user approval before execution",
-		}, false, true
+			Content: "Kuery is in read-only mode and refuses tool calls that modify the cluster. " +
+				"Do not retry, tell the user what you would have done instead.",
+		}, toolCallResult{outcome: metrics.ToolCallBlockedByReadOnly, requiresExplaining: true, targets: targets}
 	}
 
+	decision := m.decide(tool, toolCall, targets)
+	result := toolCallResult{requiresExplaining: true, decision: &decision, targets: targets}
+	if decision.Action == PolicyActionDeny {
+		result.outcome = metrics.ToolCallDeniedByPolicy
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("tool call is denied by policy: %s", decision.Reason),
+		}, result
+	}
+
+	if checker, ok := tool.(PreflightChecker); ok {
+		if err := checker.Preflight(ctx, toolCall); err != nil {
+			result.outcome = metrics.ToolCallRejectedByPreflight
+			return llms.ToolCallResponse{
+				ToolCallID: toolCall.ID,
+				Name:       toolCall.FunctionCall.Name,
+				Content:    fmt.Sprintf("tool call would be rejected, do not request approval for it: %v", err),
+			}, result
+		}
+	} // checked before approval so that the user is not asked to approve a call that cannot succeed
+
+	if decision.Action == PolicyActionRequireApproval && !approved {
+		content := "this tool call requires explicit user approval before execution"
+		if decision.Reason != "" {
+			content += ": " + decision.Reason
+		}
+		content += ". Request approval for the call with its exact arguments first."
+
+		result.outcome = metrics.ToolCallBlockedByApproval
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    content,
+		}, result
+	}
+
+	// the lock is not held during the call since tools may call back into the manager
 	response, ok := tool.Call(ctx, toolCall)
-	return response, ok, tool.RequiresExplaining()
+	result.outcome, result.requiresExplaining = metrics.ToolCallSuccess, tool.RequiresExplaining()
+	if !ok {
+		result.outcome = metrics.ToolCallFailure
+	}
+
+	return response, result
+}
+
+// targets returns the objects the tool call operates on, as resolved by the
+// tool if it is a PolicyTargeter, and otherwise as given by its arguments.
+func (m *ToolManager) targets(tool Tool, toolCall *llms.ToolCall) []PolicyTarget {
+	if targeter, ok := tool.(PolicyTargeter); ok {
+		if resolved, err := targeter.PolicyTargets(toolCall); err == nil && len(resolved) > 0 {
+			return resolved
+		} // unresolvable calls fail on execution, and are matched on their arguments meanwhile
+	}
+
+	return []PolicyTarget{PolicyTargetFromArguments(toolCall.FunctionCall.Arguments)}
+}
+
+// decide evaluates the policy on the targets of the tool call (see targets).
+// If no rule matches, the decision falls back to whether the tool requires
+// approval. Calls of ApprovalEnforcers require approval unless denied.
+func (m *ToolManager) decide(tool Tool, toolCall *llms.ToolCall, targets []PolicyTarget) PolicyDecision {
+	decision := m.evaluatePolicy(tool, targets)
+	if enforcer, ok := tool.(ApprovalEnforcer); ok && decision.Action == PolicyActionAllow &&
+		enforcer.EnforcesApproval(toolCall) {
+		return PolicyDecision{Action: PolicyActionRequireApproval, Reason: decision.Reason}
+	}
+
+	return decision
+}
+
+// evaluatePolicy returns the decision of the policy on the targets of a call
+// of the tool, see decide.
+func (m *ToolManager) evaluatePolicy(tool Tool, targets []PolicyTarget) PolicyDecision {
+	m.mu.RLock()
+	policy := m.policy
+	m.mu.RUnlock()
+
+	if policy != nil {
+		if decision, ok := policy.EvaluateTargets(tool.Name(), targets); ok {
+			return decision
+		}
+	}
+
+	if tool.RequiresApproval() {
+		return PolicyDecision{Action: PolicyActionRequireApproval}
+	}
+
+	return PolicyDecision{Action: PolicyActionAllow}
+}
+
+// ApproveToolCall approves the tool call with the given tool name and
+// arguments on the current cluster, until its successful execution or until
+// the approvals are cleared. Calls with any other arguments, or on any other
+// cluster, remain unapproved.
+// The input the call was approved by (e.g., the answer of the user) is
+// audited along with the call.
+func (m *ToolManager) ApproveToolCall(name, arguments, input string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.approvedCalls[approvalKey(m.cluster, name, arguments)] = &AuditApproval{
+		Time:  time.Now(),
+		Input: input,
+	}
+}
+
+// ClearApprovals revokes the approvals of all the tool calls that were not
+// executed yet, so that an approval does not outlive the request it answered.
+func (m *ToolManager) ClearApprovals() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clear(m.approvedCalls)
+}
+
+// getApproval returns the approval of the tool call on the given cluster, or
+// nil if it is not approved.
+func (m *ToolManager) getApproval(cluster string, toolCall *llms.ToolCall) *AuditApproval {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.approvedCalls[approvalKey(cluster, toolCall.FunctionCall.Name, toolCall.FunctionCall.Arguments)]
 }
 
-func (m *ToolManager) ApproveTools(toolNames []string) {
-	for _, name := range toolNames {
-		m.toolApprovals[name] = true
+// audit writes the audit record of the tool call to the audit sink, if the
+// call may affect the cluster.
+func (m *ToolManager) audit(ctx context.Context, toolCall *llms.ToolCall, callID int, cluster string,
+	approval *AuditApproval, result toolCallResult) {
+	m.mu.RLock()
+	sink, sessionID, user := m.auditSink, m.sessionID, m.user
+	m.mu.RUnlock()
+
+	tool := m.getTool(toolCall.FunctionCall.Name)
+	if sink == nil || tool == nil || !affectsCluster(tool, toolCall) {
+		return
+	}
+
+	record := AuditRecord{
+		Time:       time.Now(),
+		SessionID:  sessionID,
+		User:       user,
+		Cluster:    cluster,
+		Tool:       toolCall.FunctionCall.Name,
+		ToolCallID: toolCall.ID,
+		CallID:     callID,
+		Arguments:  RedactArguments(toolCall.FunctionCall.Arguments),
+		Targets:    result.targets,
+		Approval:   approval,
+		Outcome:    result.outcome,
+	}
+	if result.decision != nil { // the decision the call was actually subject to
+		record.Policy, record.PolicyReason = result.decision.Action, result.decision.Reason
+	}
+
+	if err := sink.Write(ctx, record); err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to write audit record", "tool", record.Tool, "callID", callID)
 	}
 }
 
+// affectsCluster returns whether the tool call may affect the cluster: calls
+// of Mutators that mutate, and calls of other tools that require approval.
+func affectsCluster(tool Tool, toolCall *llms.ToolCall) bool {
+	if mutator, ok := tool.(Mutator); ok {
+		return mutator.Mutates(toolCall)
+	}
+
+	return tool.RequiresApproval()
+}
+
+// mutates returns whether the tool call may modify state. Tools that do not
+// implement Mutator are assumed to, so that read-only mode fails closed.
+func mutates(tool Tool, toolCall *llms.ToolCall) bool {
+	mutator, ok := tool.(Mutator)
+	return !ok || mutator.Mutates(toolCall)
+}
+
+// approvalKey returns the key of the approval of a tool call on a cluster.
+func approvalKey(cluster, name, arguments string) string {
+	return cluster + "/" + ToolCallHash(name, arguments)
+}
+
+// Preflight returns an error if the tool call is bound to be rejected, be it
+// for an unknown tool, the policy, read-only mode or the tool's own pre-flight
+// checks. It is meant for vetting tool calls before asking for their approval.
+func (m *ToolManager) Preflight(ctx context.Context, toolCall *llms.ToolCall) error {
+	tool := m.getTool(toolCall.FunctionCall.Name)
+	if tool == nil {
+		return fmt.Errorf("tool not found: %s", toolCall.FunctionCall.Name)
+	}
+
+	if m.ReadOnly() && mutates(tool, toolCall) {
+		return fmt.Errorf("Kuery is in read-only mode and refuses tool calls that modify the cluster")
+	}
+
+	if decision := m.decide(tool, toolCall, m.targets(tool, toolCall)); decision.Action == PolicyActionDeny {
+		return fmt.Errorf("tool call is denied by policy: %s", decision.Reason)
+	}
+
+	if checker, ok := tool.(PreflightChecker); ok {
+		return checker.Preflight(ctx, toolCall)
+	}
+
+	return nil
+}
+
+// DescribeToolCall renders the tool call for a human to review, using the
+// tool's own description if it implements Describer.
+func (m *ToolManager) DescribeToolCall(ctx context.Context, toolCall *llms.ToolCall) string {
+	arguments := bytes.Buffer{}
+	if err := json.Indent(&arguments, []byte(toolCall.FunctionCall.Arguments), "", "  "); err != nil {
+		arguments.Reset()
+		arguments.WriteString(toolCall.FunctionCall.Arguments)
+	}
+
+	description := fmt.Sprintf("%s %s", toolCall.FunctionCall.Name, arguments.String())
+
+	if describer, ok := m.getTool(toolCall.FunctionCall.Name).(Describer); ok {
+		toolDescription, err := describer.Describe(ctx, toolCall)
+		if err != nil {
+			return fmt.Sprintf("%s\n(failed to describe the call: %v)", description, err)
+		}
+
+		return toolDescription
+	}
+
+	return description
+}
+
+// ResetToolRetries resets the consecutive-run counters of all tools.
 func (m *ToolManager) ResetToolRetries() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for tool := range m.toolRetries {
 		m.toolRetries[tool] = 0
 	}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/kube-agent/kuery/pkg/metrics"
+)
+
+// fakeTool is a tool that echoes its arguments.
+type fakeTool struct {
+	name             string
+	requiresApproval bool
+}
+
+func (t *fakeTool) Name() string { return t.name }
+
+func (t *fakeTool) LLMTool() *llms.Tool {
+	return &llms.Tool{Type: "function", Function: &llms.FunctionDefinition{Name: t.name}}
+}
+
+func (t *fakeTool) Call(_ context.Context, toolCall *llms.ToolCall) (llms.ToolCallResponse, bool) {
+	return llms.ToolCallResponse{
+		ToolCallID: toolCall.ID,
+		Name:       toolCall.FunctionCall.Name,
+		Content:    "called with " + toolCall.FunctionCall.Arguments,
+	}, true
+}
+
+func (t *fakeTool) RequiresExplaining() bool { return false }
+
+func (t *fakeTool) RequiresApproval() bool { return t.requiresApproval }
+
+// fakeReadTool is a fakeTool that declares its calls read-only.
+type fakeReadTool struct {
+	fakeTool
+}
+
+func (t *fakeReadTool) Mutates(_ *llms.ToolCall) bool { return false }
+
+// fakeEnforcingTool is a fakeTool that enforces the approval of its calls.
+type fakeEnforcingTool struct {
+	fakeTool
+}
+
+func (t *fakeEnforcingTool) EnforcesApproval(_ *llms.ToolCall) bool { return true }
+
+func newToolCall(id, name, arguments string) *llms.ToolCall {
+	return &llms.ToolCall{ID: id, Type: "function", FunctionCall: &llms.FunctionCall{Name: name, Arguments: arguments}}
+}
+
+func TestReadOnlyRefusesUndeclaredTools(t *testing.T) {
+	mgr := NewToolManager().WithReadOnly(true).
+		WithTool(&fakeTool{name: "undeclared"}, 1).
+		WithTool(&fakeReadTool{fakeTool{name: "read"}}, 1)
+
+	for name, want := range map[string]string{
+		"undeclared": metrics.ToolCallBlockedByReadOnly,
+		"read":       metrics.ToolCallSuccess,
+	} {
+		_, result := mgr.callTool(context.Background(), newToolCall("1", name, "{}"))
+		if result.outcome != want {
+			t.Errorf("callTool(%s) outcome = %s, want %s", name, result.outcome, want)
+		}
+
+		err := mgr.Preflight(context.Background(), newToolCall("1", name, "{}"))
+		if blocked := err != nil && strings.Contains(err.Error(), "read-only"); blocked != (want != metrics.ToolCallSuccess) {
+			t.Errorf("Preflight(%s) = %v", name, err)
+		}
+	}
+}
+
+func TestPolicyCannotWaiveEnforcedApproval(t *testing.T) {
+	for action, want := range map[PolicyAction]string{
+		PolicyActionAllow:           metrics.ToolCallBlockedByApproval,
+		PolicyActionRequireApproval: metrics.ToolCallBlockedByApproval,
+		PolicyActionDeny:            metrics.ToolCallDeniedByPolicy,
+	} {
+		policy := &Policy{Rules: []PolicyRule{{Tools: []string{"reveal"}, Action: action}}}
+		mgr := NewToolManager().WithPolicy(policy).
+			WithTool(&fakeEnforcingTool{fakeTool{name: "reveal", requiresApproval: true}}, 1)
+
+		_, result := mgr.callTool(context.Background(), newToolCall("1", "reveal", "{}"))
+		if result.outcome != want {
+			t.Errorf("policy %s: callTool() outcome = %s, want %s", action, result.outcome, want)
+		}
+	}
+}
+
+func TestToolManagerConcurrentSessions(t *testing.T) {
+	const sessions = 8
+	const calls = 20
+
+	base := NewToolManager().WithTool(&fakeTool{name: "guarded", requiresApproval: true}, calls)
+
+	var wg sync.WaitGroup
+	for i := 0; i < sessions; i++ {
+		wg.Add(2)
+
+		go func() { // tools added to the base manager must not leak into sessions
+			defer wg.Done()
+			base.WithTool(&fakeTool{name: fmt.Sprintf("late-%d", i)}, 1)
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			session := base.ForSession(fmt.Sprintf("session-%d", i))
+			session.WithTool(&fakeTool{name: fmt.Sprintf("own-%d", i)}, 1)
+
+			for j := 0; j < calls; j++ {
+				arguments := fmt.Sprintf(`{"session":%d,"call":%d}`, i, j)
+				toolCall := newToolCall(fmt.Sprintf("%d-%d", i, j), "guarded", arguments)
+				response := &llms.ContentResponse{Choices: []*llms.ContentChoice{{ToolCalls: []llms.ToolCall{*toolCall}}}}
+
+				if j%2 == 0 {
+					session.ApproveToolCall("guarded", arguments, "yes")
+				}
+
+				messages, _ := session.ExecuteToolCalls(context.Background(), response)
+				content := messages[1].Parts[0].(llms.ToolCallResponse).Content
+				if approved := strings.HasPrefix(content, "called with"); approved != (j%2 == 0) {
+					t.Errorf("session %d call %d: approved = %v, response %q", i, j, approved, content)
+				}
+			}
+
+			if _, ok := session.GetToolCall("1"); !ok {
+				t.Errorf("session %d: approved calls are not recorded", i)
+			}
+
+			for _, name := range session.GetToolNames() {
+				if strings.HasPrefix(name, "own-") && name != fmt.Sprintf("own-%d", i) {
+					t.Errorf("session %d sees the tool %s of another session", i, name)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, name := range base.GetToolNames() {
+		if strings.HasPrefix(name, "own-") {
+			t.Errorf("base manager sees the session tool %s", name)
+		}
+	}
+}
+
+func TestApprovalsAreScopedToSessions(t *testing.T) {
+	base := NewToolManager().WithTool(&fakeTool{name: "guarded", requiresApproval: true}, 1)
+	approving, other := base.ForSession("approving"), base.ForSession("other")
+
+	approving.ApproveToolCall("guarded", `{"a":1}`, "yes")
+
+	toolCall := newToolCall("1", "guarded", `{"a": 1}`) // equal arguments, formatted differently
+	if _, result := approving.callTool(context.Background(), toolCall); result.outcome != metrics.ToolCallSuccess {
+		t.Errorf("approving session outcome = %s, want %s", result.outcome, metrics.ToolCallSuccess)
+	}
+
+	if _, result := other.callTool(context.Background(), toolCall); result.outcome != metrics.ToolCallBlockedByApproval {
+		t.Errorf("other session outcome = %s, want %s", result.outcome, metrics.ToolCallBlockedByApproval)
+	}
+}
+
+func TestClearApprovals(t *testing.T) {
+	mgr := NewToolManager().WithTool(&fakeTool{name: "guarded", requiresApproval: true}, 1)
+	mgr.ApproveToolCall("guarded", `{"a":1}`, "yes")
+	mgr.ApproveToolCall("guarded", `{"a":2}`, "yes")
+
+	_, result := mgr.callTool(context.Background(), newToolCall("1", "guarded", `{"a":1}`))
+	if result.outcome != metrics.ToolCallSuccess {
+		t.Fatalf("callTool() of an approved call outcome = %s, want %s", result.outcome, metrics.ToolCallSuccess)
+	}
+
+	mgr.ClearApprovals()
+
+	_, result = mgr.callTool(context.Background(), newToolCall("2", "guarded", `{"a":2}`))
+	if result.outcome != metrics.ToolCallBlockedByApproval {
+		t.Errorf("callTool() of a cleared approval outcome = %s, want %s", result.outcome, metrics.ToolCallBlockedByApproval)
+	}
+}
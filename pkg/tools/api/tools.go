@@ -2,7 +2,11 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/tmc/langchaingo/llms"
 )
@@ -24,10 +28,74 @@ type Tool interface {
 	RequiresApproval() bool
 }
 
+// PreflightChecker is implemented by tools that can tell whether a call would
+// be rejected (e.g., for lack of permissions) before it is approved and
+// executed.
+type PreflightChecker interface {
+	// Preflight returns an error describing why the tool call would be
+	// rejected, or nil if it is expected to go through.
+	Preflight(ctx context.Context, toolCall *llms.ToolCall) error
+}
+
+// Mutator is implemented by tools that can tell whether their calls may modify
+// the cluster (or other external state). Tools that do not implement it are
+// considered mutating, and are refused in read-only mode.
+type Mutator interface {
+	// Mutates returns whether the tool call may modify state.
+	Mutates(toolCall *llms.ToolCall) bool
+}
+
+// PolicyTargeter is implemented by tools that resolve the objects their calls
+// operate on (e.g., kinds and short names to resources, and the namespaces of
+// manifests), for policies to match on them instead of the raw arguments.
+type PolicyTargeter interface {
+	// PolicyTargets returns the objects the tool call operates on.
+	PolicyTargets(toolCall *llms.ToolCall) ([]PolicyTarget, error)
+}
+
+// ApprovalEnforcer is implemented by tools whose calls require the approval of
+// the user whatever the policy, e.g. because they disclose sensitive data to
+// the LLM provider. The policy may only deny their calls.
+type ApprovalEnforcer interface {
+	// EnforcesApproval returns whether the tool call requires approval
+	// regardless of the policy.
+	EnforcesApproval(toolCall *llms.ToolCall) bool
+}
+
+// Describer is implemented by tools that can render a tool call for a human
+// to review before approving it, e.g. as a summary of what will happen.
+type Describer interface {
+	// Describe renders the tool call.
+	Describe(ctx context.Context, toolCall *llms.ToolCall) (string, error)
+}
+
+// ToolCallHash returns a hash identifying a tool call by its tool name and
+// arguments. Arguments are compared by their JSON value, so that formatting
+// and key order do not matter.
+func ToolCallHash(name, arguments string) string {
+	canonical := []byte(arguments)
+
+	var value any
+	decoder := json.NewDecoder(strings.NewReader(arguments))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err == nil {
+		if data, err := json.Marshal(value); err == nil {
+			canonical = data
+		}
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(name))
+	hash.Write([]byte{0})
+	hash.Write(canonical)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
 func AddApprovalRequirementToDescription(tool Tool, description string) string {
 	if tool.RequiresApproval() {
 		return fmt.Sprintf("%s\nIMPORTANT: THIS TOOL REQUIRES EXPLICIT USER CONSENT, "+
-			"USE 'RequestApprovalForTools' TOOL FIRST.", description)
+			"USE 'RequestApprovalForTools' TOOL FIRST WITH THE EXACT CALL ARGUMENTS.", description)
 	}
 	return description
 }
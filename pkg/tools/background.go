@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"context"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// BackgroundResult is the result of a background task.
+type BackgroundResult struct {
+	// ToolCall is the tool call that started the task.
+	ToolCall llms.ToolCall
+	// Summary is what the task reported when it ended.
+	Summary string
+}
+
+// BackgroundTasks runs the tasks tool calls leave running in the background
+// (e.g., background watches) for the lifetime of a session. When a task ends,
+// the user is notified right away (in the terminal, by default), and its
+// result is queued for the model to be told about in a later turn.
+// BackgroundTasks is safe for concurrent use.
+type BackgroundTasks struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	notify func(result BackgroundResult)
+
+	mu      sync.Mutex
+	results []BackgroundResult
+}
+
+// NewBackgroundTasks creates a new BackgroundTasks whose tasks run with a
+// context derived from ctx, which is canceled on Stop.
+func NewBackgroundTasks(ctx context.Context) *BackgroundTasks {
+	ctx, cancel := context.WithCancel(ctx)
+	return &BackgroundTasks{
+		ctx:    ctx,
+		cancel: cancel,
+		notify: notifyTerminal,
+	}
+}
+
+// WithNotifier sets the function the user is notified with when a task ends,
+// instead of the terminal. It is called from the goroutine of the task.
+func (b *BackgroundTasks) WithNotifier(notify func(result BackgroundResult)) *BackgroundTasks {
+	b.notify = notify
+	return b
+}
+
+// Go runs the task started by the tool call in the background, and once it
+// ends, queues the summary it returns and notifies the user.
+func (b *BackgroundTasks) Go(toolCall *llms.ToolCall, task func(ctx context.Context) string) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		result := BackgroundResult{ToolCall: *toolCall, Summary: task(b.ctx)}
+
+		b.mu.Lock()
+		b.results = append(b.results, result)
+		b.mu.Unlock()
+
+		b.notify(result)
+	}()
+}
+
+// Results returns the results queued since the last call, in the order the
+// tasks ended.
+func (b *BackgroundTasks) Results() []BackgroundResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	results := b.results
+	b.results = nil
+	return results
+}
+
+// Stop cancels the running tasks and waits for them to return.
+func (b *BackgroundTasks) Stop() {
+	b.cancel()
+	b.wg.Wait()
+}
+
+// notifyTerminal prints the result of a background task to the terminal, while
+// the user may be chatting.
+func notifyTerminal(result BackgroundResult) {
+	color.New(color.FgHiMagenta).Printf("\n[%s] %s\n", result.ToolCall.FunctionCall.Name, result.Summary)
+}
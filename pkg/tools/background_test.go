@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestBackgroundTasks(t *testing.T) {
+	notified := make(chan BackgroundResult, 2)
+	background := NewBackgroundTasks(context.Background()).
+		WithNotifier(func(result BackgroundResult) { notified <- result })
+
+	toolCall := &llms.ToolCall{ID: "call_1", FunctionCall: &llms.FunctionCall{Name: "K8sWatch"}}
+	background.Go(toolCall, func(_ context.Context) string { return "watch ended" })
+
+	// the user is notified as soon as the task ends, without waiting for the next turn
+	select {
+	case result := <-notified:
+		if result.Summary != "watch ended" || result.ToolCall.ID != "call_1" {
+			t.Errorf("notified of %+v, want the result of call_1", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the user was not notified when the task ended")
+	}
+
+	background.Go(toolCall, func(ctx context.Context) string {
+		<-ctx.Done() // e.g. a watch that lasts until the session ends
+		return "watch canceled"
+	})
+	background.Stop()
+
+	var summaries []string
+	for _, result := range background.Results() {
+		summaries = append(summaries, result.Summary)
+	}
+	slices.Sort(summaries)
+	if !slices.Equal(summaries, []string{"watch canceled", "watch ended"}) {
+		t.Errorf("Results() = %v, want the results of both tasks", summaries)
+	}
+
+	if results := background.Results(); len(results) != 0 {
+		t.Errorf("Results() = %v, want the results to be drained", results)
+	}
+}
+
+func TestBackgroundWatchNotifiesUser(t *testing.T) {
+	notified := make(chan BackgroundResult, 1)
+	background := NewBackgroundTasks(context.Background()).
+		WithNotifier(func(result BackgroundResult) { notified <- result })
+	defer background.Stop()
+
+	tool := NewK8sWatchTool(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), newTestResolver()).
+		WithBackgroundTasks(background)
+
+	toolCall := &llms.ToolCall{ID: "call_1", FunctionCall: &llms.FunctionCall{Name: tool.Name(),
+		Arguments: `{"kind":"pods","namespace":"default","timeoutSeconds":1,"background":true}`}}
+	if response, ok := tool.Call(context.Background(), toolCall); !ok {
+		t.Fatalf("Call() = %s, want the watch to start", response.Content)
+	}
+
+	select {
+	case result := <-notified:
+		if !strings.Contains(result.Summary, "The background watch of pods (tool-call call_1) ended") {
+			t.Errorf("notified of %q, want the summary of the watch", result.Summary)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the user was not notified when the background watch ended")
+	}
+}
@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+// accessReviewer runs SelfSubjectAccessReviews on behalf of the identity the
+// tools act as.
+type accessReviewer struct {
+	client authorizationv1client.AuthorizationV1Interface
+}
+
+// checkAccess returns an error if the identity is not allowed to perform verb
+// on the given resource. A nil reviewer allows everything, leaving the
+// decision to the API server.
+func (r *accessReviewer) checkAccess(ctx context.Context, verb string, gvr schema.GroupVersionResource,
+	subresource, namespace, name string) error {
+	if r == nil || r.client == nil {
+		return nil
+	}
+
+	review, err := r.client.SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        verb,
+				Group:       gvr.Group,
+				Version:     gvr.Version,
+				Resource:    gvr.Resource,
+				Subresource: subresource,
+				Name:        name,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to review access: %w", err)
+	}
+
+	if review.Status.Allowed {
+		return nil
+	}
+
+	resource := gvr.GroupResource().String()
+	if subresource != "" {
+		resource += "/" + subresource
+	}
+
+	scope := "cluster-wide"
+	if namespace != metav1.NamespaceNone {
+		scope = "in namespace " + namespace
+	}
+
+	if review.Status.Reason != "" {
+		return fmt.Errorf("not allowed to %s %s %s: %s", verb, resource, scope, review.Status.Reason)
+	}
+
+	return fmt.Errorf("not allowed to %s %s %s", verb, resource, scope)
+}
@@ -11,7 +11,10 @@ import (
 	crd_discovery "github.com/kube-agent/kuery/pkg/crd-discovery"
 )
 
-var _ api.Tool = &K8sAPIDiscoveryTool{}
+var (
+	_ api.Tool    = &K8sAPIDiscoveryTool{}
+	_ api.Mutator = &K8sAPIDiscoveryTool{}
+)
 
 // K8sAPIDiscoveryTool is a tool that interacts with a vector-db of discovered APIs.
 type K8sAPIDiscoveryTool struct {
@@ -97,3 +100,6 @@ func (t *K8sAPIDiscoveryTool) RequiresExplaining() bool {
 // RequiresApproval returns whether the tool requires approval before
 // execution.
 func (t *K8sAPIDiscoveryTool) RequiresApproval() bool { return false }
+
+// Mutates returns whether the tool call may modify the cluster.
+func (t *K8sAPIDiscoveryTool) Mutates(_ *llms.ToolCall) bool { return false }
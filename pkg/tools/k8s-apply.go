@@ -0,0 +1,645 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kube-agent/kuery/pkg/tools/api"
+
+	"github.com/tmc/langchaingo/llms"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+const (
+	// crdEstablishedTimeout is how long objects of a CRD in the manifests wait
+	// for it to be established before they are applied.
+	crdEstablishedTimeout = time.Minute
+	// crdEstablishedInterval is how often an applied CRD is checked for being
+	// established.
+	crdEstablishedInterval = time.Second
+)
+
+var (
+	_ api.Tool             = &K8sApplyTool{}
+	_ api.Mutator          = &K8sApplyTool{}
+	_ api.PreflightChecker = &K8sApplyTool{}
+	_ api.Describer        = &K8sApplyTool{}
+	_ api.PolicyTargeter   = &K8sApplyTool{}
+)
+
+// K8sApplyTool is a tool that server-side applies multi-document YAML
+// manifests, such as the setup manifests of operators.
+type K8sApplyTool struct {
+	client   dynamic.Interface
+	resolver *ResourceResolver
+	access   *accessReviewer
+}
+
+// NewK8sApplyTool creates a new K8sApplyTool.
+func NewK8sApplyTool(client dynamic.Interface, resolver *ResourceResolver) *K8sApplyTool {
+	return &K8sApplyTool{
+		client:   client,
+		resolver: resolver,
+	}
+}
+
+// WithAccessReview enables RBAC pre-flight checks of the applied documents
+// using SelfSubjectAccessReviews.
+func (t *K8sApplyTool) WithAccessReview(client authorizationv1client.AuthorizationV1Interface) *K8sApplyTool {
+	t.access = &accessReviewer{client: client}
+	return t
+}
+
+func (t *K8sApplyTool) Name() string {
+	return "K8sApplyManifests"
+}
+
+func (t *K8sApplyTool) LLMTool() *llms.Tool {
+	desc := `Server-side apply a multi-document YAML manifest to the Kubernetes cluster, like 'kubectl apply'.
+			Use this tool to install operators from their setup manifests (e.g. Subscription, OperatorGroup),
+			or to create several related resources at once. Namespaces and CRDs are applied first, and the
+			objects of a CRD are applied once it is established.
+			All documents are validated with a dry-run before anything is applied.`
+
+	return &llms.Tool{
+		Type: functionToolType,
+		Function: &llms.FunctionDefinition{
+			Name:        t.Name(),
+			Description: api.AddApprovalRequirementToDescription(t, desc),
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"manifests": map[string]any{
+						"type": "string",
+						"description": `The YAML documents to apply, separated by '---'. Every document must include
+										apiVersion, kind and metadata.name.`,
+					},
+					"namespace": map[string]any{
+						"type":        "string",
+						"description": `The namespace of namespaced documents that do not specify one.`,
+					},
+					"force": map[string]any{
+						"type": "boolean",
+						"description": `Whether to take ownership of fields managed by other field managers.
+										Only set it if the user explicitly agreed to override the conflicting changes.`,
+					},
+				},
+				"required": []string{"manifests", "namespace"},
+			},
+		},
+	}
+}
+
+type applyCallArgs struct {
+	Manifests string `json:"manifests"`
+	Namespace string `json:"namespace"`
+	Force     bool   `json:"force"`
+}
+
+// manifestDocument is a document of the applied manifests.
+type manifestDocument struct {
+	index int // 1-based position in the manifests
+	obj   *unstructured.Unstructured
+	// resource is set once the document's type is resolved.
+	resource *ResolvedResource
+	// result describes the outcome of applying the document.
+	result string
+}
+
+func (d *manifestDocument) String() string {
+	name := d.obj.GetName()
+	if d.obj.GetNamespace() != "" {
+		name = d.obj.GetNamespace() + "/" + name
+	}
+
+	return fmt.Sprintf("[%d] %s %s", d.index, d.obj.GetKind(), name)
+}
+
+func (t *K8sApplyTool) Call(ctx context.Context, toolCall *llms.ToolCall) (llms.ToolCallResponse, bool) {
+	var args applyCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to unmarshal arguments: %v", err),
+		}, false
+	}
+
+	docs, err := parseManifests(args.Manifests)
+	if err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to parse manifests: %v", err),
+		}, false
+	}
+
+	err = t.apply(ctx, docs, args)
+	report := applyReport(docs)
+	if err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to apply manifests: %v\n%s", err, report),
+		}, false
+	}
+
+	return llms.ToolCallResponse{
+		ToolCallID: toolCall.ID,
+		Name:       toolCall.FunctionCall.Name,
+		Content:    report,
+	}, true
+}
+
+// RequiresExplaining returns whether the tool requires explaining after
+// execution.
+func (t *K8sApplyTool) RequiresExplaining() bool {
+	return true
+}
+
+// RequiresApproval returns whether the tool requires approval before
+// execution.
+func (t *K8sApplyTool) RequiresApproval() bool { return true }
+
+// Mutates returns whether the tool call may modify the cluster.
+func (t *K8sApplyTool) Mutates(_ *llms.ToolCall) bool { return true }
+
+// Preflight checks that the identity the tool acts as is allowed to apply
+// every document whose type is already known to the cluster: to patch it, and
+// to create it unless it exists.
+func (t *K8sApplyTool) Preflight(ctx context.Context, toolCall *llms.ToolCall) error {
+	var args applyCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return nil // reported by Call
+	}
+
+	docs, err := parseManifests(args.Manifests)
+	if err != nil {
+		return nil // reported by Call
+	}
+
+	for _, doc := range docs {
+		if err := t.resolve(doc, args.Namespace); err != nil {
+			continue // may be defined by a CRD in the manifests
+		}
+
+		if err := t.access.checkAccess(ctx, "patch", doc.resource.GVR, "", doc.obj.GetNamespace(),
+			doc.obj.GetName()); err != nil {
+			return fmt.Errorf("%s: %w", doc, err)
+		}
+
+		if t.exists(ctx, doc) {
+			continue
+		}
+
+		// applying an object that does not exist creates it
+		if err := t.access.checkAccess(ctx, "create", doc.resource.GVR, "", doc.obj.GetNamespace(),
+			""); err != nil {
+			return fmt.Errorf("%s: %w", doc, err)
+		}
+	}
+
+	return nil
+}
+
+// exists returns whether the resolved document exists in the cluster. Documents
+// whose existence cannot be determined are considered not to exist.
+func (t *K8sApplyTool) exists(ctx context.Context, doc *manifestDocument) bool {
+	if t.client == nil {
+		return false
+	}
+
+	var resource dynamic.ResourceInterface = t.client.Resource(doc.resource.GVR)
+	if doc.resource.Namespaced {
+		resource = t.client.Resource(doc.resource.GVR).Namespace(doc.obj.GetNamespace())
+	}
+
+	_, err := resource.Get(ctx, doc.obj.GetName(), metav1.GetOptions{})
+	return err == nil
+}
+
+// PolicyTargets returns every document of the manifests, in the namespace it
+// is applied to, for policies to match on as an APPLY operation. The resources
+// of documents whose kind is not known to the cluster yet (e.g., defined by a
+// CRD in the manifests) are guessed from their kind.
+func (t *K8sApplyTool) PolicyTargets(toolCall *llms.ToolCall) ([]api.PolicyTarget, error) {
+	var args applyCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+
+	docs, err := parseManifests(args.Manifests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifests: %w", err)
+	}
+
+	targets := make([]api.PolicyTarget, 0, len(docs))
+	for _, doc := range docs {
+		var gvr schema.GroupVersionResource
+		if err := t.resolve(doc, args.Namespace); err == nil {
+			gvr = doc.resource.GVR
+		} else {
+			gvr, _ = meta.UnsafeGuessKindToResource(doc.obj.GroupVersionKind())
+			if doc.obj.GetNamespace() == "" && applyPriority(doc.obj) == 2 { // namespaced, most likely
+				doc.obj.SetNamespace(defaultNamespace(args.Namespace))
+			}
+		}
+
+		targets = append(targets, api.PolicyTarget{
+			Operation: "APPLY",
+			Group:     gvr.Group,
+			Version:   gvr.Version,
+			Resource:  gvr.Resource,
+			Namespace: doc.obj.GetNamespace(),
+			Name:      doc.obj.GetName(),
+			Kind:      doc.obj.GetKind(),
+		})
+	}
+
+	return targets, nil
+}
+
+// Describe renders the tool call as a diff between the live state and a
+// server-side dry-run of every document that can be dry-run.
+func (t *K8sApplyTool) Describe(ctx context.Context, toolCall *llms.ToolCall) (string, error) {
+	var args applyCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return "", fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+
+	docs, err := parseManifests(args.Manifests)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse manifests: %w", err)
+	}
+
+	var description strings.Builder
+	fmt.Fprintf(&description, "%s: %d documents\n", t.Name(), len(docs))
+
+	for _, doc := range docs {
+		description.WriteString(doc.String() + "\n")
+
+		diff, err := t.diff(ctx, doc, docs, args)
+		if err != nil {
+			fmt.Fprintf(&description, "(no preview: %v)\n", err)
+			continue
+		}
+
+		description.WriteString(diff)
+	}
+
+	return description.String(), nil
+}
+
+// parseManifests parses multi-document YAML (or JSON) manifests into their
+// documents, in order of application.
+func parseManifests(manifests string) ([]*manifestDocument, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(strings.NewReader(manifests), 4096)
+
+	var docs []*manifestDocument
+	for index := 1; ; index++ {
+		var obj map[string]any
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, fmt.Errorf("document %d: %w", index, err)
+		}
+
+		if len(obj) == 0 { // empty document
+			index--
+			continue
+		}
+
+		doc := &manifestDocument{index: index, obj: &unstructured.Unstructured{Object: obj}}
+		if doc.obj.GetAPIVersion() == "" || doc.obj.GetKind() == "" || doc.obj.GetName() == "" {
+			return nil, fmt.Errorf("document %d: apiVersion, kind and metadata.name are required", index)
+		}
+
+		docs = append(docs, doc)
+	}
+
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no documents found")
+	}
+
+	// namespaces and CRDs are applied first since other documents may depend on them
+	slices.SortStableFunc(docs, func(a, b *manifestDocument) int {
+		return applyPriority(a.obj) - applyPriority(b.obj)
+	})
+
+	return docs, nil
+}
+
+// applyPriority returns the order in which a document is applied, lowest first.
+func applyPriority(obj *unstructured.Unstructured) int {
+	switch obj.GroupVersionKind().GroupKind() {
+	case schema.GroupKind{Kind: "Namespace"}:
+		return 0
+	case schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// apply validates all documents with a dry-run, and only if all pass, applies
+// them in order. Documents that depend on namespaces or CRDs created by the
+// manifests cannot be dry-run before those are applied, and are validated on
+// application, once the CRDs are established. Applying stops at the first
+// failure, leaving the documents applied before it in place.
+func (t *K8sApplyTool) apply(ctx context.Context, docs []*manifestDocument, args applyCallArgs) error {
+	if t.client == nil || t.resolver == nil {
+		return fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	failed := false
+	for _, doc := range docs {
+		resolveErr := t.resolve(doc, args.Namespace) // may fail for kinds of CRDs in the manifests
+		if dependsOnManifests(doc, docs, args.Namespace) {
+			doc.result = "not validated, depends on a namespace or CRD in the manifests"
+			continue
+		}
+
+		if resolveErr != nil {
+			doc.result = resolveErr.Error()
+			failed = true
+			continue
+		}
+
+		if _, err := t.applyDocument(ctx, doc, args.Force, []string{metav1.DryRunAll}); err != nil {
+			doc.result = "dry-run failed: " + err.Error()
+			failed = true
+			continue
+		}
+
+		doc.result = "dry-run succeeded"
+	}
+
+	if failed {
+		for _, doc := range docs {
+			doc.result += ", not applied"
+		}
+
+		return fmt.Errorf("validation failed, nothing was applied")
+	}
+
+	var applied []string
+	for idx, doc := range docs {
+		err := t.resolve(doc, args.Namespace)
+		if err == nil {
+			_, err = t.applyDocument(ctx, doc, args.Force, nil)
+		}
+
+		if err == nil {
+			doc.result = "applied"
+			applied = append(applied, doc.String())
+
+			switch {
+			case applyPriority(doc.obj) != 1:
+			case definesKindOf(doc, docs[idx+1:]):
+				if err = t.waitForEstablished(ctx, doc); err != nil {
+					err = fmt.Errorf("%w, the documents of its kinds were not applied", err)
+				}
+			default:
+				t.resolver.Invalidate() // make the new resources resolvable
+			}
+		}
+
+		if err != nil {
+			if doc.result == "applied" {
+				doc.result += ", but " + err.Error()
+			} else {
+				doc.result = "failed: " + err.Error()
+			}
+			for _, remaining := range docs[idx+1:] {
+				remaining.result = "not applied"
+			}
+
+			if len(applied) == 0 {
+				return fmt.Errorf("stopped applying at %s, nothing was applied", doc)
+			}
+
+			return fmt.Errorf("stopped applying at %s, the documents applied so far remain applied: %s", doc,
+				strings.Join(applied, ", "))
+		}
+	}
+
+	return nil
+}
+
+// waitForEstablished waits for the applied CRD to be established, so that
+// objects of its kinds can be applied, and makes its resources resolvable.
+func (t *K8sApplyTool) waitForEstablished(ctx context.Context, crd *manifestDocument) error {
+	var reason string
+	err := wait.PollUntilContextTimeout(ctx, crdEstablishedInterval, crdEstablishedTimeout, true,
+		func(ctx context.Context) (bool, error) {
+			live, err := t.client.Resource(crd.resource.GVR).Get(ctx, crd.obj.GetName(), metav1.GetOptions{})
+			if err != nil { // e.g., not visible yet
+				reason = err.Error()
+				return false, nil
+			}
+
+			conditions, _, _ := unstructured.NestedSlice(live.Object, "status", "conditions")
+			for _, condition := range conditions {
+				condition, _ := condition.(map[string]any)
+				switch {
+				case condition["type"] == "NamesAccepted" && condition["status"] == "False":
+					return false, fmt.Errorf("its names were not accepted: %v", condition["message"])
+				case condition["type"] == "Established" && condition["status"] == "True":
+					return true, nil
+				case condition["type"] == "Established":
+					reason = fmt.Sprint(condition["message"])
+				}
+			}
+
+			return false, nil
+		})
+	if wait.Interrupted(err) {
+		if reason == "" {
+			reason = "no Established condition"
+		}
+
+		return fmt.Errorf("it was not established: %s", reason)
+	}
+	if err != nil {
+		return err
+	}
+
+	t.resolver.Invalidate() // make the new resources resolvable for the following documents
+	return nil
+}
+
+// resolve resolves the resource of the document, and defaults its namespace if
+// it is namespaced.
+func (t *K8sApplyTool) resolve(doc *manifestDocument, namespace string) error {
+	if doc.resource != nil {
+		return nil
+	}
+
+	if t.resolver == nil {
+		return fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	resource, err := t.resolver.Resolve(doc.obj.GetAPIVersion(), doc.obj.GetKind())
+	if err != nil {
+		return err
+	}
+
+	if resource.Namespaced && doc.obj.GetNamespace() == "" {
+		doc.obj.SetNamespace(defaultNamespace(namespace))
+	} else if !resource.Namespaced {
+		doc.obj.SetNamespace(metav1.NamespaceNone)
+	}
+
+	doc.resource = resource
+	return nil
+}
+
+// defaultNamespace returns the namespace of namespaced documents that do not
+// specify one.
+func defaultNamespace(namespace string) string {
+	if namespace == "" {
+		return metav1.NamespaceDefault
+	}
+
+	return namespace
+}
+
+// applyDocument server-side applies a resolved document.
+func (t *K8sApplyTool) applyDocument(ctx context.Context, doc *manifestDocument, force bool,
+	dryRun []string) (*unstructured.Unstructured, error) {
+	var resource dynamic.ResourceInterface = t.client.Resource(doc.resource.GVR)
+	if doc.resource.Namespaced {
+		resource = t.client.Resource(doc.resource.GVR).Namespace(doc.obj.GetNamespace())
+	}
+
+	obj, err := resource.Apply(ctx, doc.obj.GetName(), doc.obj,
+		metav1.ApplyOptions{FieldManager: fieldManager, Force: force, DryRun: dryRun})
+	if apierrors.IsConflict(err) {
+		return nil, fmt.Errorf("fields are managed by another field manager, "+
+			"ask the user whether to force the apply: %w", err)
+	}
+
+	return obj, err
+}
+
+// diff returns the diff between the live document and its dry-run apply.
+func (t *K8sApplyTool) diff(ctx context.Context, doc *manifestDocument, docs []*manifestDocument,
+	args applyCallArgs) (string, error) {
+	resolveErr := t.resolve(doc, args.Namespace)
+	if dependsOnManifests(doc, docs, args.Namespace) {
+		return "", fmt.Errorf("depends on a namespace or CRD in the manifests")
+	}
+
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+
+	var resource dynamic.ResourceInterface = t.client.Resource(doc.resource.GVR)
+	if doc.resource.Namespaced {
+		resource = t.client.Resource(doc.resource.GVR).Namespace(doc.obj.GetNamespace())
+	}
+
+	live, err := resource.Get(ctx, doc.obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		live = nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get live resource: %w", err)
+	}
+
+	dryRun, err := t.applyDocument(ctx, doc, args.Force, []string{metav1.DryRunAll})
+	if err != nil {
+		return "", fmt.Errorf("dry-run failed: %w", err)
+	}
+
+	liveYAML, err := diffableYAML(live)
+	if err != nil {
+		return "", err
+	}
+
+	dryRunYAML, err := diffableYAML(dryRun)
+	if err != nil {
+		return "", err
+	}
+
+	diff := unifiedDiff(liveYAML, dryRunYAML, "live", "APPLY (dry-run)")
+	if diff == "" {
+		return "(no changes)\n", nil
+	}
+
+	return diff, nil
+}
+
+// definesKindOf returns whether the CRD document defines the kind of any of
+// the documents.
+func definesKindOf(crd *manifestDocument, docs []*manifestDocument) bool {
+	return slices.ContainsFunc(docs, func(doc *manifestDocument) bool { return definesKind(crd, doc) })
+}
+
+// definesKind returns whether the CRD document defines the kind of the
+// document.
+func definesKind(crd, doc *manifestDocument) bool {
+	group, _, _ := unstructured.NestedString(crd.obj.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.obj.Object, "spec", "names", "kind")
+
+	gvk := doc.obj.GroupVersionKind()
+	return gvk.Group == group && gvk.Kind == kind
+}
+
+// dependsOnManifests returns whether the document is in a namespace, or of a
+// kind, that is created by one of the documents. Unresolved documents without
+// a namespace are considered to be in the default namespace of the call.
+func dependsOnManifests(doc *manifestDocument, docs []*manifestDocument, namespace string) bool {
+	if doc.obj.GetNamespace() != "" {
+		namespace = doc.obj.GetNamespace()
+	}
+
+	if (doc.resource != nil && !doc.resource.Namespaced) || applyPriority(doc.obj) < 2 {
+		namespace = metav1.NamespaceNone // cluster-scoped
+	}
+
+	for _, other := range docs {
+		switch applyPriority(other.obj) {
+		case 0:
+			if namespace != metav1.NamespaceNone && namespace == other.obj.GetName() {
+				return true
+			}
+		case 1:
+			if definesKind(other, doc) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// applyReport renders the per-document results.
+func applyReport(docs []*manifestDocument) string {
+	var report strings.Builder
+	for _, doc := range docs {
+		fmt.Fprintf(&report, "%s: %s\n", doc, doc.result)
+	}
+
+	return report.String()
+}
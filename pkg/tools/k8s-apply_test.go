@@ -0,0 +1,256 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kube-agent/kuery/pkg/tools/api"
+	"github.com/tmc/langchaingo/llms"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// applyToolCall returns a call of K8sApplyManifests.
+func applyToolCall(namespace, manifests string) *llms.ToolCall {
+	arguments, _ := json.Marshal(applyCallArgs{Manifests: manifests, Namespace: namespace})
+	return &llms.ToolCall{FunctionCall: &llms.FunctionCall{Name: "K8sApplyManifests", Arguments: string(arguments)}}
+}
+
+func TestApplyPolicyEvaluatesEveryDocument(t *testing.T) {
+	policy := &api.Policy{Rules: []api.PolicyRule{
+		{Namespaces: []string{"kube-system"}, Action: api.PolicyActionDeny, Reason: "system namespace"},
+		{Resources: []string{"secrets"}, Action: api.PolicyActionDeny, Reason: "no secrets"},
+		{Action: api.PolicyActionAllow},
+	}}
+
+	tool := NewK8sApplyTool(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), newTestResolver())
+	mgr := api.NewToolManager().WithPolicy(policy).WithTool(tool, 2)
+
+	for manifests, want := range map[string]string{
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\n" +
+			"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n  namespace: kube-system\n": "system namespace",
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\n" +
+			"apiVersion: v1\nkind: Secret\nmetadata:\n  name: b\n": "no secrets",
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n": "",
+	} {
+		err := mgr.Preflight(context.Background(), applyToolCall("default", manifests))
+		switch {
+		case want == "" && err != nil:
+			t.Errorf("Preflight(%q) = %v, want nil", manifests, err)
+		case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+			t.Errorf("Preflight(%q) = %v, want denied with %q", manifests, err, want)
+		}
+	}
+}
+
+func TestApplyPreflightChecksCreate(t *testing.T) {
+	existing := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": "existing", "namespace": "default"},
+	}}
+
+	kubeClient := fake.NewSimpleClientset()
+	kubeClient.PrependReactor("create", "selfsubjectaccessreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			review.Status.Allowed = review.Spec.ResourceAttributes.Verb == "patch" // patch only
+			return true, review, nil
+		})
+
+	tool := NewK8sApplyTool(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existing), newTestResolver()).
+		WithAccessReview(kubeClient.AuthorizationV1())
+
+	manifests := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: existing\n"
+	if err := tool.Preflight(context.Background(), applyToolCall("default", manifests)); err != nil {
+		t.Errorf("Preflight(existing) = %v, want nil", err)
+	}
+
+	manifests = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: new\n"
+	err := tool.Preflight(context.Background(), applyToolCall("default", manifests))
+	if err == nil || !strings.Contains(err.Error(), "not allowed to create") {
+		t.Errorf("Preflight(new) = %v, want not allowed to create", err)
+	}
+}
+
+// applyServer is an API server that server-side applies documents, failing
+// those named broken, and serves the widgets CRD once applied, established
+// after established GETs.
+type applyServer struct {
+	established int
+
+	mu      sync.Mutex
+	applied []string
+	crdGets int
+}
+
+func (s *applyServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case req.Method == http.MethodPatch && strings.HasSuffix(req.URL.Path, "/broken") &&
+		req.URL.Query().Get("dryRun") == "":
+		status := apierrors.NewInternalError(fmt.Errorf("webhook denied the request")).Status()
+		status.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Status"}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(status)
+	case req.Method == http.MethodPatch:
+		if req.URL.Query().Get("dryRun") == "" {
+			s.applied = append(s.applied, req.URL.Path)
+		}
+		_, _ = io.Copy(w, req.Body)
+	case req.Method == http.MethodGet && strings.HasSuffix(req.URL.Path, "/widgets.example.com"):
+		s.crdGets++
+		s.applied = append(s.applied, fmt.Sprintf("GET CRD %d", s.crdGets))
+
+		status := "False"
+		if s.established > 0 && s.crdGets >= s.established {
+			status = "True"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind":       "CustomResourceDefinition",
+			"metadata":   map[string]any{"name": "widgets.example.com"},
+			"status": map[string]any{"conditions": []any{
+				map[string]any{"type": "NamesAccepted", "status": "True"},
+				map[string]any{"type": "Established", "status": status, "message": "installing"},
+			}},
+		})
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// newApplyServerTool returns a K8sApplyTool applying to the server, whose
+// resolver knows about CRDs and widgets.
+func newApplyServerTool(t *testing.T, server *applyServer) *K8sApplyTool {
+	t.Helper()
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	client, err := dynamic.NewForConfig(&rest.Config{Host: httpServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kubeClient := fake.NewSimpleClientset()
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = append(slices.Clone(testAPIResources),
+		&metav1.APIResourceList{GroupVersion: "apiextensions.k8s.io/v1", APIResources: []metav1.APIResource{{
+			Name: "customresourcedefinitions", SingularName: "customresourcedefinition",
+			Kind: "CustomResourceDefinition"}}},
+		&metav1.APIResourceList{GroupVersion: "example.com/v1", APIResources: []metav1.APIResource{{
+			Name: "widgets", SingularName: "widget", Namespaced: true, Kind: "Widget"}}},
+	)
+
+	return NewK8sApplyTool(client, NewResourceResolver(kubeClient.Discovery()))
+}
+
+const widgetsCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names: {kind: Widget, plural: widgets}
+  scope: Namespaced
+`
+
+func TestApplyWaitsForCRDsToBeEstablished(t *testing.T) {
+	server := &applyServer{established: 2}
+	tool := newApplyServerTool(t, server)
+
+	manifests := "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w1\n---\n" + widgetsCRD
+	response, ok := tool.Call(context.Background(), applyToolCall("default", manifests))
+	if !ok {
+		t.Fatalf("Call() failed: %s", response.Content)
+	}
+
+	want := []string{
+		"/apis/apiextensions.k8s.io/v1/customresourcedefinitions/widgets.example.com",
+		"GET CRD 1",
+		"GET CRD 2", // established
+		"/apis/example.com/v1/namespaces/default/widgets/w1",
+	}
+	if !slices.Equal(server.applied, want) {
+		t.Errorf("the server was requested %q, want %q", server.applied, want)
+	}
+}
+
+func TestApplyStopsWhenCRDIsNotEstablished(t *testing.T) {
+	server := &applyServer{} // never established
+	tool := newApplyServerTool(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	manifests := widgetsCRD + "---\napiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w1\n"
+	response, ok := tool.Call(ctx, applyToolCall("default", manifests))
+	if ok || !strings.Contains(response.Content, "CustomResourceDefinition widgets.example.com: applied, but it was "+
+		"not established: installing, the documents of its kinds were not applied") ||
+		!strings.Contains(response.Content, "Widget default/w1: not applied") {
+		t.Errorf("Call() = %s, want the widget not applied", response.Content)
+	}
+
+	for _, path := range server.applied {
+		if strings.Contains(path, "widgets/w1") {
+			t.Errorf("the widget was applied before its CRD was established")
+		}
+	}
+}
+
+func TestApplyReportsDocumentsAppliedBeforeFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name, manifests, want string
+	}{
+		{
+			name: "after other documents",
+			manifests: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: prod\n---\n" +
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: broken\n  namespace: prod\n---\n" +
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: c\n  namespace: prod\n---\n" +
+				"apiVersion: v1\nkind: Namespace\nmetadata:\n  name: prod\n",
+			want: "failed to apply manifests: stopped applying at [2] ConfigMap prod/broken, the documents " +
+				"applied so far remain applied: [4] Namespace prod, [1] ConfigMap prod/a\n" +
+				"[4] Namespace prod: applied\n" +
+				"[1] ConfigMap prod/a: applied\n" +
+				"[2] ConfigMap prod/broken: failed: Internal error occurred: webhook denied the request\n" +
+				"[3] ConfigMap prod/c: not applied\n",
+		},
+		{
+			name: "first document",
+			manifests: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: broken\n---\n" +
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n",
+			want: "stopped applying at [1] ConfigMap default/broken, nothing was applied",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tool := newApplyServerTool(t, &applyServer{})
+
+			response, ok := tool.Call(context.Background(), applyToolCall("default", tc.manifests))
+			if ok || !strings.Contains(response.Content, tc.want) {
+				t.Errorf("Call() =\n%s\nwant\n%s", response.Content, tc.want)
+			}
+		})
+	}
+}
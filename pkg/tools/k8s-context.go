@@ -0,0 +1,147 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kube-agent/kuery/pkg/tools/api"
+
+	"github.com/fatih/color"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ClusterSwitcher lists the clusters a session can operate on, and switches
+// the cluster its tools target.
+type ClusterSwitcher interface {
+	// Clusters returns the names of the clusters.
+	Clusters() []string
+	// Cluster returns the name of the active cluster.
+	Cluster() string
+	// SwitchCluster makes the cluster with the given name the active one.
+	SwitchCluster(name string) error
+}
+
+var (
+	_ api.Tool    = &K8sContextTool{}
+	_ api.Mutator = &K8sContextTool{}
+)
+
+// K8sContextTool is a tool that lists the clusters (kubeconfig contexts)
+// Kuery can operate on, and switches between them.
+type K8sContextTool struct {
+	switcher ClusterSwitcher
+}
+
+// NewK8sContextTool creates a new K8sContextTool.
+func NewK8sContextTool(switcher ClusterSwitcher) *K8sContextTool {
+	return &K8sContextTool{
+		switcher: switcher,
+	}
+}
+
+func (t *K8sContextTool) Name() string {
+	return "K8sContext"
+}
+
+func (t *K8sContextTool) LLMTool() *llms.Tool {
+	desc := `List the Kubernetes clusters (kubeconfig contexts) you can operate on, or switch the cluster all
+			Kubernetes tools target. Always make sure you operate on the cluster the user means, and never switch
+			clusters without telling the user.`
+
+	return &llms.Tool{
+		Type: functionToolType,
+		Function: &llms.FunctionDefinition{
+			Name:        t.Name(),
+			Description: api.AddApprovalRequirementToDescription(t, desc),
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"operation": map[string]any{
+						"type": "string",
+						"description": `The operation to perform: LIST, SWITCH
+										LIST: List the clusters and which one is active.
+										SWITCH: Make the cluster with the given name the active one.`,
+					},
+					"name": map[string]any{
+						"type":        "string",
+						"description": `The name of the cluster to SWITCH to.`,
+					},
+				},
+				"required": []string{"operation"},
+			},
+		},
+	}
+}
+
+func (t *K8sContextTool) Call(_ context.Context, toolCall *llms.ToolCall) (llms.ToolCallResponse, bool) {
+	var args struct {
+		Operation string `json:"operation"`
+		Name      string `json:"name"`
+	}
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to unmarshal arguments: %v", err),
+		}, false
+	}
+
+	switch args.Operation {
+	case "LIST":
+		var clusters strings.Builder
+		for _, name := range t.switcher.Clusters() {
+			if name == t.switcher.Cluster() {
+				fmt.Fprintf(&clusters, "* %s (active)\n", name)
+			} else {
+				fmt.Fprintf(&clusters, "  %s\n", name)
+			}
+		}
+
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    clusters.String(),
+		}, true
+	case "SWITCH":
+		previous := t.switcher.Cluster()
+		if err := t.switcher.SwitchCluster(args.Name); err != nil {
+			return llms.ToolCallResponse{
+				ToolCallID: toolCall.ID,
+				Name:       toolCall.FunctionCall.Name,
+				Content:    fmt.Sprintf("failed to switch cluster: %v", err),
+			}, false
+		}
+
+		color.New(color.FgHiRed, color.Bold).Printf("Switched from cluster %s to cluster %s\n", previous, args.Name)
+
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content: fmt.Sprintf("switched from cluster %s to cluster %s, approvals given on %s do not hold on %s",
+				previous, args.Name, previous, args.Name),
+		}, true
+	default:
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("unknown operation: %v", args.Operation),
+		}, false
+	}
+}
+
+// RequiresExplaining returns whether the tool requires explaining after
+// execution.
+func (t *K8sContextTool) RequiresExplaining() bool {
+	return true
+}
+
+// RequiresApproval returns whether the tool requires approval before
+// execution.
+func (t *K8sContextTool) RequiresApproval() bool { return false }
+
+// Mutates returns whether the tool call may modify the cluster. Switching
+// clusters only changes the cluster the session targets.
+func (t *K8sContextTool) Mutates(_ *llms.ToolCall) bool { return false }
@@ -0,0 +1,684 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kube-agent/kuery/pkg/tools/api"
+
+	"github.com/tmc/langchaingo/llms"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// maxDiagnosedPods is the maximum number of pods inspected per diagnosis.
+	maxDiagnosedPods = 20
+	// maxDiagnosedEvents is the maximum number of events included in a
+	// diagnosis, warnings first.
+	maxDiagnosedEvents = 25
+	// maxListedEvents is the maximum number of events listed per diagnosed
+	// object.
+	maxListedEvents = 100
+	// revisionAnnotation holds the rollout revision of Deployments'
+	// ReplicaSets.
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+)
+
+// problematicWaitingReasons are container waiting reasons that indicate a
+// problem rather than a normal start-up.
+var problematicWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+}
+
+var (
+	_ api.Tool    = &K8sDiagnoseTool{}
+	_ api.Mutator = &K8sDiagnoseTool{}
+)
+
+// K8sDiagnoseTool is a tool that gathers the state of a workload, its owner
+// chain, pods, events and nodes into a findings report.
+type K8sDiagnoseTool struct {
+	client kubernetes.Interface
+}
+
+// NewK8sDiagnoseTool creates a new K8sDiagnoseTool.
+func NewK8sDiagnoseTool(client kubernetes.Interface) *K8sDiagnoseTool {
+	return &K8sDiagnoseTool{
+		client: client,
+	}
+}
+
+func (t *K8sDiagnoseTool) Name() string {
+	return "K8sDiagnose"
+}
+
+func (t *K8sDiagnoseTool) LLMTool() *llms.Tool {
+	desc := `Diagnose a workload in the Kubernetes cluster: gathers its owner chain (e.g., Deployment, ReplicaSets, Pods),
+			container statuses (e.g., CrashLoopBackOff, OOMKilled, ImagePullBackOff), pending reasons, events and the
+			conditions of the nodes it runs on, and returns a findings report.
+			Use this tool first when the user asks why something is not working, instead of listing resources one by one.`
+
+	return &llms.Tool{
+		Type: functionToolType,
+		Function: &llms.FunctionDefinition{
+			Name:        t.Name(),
+			Description: api.AddApprovalRequirementToDescription(t, desc),
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"kind": map[string]any{
+						"type":        "string",
+						"description": `The kind of the workload.`,
+						"enum":        []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Pod"},
+					},
+					"name": map[string]any{
+						"type":        "string",
+						"description": `The name of the workload.`,
+					},
+					"namespace": map[string]any{
+						"type":        "string",
+						"description": `The namespace of the workload.`,
+					},
+				},
+				"required": []string{"kind", "name", "namespace"},
+			},
+		},
+	}
+}
+
+type diagnoseCallArgs struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+func (t *K8sDiagnoseTool) Call(ctx context.Context, toolCall *llms.ToolCall) (llms.ToolCallResponse, bool) {
+	var args diagnoseCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to unmarshal arguments: %v", err),
+		}, false
+	}
+
+	report, err := t.diagnose(ctx, args)
+	if err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to diagnose %s %s/%s: %v", args.Kind, args.Namespace, args.Name, err),
+		}, false
+	}
+
+	content, err := yaml.Marshal(report)
+	if err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to marshal the diagnosis: %v", err),
+		}, false
+	}
+
+	return llms.ToolCallResponse{
+		ToolCallID: toolCall.ID,
+		Name:       toolCall.FunctionCall.Name,
+		Content:    string(content),
+	}, true
+}
+
+// RequiresExplaining returns whether the tool requires explaining after
+// execution.
+func (t *K8sDiagnoseTool) RequiresExplaining() bool {
+	return true
+}
+
+// RequiresApproval returns whether the tool requires approval before
+// execution.
+func (t *K8sDiagnoseTool) RequiresApproval() bool { return false }
+
+// Mutates returns whether the tool call may modify the cluster.
+func (t *K8sDiagnoseTool) Mutates(_ *llms.ToolCall) bool { return false }
+
+// diagnosis is the findings report returned to the model.
+type diagnosis struct {
+	Target     string         `json:"target"`
+	OwnerChain []string       `json:"ownerChain"`
+	Findings   []finding      `json:"findings,omitempty"`
+	Pods       []podSummary   `json:"pods,omitempty"`
+	Events     []eventSummary `json:"events,omitempty"`
+	Nodes      []nodeSummary  `json:"nodes,omitempty"`
+	Notes      []string       `json:"notes,omitempty"`
+}
+
+// finding is a single problem found while diagnosing.
+type finding struct {
+	Severity string `json:"severity"`
+	Object   string `json:"object"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message,omitempty"`
+}
+
+type podSummary struct {
+	Name       string   `json:"name"`
+	Phase      string   `json:"phase"`
+	Node       string   `json:"node,omitempty"`
+	Age        string   `json:"age"`
+	Containers []string `json:"containers"`
+}
+
+type eventSummary struct {
+	Age     string `json:"age"`
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+	Object  string `json:"object"`
+	Count   int32  `json:"count,omitempty"`
+	Message string `json:"message"`
+}
+
+type nodeSummary struct {
+	Name       string   `json:"name"`
+	Conditions []string `json:"conditions"`
+}
+
+// diagnoser accumulates a diagnosis.
+type diagnoser struct {
+	client    kubernetes.Interface
+	namespace string
+	report    diagnosis
+	// uids are the objects whose events are included in the diagnosis.
+	uids map[types.UID]bool
+	pods []corev1.Pod
+}
+
+func (d *diagnoser) addFinding(severity, object, reason, message string) {
+	d.report.Findings = append(d.report.Findings, finding{
+		Severity: severity,
+		Object:   object,
+		Reason:   reason,
+		Message:  message,
+	})
+}
+
+// diagnose gathers the diagnosis of the workload addressed by args.
+func (t *K8sDiagnoseTool) diagnose(ctx context.Context, args diagnoseCallArgs) (*diagnosis, error) {
+	if t.client == nil {
+		return nil, fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	d := &diagnoser{
+		client:    t.client,
+		namespace: args.Namespace,
+		report:    diagnosis{Target: fmt.Sprintf("%s %s/%s", args.Kind, args.Namespace, args.Name)},
+		uids:      map[types.UID]bool{},
+	}
+
+	var err error
+	switch strings.ToLower(args.Kind) {
+	case "deployment":
+		err = d.deployment(ctx, args.Name)
+	case "statefulset":
+		err = d.statefulSet(ctx, args.Name)
+	case "daemonset":
+		err = d.daemonSet(ctx, args.Name)
+	case "replicaset":
+		err = d.replicaSet(ctx, args.Name)
+	case "pod":
+		err = d.pod(ctx, args.Name)
+	default:
+		return nil, fmt.Errorf("unsupported kind %q", args.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pod := range d.pods {
+		d.inspectPod(&pod)
+	}
+
+	if err := d.events(ctx); err != nil {
+		d.report.Notes = append(d.report.Notes, fmt.Sprintf("failed to list events: %v", err))
+	}
+
+	d.nodes(ctx)
+
+	if len(d.report.Findings) == 0 {
+		d.report.Notes = append(d.report.Notes, "no problems found")
+	}
+
+	return &d.report, nil
+}
+
+func (d *diagnoser) deployment(ctx context.Context, name string) error {
+	deployment, err := d.client.AppsV1().Deployments(d.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	d.uids[deployment.UID] = true
+	object := "Deployment " + deployment.Name
+	d.report.OwnerChain = append(d.report.OwnerChain, fmt.Sprintf("%s (%d/%d ready, %d updated)", object,
+		deployment.Status.ReadyReplicas, replicas(deployment.Spec.Replicas), deployment.Status.UpdatedReplicas))
+
+	if deployment.Spec.Paused {
+		d.addFinding("warning", object, "Paused", "the rollout is paused")
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		switch {
+		case condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == corev1.ConditionTrue,
+			condition.Type == appsv1.DeploymentAvailable && condition.Status == corev1.ConditionFalse,
+			condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse:
+			d.addFinding("error", object, condition.Reason, condition.Message)
+		}
+	}
+
+	replicaSets, err := d.client.AppsV1().ReplicaSets(d.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list ReplicaSets: %w", err)
+	}
+
+	owned := make([]appsv1.ReplicaSet, 0, len(replicaSets.Items))
+	for _, replicaSet := range replicaSets.Items {
+		if isOwnedBy(replicaSet.OwnerReferences, deployment.UID) {
+			owned = append(owned, replicaSet)
+		}
+	}
+
+	// newest revision first, the old ones only matter while they still have pods
+	sort.Slice(owned, func(i, j int) bool {
+		return revision(&owned[i]) > revision(&owned[j])
+	})
+
+	owners := map[types.UID]bool{}
+	for i, replicaSet := range owned {
+		if i > 0 && replicas(replicaSet.Spec.Replicas) == 0 && replicaSet.Status.Replicas == 0 {
+			continue
+		}
+
+		d.uids[replicaSet.UID] = true
+		owners[replicaSet.UID] = true
+		d.report.OwnerChain = append(d.report.OwnerChain, fmt.Sprintf("  ReplicaSet %s (revision %d, %d/%d ready)",
+			replicaSet.Name, revision(&replicaSet), replicaSet.Status.ReadyReplicas, replicas(replicaSet.Spec.Replicas)))
+		d.replicaSetConditions(&replicaSet)
+	}
+
+	return d.ownedPods(ctx, deployment.Spec.Selector, owners, "    ")
+}
+
+func (d *diagnoser) statefulSet(ctx context.Context, name string) error {
+	statefulSet, err := d.client.AppsV1().StatefulSets(d.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	d.uids[statefulSet.UID] = true
+	object := "StatefulSet " + statefulSet.Name
+	d.report.OwnerChain = append(d.report.OwnerChain, fmt.Sprintf("%s (%d/%d ready, %d updated)", object,
+		statefulSet.Status.ReadyReplicas, replicas(statefulSet.Spec.Replicas), statefulSet.Status.UpdatedReplicas))
+
+	if statefulSet.Status.ReadyReplicas < replicas(statefulSet.Spec.Replicas) {
+		d.addFinding("warning", object, "NotReady", fmt.Sprintf("%d of %d replicas are ready",
+			statefulSet.Status.ReadyReplicas, replicas(statefulSet.Spec.Replicas)))
+	}
+
+	return d.ownedPods(ctx, statefulSet.Spec.Selector, map[types.UID]bool{statefulSet.UID: true}, "  ")
+}
+
+func (d *diagnoser) daemonSet(ctx context.Context, name string) error {
+	daemonSet, err := d.client.AppsV1().DaemonSets(d.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	d.uids[daemonSet.UID] = true
+	object := "DaemonSet " + daemonSet.Name
+	d.report.OwnerChain = append(d.report.OwnerChain, fmt.Sprintf("%s (%d/%d ready, %d updated)", object,
+		daemonSet.Status.NumberReady, daemonSet.Status.DesiredNumberScheduled, daemonSet.Status.UpdatedNumberScheduled))
+
+	if daemonSet.Status.NumberUnavailable > 0 {
+		d.addFinding("warning", object, "Unavailable", fmt.Sprintf("%d of %d pods are unavailable",
+			daemonSet.Status.NumberUnavailable, daemonSet.Status.DesiredNumberScheduled))
+	}
+
+	if daemonSet.Status.NumberMisscheduled > 0 {
+		d.addFinding("warning", object, "Misscheduled", fmt.Sprintf("%d pods run on nodes they should not run on",
+			daemonSet.Status.NumberMisscheduled))
+	}
+
+	return d.ownedPods(ctx, daemonSet.Spec.Selector, map[types.UID]bool{daemonSet.UID: true}, "  ")
+}
+
+func (d *diagnoser) replicaSet(ctx context.Context, name string) error {
+	replicaSet, err := d.client.AppsV1().ReplicaSets(d.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	d.uids[replicaSet.UID] = true
+	d.report.OwnerChain = append(d.report.OwnerChain, fmt.Sprintf("ReplicaSet %s (%d/%d ready)",
+		replicaSet.Name, replicaSet.Status.ReadyReplicas, replicas(replicaSet.Spec.Replicas)))
+	d.replicaSetConditions(replicaSet)
+
+	return d.ownedPods(ctx, replicaSet.Spec.Selector, map[types.UID]bool{replicaSet.UID: true}, "  ")
+}
+
+func (d *diagnoser) replicaSetConditions(replicaSet *appsv1.ReplicaSet) {
+	for _, condition := range replicaSet.Status.Conditions {
+		if condition.Type == appsv1.ReplicaSetReplicaFailure && condition.Status == corev1.ConditionTrue {
+			d.addFinding("error", "ReplicaSet "+replicaSet.Name, condition.Reason, condition.Message)
+		}
+	}
+}
+
+// pod diagnoses a single pod, walking its owner chain up for context.
+func (d *diagnoser) pod(ctx context.Context, name string) error {
+	pod, err := d.client.CoreV1().Pods(d.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	var chain []string
+	owners := pod.OwnerReferences
+	for len(owners) > 0 {
+		owner := controllerOf(owners)
+		if owner == nil {
+			break
+		}
+
+		chain = append([]string{owner.Kind + " " + owner.Name}, chain...)
+		owners = nil
+		if owner.Kind == "ReplicaSet" {
+			replicaSet, err := d.client.AppsV1().ReplicaSets(d.namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+			if err == nil {
+				owners = replicaSet.OwnerReferences
+			}
+		}
+	}
+
+	for i, owner := range chain {
+		d.report.OwnerChain = append(d.report.OwnerChain, strings.Repeat("  ", i)+owner)
+	}
+
+	d.addPod(pod, strings.Repeat("  ", len(chain)))
+
+	return nil
+}
+
+// ownedPods adds the pods matching selector that are controlled by owners.
+func (d *diagnoser) ownedPods(ctx context.Context, selector *metav1.LabelSelector, owners map[types.UID]bool,
+	indent string) error {
+	pods, err := d.client.CoreV1().Pods(d.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(selector),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if owner := controllerOf(pod.OwnerReferences); owner == nil || !owners[owner.UID] {
+			continue
+		}
+
+		if len(d.pods) == maxDiagnosedPods {
+			d.report.Notes = append(d.report.Notes, fmt.Sprintf("only the first %d pods were inspected",
+				maxDiagnosedPods))
+			break
+		}
+
+		d.addPod(pod, indent)
+	}
+
+	return nil
+}
+
+func (d *diagnoser) addPod(pod *corev1.Pod, indent string) {
+	d.uids[pod.UID] = true
+	d.pods = append(d.pods, *pod)
+	d.report.OwnerChain = append(d.report.OwnerChain, fmt.Sprintf("%sPod %s (%s)", indent, pod.Name,
+		pod.Status.Phase))
+}
+
+// inspectPod summarizes a pod and adds findings for its pending reasons and
+// problematic containers.
+func (d *diagnoser) inspectPod(pod *corev1.Pod) {
+	object := "Pod " + pod.Name
+	summary := podSummary{
+		Name:  pod.Name,
+		Phase: string(pod.Status.Phase),
+		Node:  pod.Spec.NodeName,
+		Age:   duration.HumanDuration(time.Since(pod.CreationTimestamp.Time)),
+	}
+
+	if pod.DeletionTimestamp != nil {
+		d.addFinding("warning", object, "Terminating", fmt.Sprintf("deletion requested %s ago",
+			duration.HumanDuration(time.Since(pod.DeletionTimestamp.Time))))
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodPending:
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+				d.addFinding("error", object, condition.Reason, condition.Message)
+			}
+		}
+	case corev1.PodFailed:
+		d.addFinding("error", object, pod.Status.Reason, pod.Status.Message)
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		summary.Containers = append(summary.Containers, containerState(&status))
+		d.inspectContainer(object, &status)
+	}
+
+	d.report.Pods = append(d.report.Pods, summary)
+}
+
+func (d *diagnoser) inspectContainer(object string, status *corev1.ContainerStatus) {
+	container := fmt.Sprintf("%s container %s", object, status.Name)
+
+	if waiting := status.State.Waiting; waiting != nil && problematicWaitingReasons[waiting.Reason] {
+		message := waiting.Message
+		if terminated := status.LastTerminationState.Terminated; terminated != nil {
+			message = strings.TrimSpace(fmt.Sprintf("%s (last terminated: %s, exit code %d)", message,
+				terminated.Reason, terminated.ExitCode))
+		}
+
+		d.addFinding("error", container, waiting.Reason, message)
+	}
+
+	if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+		d.addFinding("error", container, "OOMKilled",
+			fmt.Sprintf("killed for exceeding its memory limit, restarted %d times", status.RestartCount))
+	} else if status.RestartCount > 0 && (status.State.Waiting == nil ||
+		!problematicWaitingReasons[status.State.Waiting.Reason]) {
+		d.addFinding("warning", container, "Restarted", fmt.Sprintf("restarted %d times", status.RestartCount))
+	}
+
+	if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+		d.addFinding("error", container, terminated.Reason, fmt.Sprintf("exited with code %d: %s",
+			terminated.ExitCode, terminated.Message))
+	}
+
+	if status.State.Running != nil && !status.Ready {
+		d.addFinding("warning", container, "NotReady", "running but failing its readiness probe")
+	}
+}
+
+// events adds the events of the diagnosed objects, warnings first and most
+// recent first within each type.
+func (d *diagnoser) events(ctx context.Context) error {
+	var related []corev1.Event
+	for _, uid := range slices.Sorted(maps.Keys(d.uids)) {
+		events, err := d.client.CoreV1().Events(d.namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("involvedObject.uid", string(uid)).String(),
+			Limit:         maxListedEvents,
+		})
+		if err != nil {
+			return err
+		}
+
+		if events.Continue != "" {
+			d.report.Notes = append(d.report.Notes, fmt.Sprintf("only %d events were listed for object %s",
+				maxListedEvents, uid))
+		}
+
+		for _, event := range events.Items {
+			if event.InvolvedObject.UID == uid {
+				related = append(related, event)
+			}
+		}
+	}
+
+	sort.SliceStable(related, func(i, j int) bool {
+		if related[i].Type != related[j].Type {
+			return related[i].Type == corev1.EventTypeWarning
+		}
+
+		return eventTime(&related[i]).After(eventTime(&related[j]))
+	})
+
+	if len(related) > maxDiagnosedEvents {
+		d.report.Notes = append(d.report.Notes, fmt.Sprintf("%d older events were omitted",
+			len(related)-maxDiagnosedEvents))
+		related = related[:maxDiagnosedEvents]
+	}
+
+	for _, event := range related {
+		d.report.Events = append(d.report.Events, eventSummary{
+			Age:     duration.HumanDuration(time.Since(eventTime(&event))),
+			Type:    event.Type,
+			Reason:  event.Reason,
+			Object:  event.InvolvedObject.Kind + " " + event.InvolvedObject.Name,
+			Count:   event.Count,
+			Message: strings.TrimSpace(event.Message),
+		})
+	}
+
+	return nil
+}
+
+// nodes adds the unhealthy conditions of the nodes the diagnosed pods run on.
+func (d *diagnoser) nodes(ctx context.Context) {
+	seen := map[string]bool{}
+	for _, pod := range d.pods {
+		if pod.Spec.NodeName == "" || seen[pod.Spec.NodeName] {
+			continue
+		}
+		seen[pod.Spec.NodeName] = true
+
+		node, err := d.client.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+		if err != nil {
+			d.report.Notes = append(d.report.Notes, fmt.Sprintf("failed to get node %s: %v", pod.Spec.NodeName, err))
+			continue
+		}
+
+		object := "Node " + node.Name
+		summary := nodeSummary{Name: node.Name}
+		if node.Spec.Unschedulable {
+			summary.Conditions = append(summary.Conditions, "Unschedulable (cordoned)")
+		}
+
+		for _, condition := range node.Status.Conditions {
+			healthy := condition.Status == corev1.ConditionFalse
+			if condition.Type == corev1.NodeReady {
+				healthy = condition.Status == corev1.ConditionTrue
+			}
+
+			if !healthy {
+				summary.Conditions = append(summary.Conditions, fmt.Sprintf("%s=%s: %s", condition.Type,
+					condition.Status, condition.Message))
+				d.addFinding("error", object, string(condition.Type), condition.Message)
+			}
+		}
+
+		if len(summary.Conditions) > 0 {
+			d.report.Nodes = append(d.report.Nodes, summary)
+		}
+	}
+}
+
+// containerState renders the state of a container in a single line.
+func containerState(status *corev1.ContainerStatus) string {
+	state := "unknown"
+	switch {
+	case status.State.Running != nil:
+		state = "running"
+		if !status.Ready {
+			state += ", not ready"
+		}
+	case status.State.Waiting != nil:
+		state = "waiting: " + status.State.Waiting.Reason
+	case status.State.Terminated != nil:
+		state = fmt.Sprintf("terminated: %s (exit code %d)", status.State.Terminated.Reason,
+			status.State.Terminated.ExitCode)
+	}
+
+	return fmt.Sprintf("%s %s, %d restarts", status.Name, state, status.RestartCount)
+}
+
+func controllerOf(owners []metav1.OwnerReference) *metav1.OwnerReference {
+	for i := range owners {
+		if owners[i].Controller != nil && *owners[i].Controller {
+			return &owners[i]
+		}
+	}
+
+	return nil
+}
+
+func isOwnedBy(owners []metav1.OwnerReference, uid types.UID) bool {
+	owner := controllerOf(owners)
+	return owner != nil && owner.UID == uid
+}
+
+func replicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+
+	return *replicas
+}
+
+func revision(replicaSet *appsv1.ReplicaSet) int64 {
+	revision, _ := strconv.ParseInt(replicaSet.Annotations[revisionAnnotation], 10, 64)
+	return revision
+}
+
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
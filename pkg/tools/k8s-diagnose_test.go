@@ -0,0 +1,209 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// controlledBy returns the owner references of an object controlled by the
+// owner of the given kind, name and UID.
+func controlledBy(kind, name string, uid types.UID) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, UID: uid, Controller: &controller}}
+}
+
+// testPod returns a pod of the web Deployment, controlled by the ReplicaSet
+// with the given UID and scheduled on the given node, with the given status.
+func testPod(name string, replicaSetUID types.UID, node string, status corev1.PodStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name),
+			Labels: map[string]string{"app": "web"}, OwnerReferences: controlledBy("ReplicaSet", "web-2", replicaSetUID)},
+		Spec:   corev1.PodSpec{NodeName: node},
+		Status: status,
+	}
+}
+
+// newDiagnoseClient returns a clientset holding the web Deployment, its current
+// and old ReplicaSets, its failing pods, and the node they run on.
+func newDiagnoseClient(extra ...runtime.Object) *fake.Clientset {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	three, zero := int32(3), int32(0)
+
+	objects := []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "deploy"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &three, Selector: selector},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: 0, UpdatedReplicas: 3},
+		},
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-2", Namespace: "default", UID: "rs-2",
+				Labels: map[string]string{"app": "web"}, Annotations: map[string]string{revisionAnnotation: "2"},
+				OwnerReferences: controlledBy("Deployment", "web", "deploy")},
+			Spec: appsv1.ReplicaSetSpec{Replicas: &three, Selector: selector},
+		},
+		&appsv1.ReplicaSet{ // scaled down, hence left out of the owner chain
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", UID: "rs-1",
+				Labels: map[string]string{"app": "web"}, Annotations: map[string]string{revisionAnnotation: "1"},
+				OwnerReferences: controlledBy("Deployment", "web", "deploy")},
+			Spec: appsv1.ReplicaSetSpec{Replicas: &zero, Selector: selector},
+		},
+		testPod("web-crashing", "rs-2", "node-1", corev1.PodStatus{Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:         "app",
+				RestartCount: 5,
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff",
+					Message: "back-off 5m0s restarting failed container"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					Reason: "OOMKilled", ExitCode: 137}},
+			}}}),
+		testPod("web-pulling", "rs-2", "", corev1.PodStatus{Phase: corev1.PodPending,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "app",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff",
+					Message: `Back-off pulling image "web:v3"`}},
+			}}}),
+		testPod("web-pending", "rs-2", "", corev1.PodStatus{Phase: corev1.PodPending,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse,
+				Reason: "Unschedulable", Message: "0/3 nodes are available: 3 Insufficient memory."}}}),
+		testPod("web-orphan", "other", "node-2", corev1.PodStatus{Phase: corev1.PodRunning}), // not controlled by web
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+				{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionTrue, Message: "kubelet has memory pressure"},
+				{Type: corev1.NodeDiskPressure, Status: corev1.ConditionFalse},
+			}},
+		},
+	}
+
+	return fake.NewSimpleClientset(append(objects, extra...)...)
+}
+
+func TestDiagnoseDeployment(t *testing.T) {
+	client := newDiagnoseClient()
+	report, err := NewK8sDiagnoseTool(client).diagnose(context.Background(),
+		diagnoseCallArgs{Kind: "Deployment", Name: "web", Namespace: "default"})
+	if err != nil {
+		t.Fatalf("diagnose() error = %v", err)
+	}
+
+	wantChain := []string{
+		"Deployment web (0/3 ready, 3 updated)",
+		"  ReplicaSet web-2 (revision 2, 0/3 ready)",
+		"    Pod web-crashing (Running)",
+		"    Pod web-pending (Pending)",
+		"    Pod web-pulling (Pending)",
+	}
+	if !slices.Equal(report.OwnerChain, wantChain) {
+		t.Errorf("owner chain = %q, want %q", report.OwnerChain, wantChain)
+	}
+
+	for _, want := range []finding{
+		{Severity: "error", Object: "Pod web-crashing container app", Reason: "CrashLoopBackOff",
+			Message: "back-off 5m0s restarting failed container (last terminated: OOMKilled, exit code 137)"},
+		{Severity: "error", Object: "Pod web-crashing container app", Reason: "OOMKilled",
+			Message: "killed for exceeding its memory limit, restarted 5 times"},
+		{Severity: "error", Object: "Pod web-pulling container app", Reason: "ImagePullBackOff",
+			Message: `Back-off pulling image "web:v3"`},
+		{Severity: "error", Object: "Pod web-pending", Reason: "Unschedulable",
+			Message: "0/3 nodes are available: 3 Insufficient memory."},
+		{Severity: "error", Object: "Node node-1", Reason: "MemoryPressure", Message: "kubelet has memory pressure"},
+	} {
+		if !slices.Contains(report.Findings, want) {
+			t.Errorf("findings = %+v, want %+v among them", report.Findings, want)
+		}
+	}
+
+	wantNodes := []nodeSummary{{Name: "node-1", Conditions: []string{"MemoryPressure=True: kubelet has memory pressure"}}}
+	if len(report.Nodes) != 1 || !slices.Equal(report.Nodes[0].Conditions, wantNodes[0].Conditions) {
+		t.Errorf("nodes = %+v, want %+v", report.Nodes, wantNodes)
+	}
+}
+
+func TestDiagnosePodWalksOwnerChainUp(t *testing.T) {
+	report, err := NewK8sDiagnoseTool(newDiagnoseClient()).diagnose(context.Background(),
+		diagnoseCallArgs{Kind: "Pod", Name: "web-pulling", Namespace: "default"})
+	if err != nil {
+		t.Fatalf("diagnose() error = %v", err)
+	}
+
+	wantChain := []string{"Deployment web", "  ReplicaSet web-2", "    Pod web-pulling (Pending)"}
+	if !slices.Equal(report.OwnerChain, wantChain) {
+		t.Errorf("owner chain = %q, want %q", report.OwnerChain, wantChain)
+	}
+}
+
+func TestDiagnoseCapsEvents(t *testing.T) {
+	now := time.Now()
+
+	var events []runtime.Object
+	for i := range maxDiagnosedEvents + 5 {
+		eventType := corev1.EventTypeNormal
+		if i%10 == 0 {
+			eventType = corev1.EventTypeWarning
+		}
+
+		events = append(events, &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("event-%d", i), Namespace: "default"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "web-crashing",
+				UID: "web-crashing"},
+			Type:          eventType,
+			Reason:        fmt.Sprintf("Reason%d", i),
+			LastTimestamp: metav1.NewTime(now.Add(-time.Duration(i) * time.Minute)),
+		})
+	}
+	events = append(events, &corev1.Event{ // of an object that is not diagnosed
+		ObjectMeta:     metav1.ObjectMeta{Name: "unrelated", Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "web-orphan", UID: "web-orphan"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "Unrelated",
+		LastTimestamp:  metav1.NewTime(now),
+	})
+
+	client := newDiagnoseClient(events...)
+	client.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		restrictions := action.(k8stesting.ListAction).GetListRestrictions()
+		if _, ok := restrictions.Fields.RequiresExactMatch("involvedObject.uid"); !ok {
+			t.Errorf("events listed with field selector %q, want them selected by object", restrictions.Fields)
+		}
+
+		return false, nil, nil
+	})
+
+	report, err := NewK8sDiagnoseTool(client).diagnose(context.Background(),
+		diagnoseCallArgs{Kind: "Pod", Name: "web-crashing", Namespace: "default"})
+	if err != nil {
+		t.Fatalf("diagnose() error = %v", err)
+	}
+
+	if len(report.Events) != maxDiagnosedEvents {
+		t.Fatalf("diagnose() reported %d events, want %d", len(report.Events), maxDiagnosedEvents)
+	}
+
+	// warnings first, most recent first within each type
+	var reasons []string
+	for _, event := range report.Events[:4] {
+		reasons = append(reasons, event.Reason)
+	}
+	if want := []string{"Reason0", "Reason10", "Reason20", "Reason1"}; !slices.Equal(reasons, want) {
+		t.Errorf("first events = %q, want %q", reasons, want)
+	}
+
+	if !slices.ContainsFunc(report.Notes, func(note string) bool {
+		return strings.Contains(note, "5 older events were omitted")
+	}) {
+		t.Errorf("notes = %q, want the omitted events noted", report.Notes)
+	}
+}
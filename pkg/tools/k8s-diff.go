@@ -0,0 +1,325 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kube-agent/kuery/pkg/tools/api"
+
+	"github.com/tmc/langchaingo/llms"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+var _ api.Describer = &K8sDynamicClient{}
+
+// diffContextLines is the number of unchanged lines shown around changes.
+const diffContextLines = 3
+
+// maxDiffCells caps the size of the LCS table of a diff (lines that differ in
+// from times lines that differ in to), beyond which objects are summarized as
+// too large to diff instead.
+const maxDiffCells = 1 << 22
+
+// Describe renders a mutating tool call as a unified YAML diff between the live
+// object and the result of a server-side dry-run of the call, similarly to
+// `kubectl diff`. Other calls are described by their arguments.
+func (k *K8sDynamicClient) Describe(ctx context.Context, toolCall *llms.ToolCall) (string, error) {
+	var args dynamicCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return "", fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+
+	if err := k.resolveArgs(&args); err != nil {
+		return "", fmt.Errorf("failed to resolve resource: %w", err)
+	}
+
+	header := fmt.Sprintf("%s %s %s %s", k.Name(), args.Operation, args.gvr().GroupResource().String(),
+		args.Namespace+"/"+args.Name)
+
+	switch args.Operation {
+	case "POST", "PUT", "PATCH", "APPLY", "DELETE":
+	case "SCALE", "ROLLOUT_RESTART", "ROLLOUT_PAUSE", "ROLLOUT_RESUME", "ROLLOUT_UNDO":
+	default:
+		return header, nil
+	}
+
+	if k.client == nil {
+		return "", fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	name := args.Name
+	if args.Operation == "POST" || args.Operation == "PUT" || args.Operation == "APPLY" {
+		obj, err := args.unstructuredObject()
+		if err != nil {
+			return "", err
+		}
+
+		name = obj.GetName()
+	}
+
+	var live *unstructured.Unstructured
+	if name != "" {
+		var err error
+		live, err = k.resource(args).Get(ctx, name, metav1.GetOptions{}, subresourcePath(args.Operation)...)
+		if err != nil && !errors.IsNotFound(err) {
+			return "", fmt.Errorf("failed to get live resource: %w", err)
+		}
+	}
+
+	var dryRun *unstructured.Unstructured
+	if args.Operation != "DELETE" {
+		var err error
+		if isSubresourceOperation(args.Operation) {
+			dryRun, err = k.mutateSubresource(ctx, args, []string{metav1.DryRunAll})
+		} else {
+			dryRun, err = k.mutate(ctx, args, []string{metav1.DryRunAll})
+		}
+		if err != nil {
+			return "", fmt.Errorf("dry-run failed: %w", err)
+		}
+	}
+
+	liveYAML, err := diffableYAML(live)
+	if err != nil {
+		return "", err
+	}
+
+	dryRunYAML, err := diffableYAML(dryRun)
+	if err != nil {
+		return "", err
+	}
+
+	diff := unifiedDiff(liveYAML, dryRunYAML, "live", args.Operation+" (dry-run)")
+	if diff == "" {
+		diff = "(no changes)\n"
+	}
+
+	return header + "\n" + diff, nil
+}
+
+// diffableYAML renders the object as YAML lines, without the fields that
+// change on every write or are not set by the user. The data of Secrets is
+// masked (see maskSecretData).
+func diffableYAML(obj *unstructured.Unstructured) ([]string, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	obj = obj.DeepCopy()
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+	obj.SetGeneration(0)
+	unstructured.RemoveNestedField(obj.Object, "status")
+
+	if obj.GetKind() == "Secret" {
+		maskSecretData(obj)
+	}
+
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal object: %w", err)
+	}
+
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// maskSecretData replaces the values of the data of the Secret, and its
+// last-applied-configuration annotation, with markers of their hashes. Diffs
+// (which are shown to the LLM) then tell which values change without
+// revealing them.
+func maskSecretData(obj *unstructured.Unstructured) {
+	for _, field := range []string{"data", "stringData"} {
+		data, ok := obj.Object[field].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		for key, value := range data {
+			data[key] = hashMarker(fmt.Sprint(value))
+		}
+	}
+
+	annotations := obj.GetAnnotations()
+	if lastApplied, ok := annotations[corev1.LastAppliedConfigAnnotation]; ok {
+		annotations[corev1.LastAppliedConfigAnnotation] = hashMarker(lastApplied)
+		obj.SetAnnotations(annotations)
+	}
+}
+
+// hashMarker returns a marker of the redacted value, distinct for distinct
+// values.
+func hashMarker(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return fmt.Sprintf("<redacted sha256:%s>", hex.EncodeToString(hash[:])[:12])
+}
+
+// diffOp is a single line of a line-diff.
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff returns the unified diff between from and to, or an empty string
+// if they are equal.
+func unifiedDiff(from, to []string, fromName, toName string) string {
+	ops, ok := lineDiff(from, to)
+	if !ok {
+		return fmt.Sprintf("--- %s\n+++ %s\n(too large to diff: %d lines against %d lines)\n", fromName, toName,
+			len(from), len(to))
+	}
+
+	var diff strings.Builder
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// extend the hunk while changes are close enough to share context
+		hunkStart := max(start-diffContextLines, 0)
+		end := start
+		for unchanged := 0; end < len(ops) && unchanged <= 2*diffContextLines; end++ {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		hunkEnd := end
+		for hunkEnd > start && ops[hunkEnd-1].kind == ' ' {
+			hunkEnd--
+		}
+		hunkEnd = min(hunkEnd+diffContextLines, len(ops))
+
+		if diff.Len() == 0 {
+			fmt.Fprintf(&diff, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&diff, ops, hunkStart, hunkEnd)
+
+		start = hunkEnd
+	}
+
+	return diff.String()
+}
+
+// writeHunk writes the ops in [start, end) as a unified diff hunk.
+func writeHunk(diff *strings.Builder, ops []diffOp, start, end int) {
+	fromLine, toLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			fromLine++
+		}
+		if op.kind != '-' {
+			toLine++
+		}
+	}
+
+	fromCount, toCount := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			fromCount++
+		}
+		if op.kind != '-' {
+			toCount++
+		}
+	}
+
+	if fromCount == 0 { // an empty range starts at the line before it
+		fromLine--
+	}
+	if toCount == 0 {
+		toLine--
+	}
+
+	fmt.Fprintf(diff, "@@ -%d,%d +%d,%d @@\n", fromLine, fromCount, toLine, toCount)
+	for _, op := range ops[start:end] {
+		diff.WriteByte(op.kind)
+		diff.WriteString(op.line)
+		diff.WriteByte('\n')
+	}
+}
+
+// lineDiff returns the shortest edit script from from to to, computed over
+// their longest common subsequence, or false if the lines that differ are too
+// many to diff (see maxDiffCells).
+func lineDiff(from, to []string) ([]diffOp, bool) {
+	// the common prefix and suffix are unchanged, only the lines between are diffed
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix &&
+		from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(from)+len(to))
+	for _, line := range from[:prefix] {
+		ops = append(ops, diffOp{kind: ' ', line: line})
+	}
+
+	unchangedSuffix := from[len(from)-suffix:]
+	from, to = from[prefix:len(from)-suffix], to[prefix:len(to)-suffix]
+	if (len(from)+1)*(len(to)+1) > maxDiffCells {
+		return nil, false
+	}
+
+	// lcs[i][j] is the length of the LCS of from[i:] and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			ops = append(ops, diffOp{kind: ' ', line: from[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{kind: '-', line: from[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', line: to[j]})
+			j++
+		}
+	}
+
+	for ; i < len(from); i++ {
+		ops = append(ops, diffOp{kind: '-', line: from[i]})
+	}
+	for ; j < len(to); j++ {
+		ops = append(ops, diffOp{kind: '+', line: to[j]})
+	}
+
+	for _, line := range unchangedSuffix {
+		ops = append(ops, diffOp{kind: ' ', line: line})
+	}
+
+	return ops, true
+}
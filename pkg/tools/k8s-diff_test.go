@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestDescribeMasksSecretData(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]any{
+			"name":      "db",
+			"namespace": "default",
+			"annotations": map[string]any{
+				"kubectl.kubernetes.io/last-applied-configuration": `{"data":{"db-pass":"c3VwZXJzZWNyZXQ="}}`,
+			},
+		},
+		"data": map[string]any{
+			"db-pass": "c3VwZXJzZWNyZXQ=", // supersecret
+			"db-user": "YWRtaW4=",         // admin
+		},
+	}}
+
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), live)
+	tool := NewK8sDynamicClient(client)
+
+	toolCall := &llms.ToolCall{FunctionCall: &llms.FunctionCall{
+		Name: tool.Name(),
+		Arguments: `{"operation":"PUT","group":"","version":"v1","resource":"secrets","namespace":"default",` +
+			`"name":"db","object":"{\"apiVersion\":\"v1\",\"kind\":\"Secret\",\"metadata\":{\"name\":\"db\"},` +
+			`\"data\":{\"db-pass\":\"bmV3c2VjcmV0\",\"db-user\":\"YWRtaW4=\"}}"}`,
+	}}
+
+	diff, err := tool.Describe(context.Background(), toolCall)
+	if err != nil {
+		t.Fatalf("Describe() error = %v", err)
+	}
+
+	for _, value := range []string{"c3VwZXJzZWNyZXQ=", "bmV3c2VjcmV0", "YWRtaW4="} {
+		if strings.Contains(diff, value) {
+			t.Errorf("Describe() reveals %q:\n%s", value, diff)
+		}
+	}
+
+	if !strings.Contains(diff, "-  db-pass: <redacted sha256:") || !strings.Contains(diff, "+  db-pass: <redacted sha256:") {
+		t.Errorf("Describe() does not show that db-pass changes:\n%s", diff)
+	}
+
+	if strings.Contains(diff, "-  db-user:") {
+		t.Errorf("Describe() shows the unchanged db-user as changed:\n%s", diff)
+	}
+}
+
+func TestUnifiedDiffOfLargeObjects(t *testing.T) {
+	lines := func(n int, format string) []string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = fmt.Sprintf(format, i)
+		}
+		return lines
+	}
+
+	// only the lines between the common prefix and suffix count towards the limit
+	from := lines(10000, "line %d")
+	to := slices.Clone(from)
+	to[5000] = "changed"
+	want := "--- live\n+++ dry-run\n@@ -4998,7 +4998,7 @@\n line 4997\n line 4998\n line 4999\n-line 5000\n+changed\n" +
+		" line 5001\n line 5002\n line 5003\n"
+	if diff := unifiedDiff(from, to, "live", "dry-run"); diff != want {
+		t.Errorf("unifiedDiff() = %q, want %q", diff, want)
+	}
+
+	diff := unifiedDiff(lines(3000, "old %d"), lines(3000, "new %d"), "live", "dry-run")
+	if want := "(too large to diff: 3000 lines against 3000 lines)"; !strings.Contains(diff, want) {
+		t.Errorf("unifiedDiff() = %q, want it to contain %q", diff, want)
+	}
+}
@@ -4,21 +4,33 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/kube-agent/kuery/pkg/render"
 	"github.com/kube-agent/kuery/pkg/tools/api"
 
 	"github.com/tmc/langchaingo/llms"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
 )
 
-var _ api.Tool = &K8sDynamicClient{}
+var (
+	_ api.Tool             = &K8sDynamicClient{}
+	_ api.PreflightChecker = &K8sDynamicClient{}
+	_ api.Mutator          = &K8sDynamicClient{}
+	_ api.PolicyTargeter   = &K8sDynamicClient{}
+)
 
 // K8sDynamicClient implements the Tool interface for the K8s dynamic client.
 type K8sDynamicClient struct {
-	client dynamic.Interface
+	client   dynamic.Interface
+	access   *accessReviewer
+	resolver *ResourceResolver
+	readOnly bool
 }
 
 // NewK8sDynamicClient creates a new K8sDynamicClient.
@@ -28,6 +40,27 @@ func NewK8sDynamicClient(client dynamic.Interface) *K8sDynamicClient {
 	}
 }
 
+// WithAccessReview enables RBAC pre-flight checks of mutating calls using
+// SelfSubjectAccessReviews.
+func (k *K8sDynamicClient) WithAccessReview(client authorizationv1client.AuthorizationV1Interface) *K8sDynamicClient {
+	k.access = &accessReviewer{client: client}
+	return k
+}
+
+// WithResolver enables addressing resources by kind or short name, resolved
+// through the given resolver.
+func (k *K8sDynamicClient) WithResolver(resolver *ResourceResolver) *K8sDynamicClient {
+	k.resolver = resolver
+	return k
+}
+
+// WithReadOnly sets whether the tool is restricted to read operations.
+// In read-only mode, only read operations are advertised and executed.
+func (k *K8sDynamicClient) WithReadOnly(readOnly bool) *K8sDynamicClient {
+	k.readOnly = readOnly
+	return k
+}
+
 // Name returns the name of the tool.
 func (k *K8sDynamicClient) Name() string {
 	return "K8sDynamicClient"
@@ -47,16 +80,8 @@ func (k *K8sDynamicClient) LLMTool() *llms.Tool {
 				"type": "object",
 				"properties": map[string]any{
 					"operation": map[string]any{
-						"type": "string",
-						"description": `The operation to perform: LIST, GET, POST, PUT, DELETE
-										LIST: List resources.
-										GET: Get a resource by name.	
-										POST: Create a resource. When using POST, you can skip identification fields (except for NS if needed).
-										PUT: UPDATE a resource. When using PUT, you can skip identification fields (except for NS if needed).
-										DELETE: Delete a resource.
-										List resources, get a resource by name, create a resource, update a resource, delete a resource.
-										If unsure about the object identification (GVR+namespacedName), use LIST to delegate task to a future call.
-										When the intent is to update a resource, use GET to retrieve the resource and then PUT to update it.`,
+						"type":        "string",
+						"description": k.operationDescription(),
 					},
 					"group": map[string]any{
 						"type":        "string",
@@ -68,7 +93,16 @@ func (k *K8sDynamicClient) LLMTool() *llms.Tool {
 					},
 					"resource": map[string]any{
 						"type":        "string",
-						"description": `The resource to interact with.`,
+						"description": k.resourceDescription(),
+					},
+					"kind": map[string]any{
+						"type": "string",
+						"description": `The kind or short name of the resource to interact with (e.g. Deployment or deploy),
+										as an alternative to group, version and resource.`,
+					},
+					"apiVersion": map[string]any{
+						"type":        "string",
+						"description": `The apiVersion of the kind (e.g. apps/v1), optional.`,
 					},
 					"name": map[string]any{
 						"type":        "string",
@@ -79,25 +113,159 @@ func (k *K8sDynamicClient) LLMTool() *llms.Tool {
 						"description": `The namespace of the resource to interact with, or empty for LIST.`,
 					},
 					"object": map[string]any{
+						"type": "string",
+						"description": `The object to create, update or apply, or the patch to patch with.
+										This should be a JSON object (or JSON array for a json patch) that can be unmarshalled in go.`,
+					},
+					"patchType": map[string]any{
+						"type": "string",
+						"description": `The type of the patch for PATCH: merge (JSON merge patch, the default),
+										strategic (strategic merge patch, builtin resources only) or json (JSON patch).`,
+					},
+					"labelSelector": map[string]any{
+						"type":        "string",
+						"description": `A label selector to filter LIST by, e.g. "app=web,tier!=cache".`,
+					},
+					"fieldSelector": map[string]any{
+						"type":        "string",
+						"description": `A field selector to filter LIST by, e.g. "status.phase=Running".`,
+					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": `The maximum number of resources LIST returns, 50 by default.`,
+					},
+					"continue": map[string]any{
 						"type":        "string",
-						"description": `The object to create or update. This should be a JSON object that can be unmarshalled in go.`,
+						"description": `The continue token of a previous LIST, to get the next page of its results.`,
+					},
+					"columns": map[string]any{
+						"type": "string",
+						"description": `The columns of the LIST table as comma-separated HEADER:JSONPATH pairs, like kubectl
+										custom-columns, e.g. "NAME:.metadata.name,PHASE:.status.phase". Defaults to name and age.
+										Only request the fields you need.`,
+					},
+					"expand": map[string]any{
+						"type": "array",
+						"description": `Paths of fields to return in full, e.g. ".data.config". Long fields and lists are
+										truncated in the output with a marker naming their path, pass it here to see them.`,
+						"items": map[string]any{
+							"type": "string",
+						},
+					},
+					"replicas": map[string]any{
+						"type":        "integer",
+						"description": `The number of replicas to SCALE to.`,
+					},
+					"revision": map[string]any{
+						"type":        "integer",
+						"description": `The revision to ROLLOUT_UNDO to, or 0 for the previous revision.`,
+					},
+					"force": map[string]any{
+						"type": "boolean",
+						"description": `Whether APPLY should take ownership of fields managed by other field managers.
+										Only set it if the user explicitly agreed to override the conflicting changes.`,
 					},
 				},
-				"required": []string{"operation", "group", "version", "resource", "name", "namespace"},
+				"required": k.requiredArguments(),
 			},
 		},
 	}
 }
 
+const (
+	readOperationsDescription = `The operation to perform: LIST, GET, STATUS, ROLLOUT_STATUS
+										LIST: List resources as a table, optionally filtered by selectors, paginated and projected to columns.
+										GET: Get a resource by name.
+										STATUS: Get the status subresource of a resource by name.
+										ROLLOUT_STATUS: Summarize the progress of the rollout of a Deployment, StatefulSet or DaemonSet.
+										Kuery is in read-only mode, other operations are not available.
+										If unsure about the object identification (GVR+namespacedName), use LIST to delegate task to a future call.`
+	operationsDescription = `The operation to perform: LIST, GET, POST, PUT, PATCH, APPLY, DELETE, STATUS, SCALE,
+										ROLLOUT_STATUS, ROLLOUT_RESTART, ROLLOUT_PAUSE, ROLLOUT_RESUME, ROLLOUT_UNDO
+										LIST: List resources as a table, optionally filtered by selectors, paginated and projected to columns.
+										GET: Get a resource by name.	
+										POST: Create a resource. When using POST, you can skip identification fields (except for NS if needed).
+										PUT: UPDATE (replace) a resource. When using PUT, you can skip identification fields (except for NS if needed).
+										PATCH: Partially update a resource by name, with the patch given in object and its type in patchType.
+										APPLY: Server-side apply the object, creating or updating the fields it specifies.
+											The object must include apiVersion, kind and metadata.name.
+										DELETE: Delete a resource.
+										STATUS: Get the status subresource of a resource by name.
+										SCALE: Set the replicas of a resource with a scale subresource (e.g. Deployment, StatefulSet).
+										ROLLOUT_STATUS: Summarize the progress of the rollout of a Deployment, StatefulSet or DaemonSet.
+										ROLLOUT_RESTART: Restart the pods of a Deployment, StatefulSet or DaemonSet with a rollout.
+										ROLLOUT_PAUSE, ROLLOUT_RESUME: Pause or resume the rollout of a Deployment.
+										ROLLOUT_UNDO: Roll a Deployment back to a previous revision.
+										List resources, get a resource by name, create a resource, update a resource, delete a resource.
+										If unsure about the object identification (GVR+namespacedName), use LIST to delegate task to a future call.
+										When the intent is to update a few fields of a resource, prefer PATCH or APPLY.
+										When the intent is to replace a resource, use GET to retrieve the resource and then PUT to update it.`
+)
+
+// operationDescription returns the description of the operations available
+// to the model.
+func (k *K8sDynamicClient) operationDescription() string {
+	if k.readOnly {
+		return readOperationsDescription
+	}
+
+	return operationsDescription
+}
+
+// resourceDescription returns the description of the resource argument.
+func (k *K8sDynamicClient) resourceDescription() string {
+	if k.resolver == nil {
+		return `The resource to interact with.`
+	}
+
+	return `The resource to interact with, or its short name (e.g. deploy). Group and version are optional,
+			prefer kind when unsure about them.`
+}
+
+// requiredArguments returns the arguments the model must pass.
+func (k *K8sDynamicClient) requiredArguments() []string {
+	if k.resolver == nil {
+		return []string{"operation", "group", "version", "resource", "name", "namespace"}
+	}
+
+	return []string{"operation", "name", "namespace"}
+}
+
 type dynamicCallArgs struct {
-	Operation string `json:"operation"`
-	Group     string `json:"group"`
-	Version   string `json:"version"`
-	Resource  string `json:"resource"`
-	Name      string `json:"name"`
-	Namespace string `json:"namespace"`
+	Operation  string `json:"operation"`
+	Group      string `json:"group"`
+	Version    string `json:"version"`
+	Resource   string `json:"resource"`
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+
+	Object    string `json:"object"`
+	PatchType string `json:"patchType"`
+	Force     bool   `json:"force"`
+
+	Replicas *int32 `json:"replicas"`
+	Revision int64  `json:"revision"`
+
+	LabelSelector string `json:"labelSelector"`
+	FieldSelector string `json:"fieldSelector"`
+	Limit         int64  `json:"limit"`
+	Continue      string `json:"continue"`
+	Columns       string `json:"columns"`
+
+	Expand []string `json:"expand"`
+}
+
+// fieldManager is the field manager Kuery writes with.
+const fieldManager = "kuery"
 
-	Object string `json:"object"`
+// patchTypes maps the patch types of the tool to their API patch types.
+var patchTypes = map[string]types.PatchType{
+	"":          types.MergePatchType,
+	"merge":     types.MergePatchType,
+	"strategic": types.StrategicMergePatchType,
+	"json":      types.JSONPatchType,
 }
 
 // Call executes the tool call and returns the response.
@@ -112,6 +280,14 @@ func (k *K8sDynamicClient) Call(ctx context.Context, toolCall *llms.ToolCall) (l
 		}, false
 	}
 
+	if err := k.resolveArgs(&args); err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to resolve resource: %v", err),
+		}, false
+	}
+
 	response, err := k.interactWithClient(ctx, args.Operation, args)
 	if err != nil {
 		return llms.ToolCallResponse{
@@ -128,112 +304,303 @@ func (k *K8sDynamicClient) Call(ctx context.Context, toolCall *llms.ToolCall) (l
 	}, true
 }
 
+// mutatingVerbs maps the mutating operations of the tool to their RBAC verbs.
+var mutatingVerbs = map[string]string{
+	"POST":            "create",
+	"PUT":             "update",
+	"PATCH":           "patch",
+	"APPLY":           "patch",
+	"DELETE":          "delete",
+	"SCALE":           "patch",
+	"ROLLOUT_RESTART": "patch",
+	"ROLLOUT_PAUSE":   "patch",
+	"ROLLOUT_RESUME":  "patch",
+	"ROLLOUT_UNDO":    "patch",
+}
+
+// Preflight checks that the identity the tool acts as is allowed to perform
+// the mutating operation of the call, so that a call that would be Forbidden
+// is never brought to the user for approval.
+func (k *K8sDynamicClient) Preflight(ctx context.Context, toolCall *llms.ToolCall) error {
+	var args dynamicCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return nil // reported by Call
+	}
+
+	verb, ok := mutatingVerbs[args.Operation]
+	if !ok {
+		return nil
+	}
+
+	if err := k.resolveArgs(&args); err != nil {
+		return nil // reported by Call
+	}
+
+	return k.access.checkAccess(ctx, verb, args.gvr(), subresources[args.Operation], args.Namespace, args.Name)
+}
+
+// readOperations are the operations of the tool that do not modify the
+// cluster.
+var readOperations = map[string]bool{
+	"GET":            true,
+	"LIST":           true,
+	"STATUS":         true,
+	"ROLLOUT_STATUS": true,
+}
+
+// Mutates returns whether the tool call may modify the cluster.
+// Calls that cannot be parsed, or have an unknown operation, are considered
+// mutating.
+func (k *K8sDynamicClient) Mutates(toolCall *llms.ToolCall) bool {
+	var args dynamicCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return true
+	}
+
+	return !readOperations[args.Operation]
+}
+
+// PolicyTargets returns the object the tool call operates on, with its kind,
+// resource or short name resolved to its resource, for policies to match on.
+func (k *K8sDynamicClient) PolicyTargets(toolCall *llms.ToolCall) ([]api.PolicyTarget, error) {
+	var args dynamicCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+
+	if err := k.resolveArgs(&args); err != nil {
+		return nil, err
+	}
+
+	name, kind := args.Name, args.Kind
+	if args.Object != "" {
+		if obj, err := args.unstructuredObject(); err == nil {
+			if name == "" {
+				name = obj.GetName()
+			}
+			if kind == "" {
+				kind = obj.GetKind()
+			}
+		}
+	}
+
+	return []api.PolicyTarget{{
+		Operation: args.Operation,
+		Group:     args.Group,
+		Version:   args.Version,
+		Resource:  args.Resource,
+		Namespace: args.Namespace,
+		Name:      name,
+		Kind:      kind,
+	}}, nil
+}
+
 // interactWithClient interacts with the Kubernetes API using the go client.
 func (k *K8sDynamicClient) interactWithClient(ctx context.Context, operation string, args dynamicCallArgs) (string, error) {
 	if k.client == nil {
 		return "", fmt.Errorf("kubernetes client is not initialized")
 	}
 
+	if k.readOnly && !readOperations[operation] {
+		return "", fmt.Errorf("operation %v is not available in read-only mode", operation)
+	}
+
 	switch operation {
 	case "GET":
-		var unstructuredObj *unstructured.Unstructured
-		var err error
-
-		if args.Namespace == metav1.NamespaceNone {
-			unstructuredObj, err = k.client.Resource(schema.GroupVersionResource{
-				Group:    args.Group,
-				Version:  args.Version,
-				Resource: args.Resource,
-			}).Get(ctx, args.Name, metav1.GetOptions{})
-		} else {
-			unstructuredObj, err = k.client.Resource(schema.GroupVersionResource{
-				Group:    args.Group,
-				Version:  args.Version,
-				Resource: args.Resource,
-			}).Namespace(args.Namespace).Get(ctx, args.Name, metav1.GetOptions{})
-		}
-
+		unstructuredObj, err := k.resource(args).Get(ctx, args.Name, metav1.GetOptions{})
 		if err != nil {
 			return "", fmt.Errorf("failed to get resource (namespacedName=%s): %w",
 				args.Namespace+"/"+args.Name, err)
 		}
 
-		return fmt.Sprintf("%v", unstructuredObj), nil
+		return render.Object(unstructuredObj, render.DefaultOptions(args.Expand...))
 	case "LIST":
-		var unstructuredList *unstructured.UnstructuredList
-		var err error
-
-		if args.Namespace == metav1.NamespaceNone {
-			unstructuredList, err = k.client.Resource(schema.GroupVersionResource{
-				Group:    args.Group,
-				Version:  args.Version,
-				Resource: args.Resource,
-			}).List(ctx, metav1.ListOptions{})
-		} else {
-			unstructuredList, err = k.client.Resource(schema.GroupVersionResource{
-				Group:    args.Group,
-				Version:  args.Version,
-				Resource: args.Resource,
-			}).Namespace(args.Namespace).List(ctx, metav1.ListOptions{})
+		return k.list(ctx, args)
+	case "STATUS":
+		return k.getStatus(ctx, args)
+	case "ROLLOUT_STATUS":
+		return k.rolloutStatus(ctx, args)
+	case "SCALE", "ROLLOUT_RESTART", "ROLLOUT_PAUSE", "ROLLOUT_RESUME", "ROLLOUT_UNDO":
+		return k.subresourceOperation(ctx, args)
+	case "POST", "PUT", "PATCH", "APPLY":
+		unstructuredObj, err := k.mutate(ctx, args, nil)
+		if err != nil {
+			return "", err
 		}
 
-		if err != nil {
-			return "", fmt.Errorf("failed to list resources: %w", err)
+		if args.Resource == "customresourcedefinitions" && k.resolver != nil {
+			k.resolver.Invalidate() // make the new resources resolvable
+		}
+
+		return render.Object(unstructuredObj, render.DefaultOptions(args.Expand...))
+	case "DELETE":
+		if err := k.resource(args).Delete(ctx, args.Name, metav1.DeleteOptions{}); err != nil {
+			return "", fmt.Errorf("failed to delete resource: %w", err)
 		}
 
-		return fmt.Sprintf("%v", unstructuredList), nil
+		return fmt.Sprintf("deleted resource (namespacedName=%s)", args.Namespace+"/"+args.Name), nil
+	}
+
+	return "", fmt.Errorf("unsupported operation: %v", operation)
+}
+
+// mutate performs the creating or updating operation of args, and returns the
+// resulting object. If dryRun is set, the operation is not persisted.
+func (k *K8sDynamicClient) mutate(ctx context.Context, args dynamicCallArgs,
+	dryRun []string) (*unstructured.Unstructured, error) {
+	switch args.Operation {
 	case "POST":
-		fallthrough
+		unstructuredObj, err := args.unstructuredObject()
+		if err != nil {
+			return nil, err
+		}
+
+		unstructuredObj, err = k.resource(args).Create(ctx, unstructuredObj, metav1.CreateOptions{DryRun: dryRun})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create resource: %w", err)
+		}
+
+		return unstructuredObj, nil
 	case "PUT":
-		var err error
-		var unstructuredObj *unstructured.Unstructured
+		unstructuredObj, err := args.unstructuredObject()
+		if err != nil {
+			return nil, err
+		}
 
-		if err := json.Unmarshal([]byte(args.Object), &unstructuredObj); err != nil {
-			return "", fmt.Errorf("failed to unmarshal object: %w", err)
+		unstructuredObj, err = k.resource(args).Update(ctx, unstructuredObj, metav1.UpdateOptions{DryRun: dryRun})
+		if errors.IsConflict(err) {
+			return nil, fmt.Errorf("the resource was modified since it was read, "+
+				"GET it again and re-apply your changes to the new version: %w", err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to update resource: %w", err)
 		}
 
-		if args.Namespace == metav1.NamespaceNone {
-			unstructuredObj, err = k.client.Resource(schema.GroupVersionResource{
-				Group:    args.Group,
-				Version:  args.Version,
-				Resource: args.Resource,
-			}).Create(ctx, unstructuredObj, metav1.CreateOptions{})
-		} else {
-			unstructuredObj, err = k.client.Resource(schema.GroupVersionResource{
-				Group:    args.Group,
-				Version:  args.Version,
-				Resource: args.Resource,
-			}).Namespace(args.Namespace).Create(ctx, unstructuredObj, metav1.CreateOptions{})
+		return unstructuredObj, nil
+	case "PATCH":
+		patchType, ok := patchTypes[args.PatchType]
+		if !ok {
+			return nil, fmt.Errorf("unsupported patch type: %v", args.PatchType)
 		}
 
+		unstructuredObj, err := k.resource(args).Patch(ctx, args.Name, patchType, []byte(args.Object),
+			metav1.PatchOptions{FieldManager: fieldManager, DryRun: dryRun})
 		if err != nil {
-			return "", fmt.Errorf("failed to create resource: %w", err)
+			return nil, fmt.Errorf("failed to patch resource: %w", err)
 		}
 
-		return fmt.Sprintf("%v", unstructuredObj), nil
-	case "DELETE":
-		var err error
-
-		if args.Namespace == metav1.NamespaceNone {
-			err = k.client.Resource(schema.GroupVersionResource{
-				Group:    args.Group,
-				Version:  args.Version,
-				Resource: args.Resource,
-			}).Delete(ctx, args.Name, metav1.DeleteOptions{})
-		} else {
-			err = k.client.Resource(schema.GroupVersionResource{
-				Group:    args.Group,
-				Version:  args.Version,
-				Resource: args.Resource,
-			}).Namespace(args.Namespace).Delete(ctx, args.Name, metav1.DeleteOptions{})
+		return unstructuredObj, nil
+	case "APPLY":
+		unstructuredObj, err := args.unstructuredObject()
+		if err != nil {
+			return nil, err
 		}
 
+		unstructuredObj, err = k.resource(args).Apply(ctx, unstructuredObj.GetName(), unstructuredObj,
+			metav1.ApplyOptions{FieldManager: fieldManager, Force: args.Force, DryRun: dryRun})
+		if errors.IsConflict(err) {
+			return nil, fmt.Errorf("the applied fields are managed by another field manager, "+
+				"ask the user whether to force the apply: %w", err)
+		}
 		if err != nil {
-			return "", fmt.Errorf("failed to delete resource: %w", err)
+			return nil, fmt.Errorf("failed to apply resource: %w", err)
 		}
+
+		return unstructuredObj, nil
 	}
 
-	return "", fmt.Errorf("unsupported operation: %v", operation)
+	return nil, fmt.Errorf("unsupported operation: %v", args.Operation)
+}
+
+// resolveArgs sets the group, version and resource of args from their kind,
+// resource or short name, and apiVersion (or group and version), and drops the
+// namespace of cluster-scoped resources.
+// Without a resolver, args are left as they are.
+func (k *K8sDynamicClient) resolveArgs(args *dynamicCallArgs) error {
+	if k.resolver == nil {
+		if args.Resource == "" {
+			return fmt.Errorf("group, version and resource are required")
+		}
+
+		return nil
+	}
+
+	name := args.Kind
+	if name == "" {
+		name = args.Resource
+	}
+
+	apiVersion := args.APIVersion
+	if apiVersion == "" && args.Version != "" {
+		apiVersion = schema.GroupVersion{Group: args.Group, Version: args.Version}.String()
+	}
+
+	if name == "" && args.Object != "" { // fall back to the type of the object
+		if obj, err := args.unstructuredObject(); err == nil {
+			name, apiVersion = obj.GetKind(), obj.GetAPIVersion()
+		}
+	}
+
+	resolved, err := k.resolver.Resolve(apiVersion, name)
+	if err != nil {
+		return err
+	}
+
+	args.Group = resolved.GVR.Group
+	args.Version = resolved.GVR.Version
+	args.Resource = resolved.GVR.Resource
+	args.Kind = resolved.GVK.Kind
+	if !resolved.Namespaced { // addressing a cluster-scoped resource in a namespace would fail to find it
+		args.Namespace = metav1.NamespaceNone
+	}
+
+	return nil
+}
+
+// resource returns the client of the resource addressed by args.
+func (k *K8sDynamicClient) resource(args dynamicCallArgs) dynamic.ResourceInterface {
+	resource := k.client.Resource(args.gvr())
+	if args.Namespace == metav1.NamespaceNone {
+		return resource
+	}
+
+	return resource.Namespace(args.Namespace)
+}
+
+// gvr returns the GroupVersionResource addressed by the args.
+func (args dynamicCallArgs) gvr() schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    args.Group,
+		Version:  args.Version,
+		Resource: args.Resource,
+	}
+}
+
+// unstructuredObject unmarshals the object of the args. The name and namespace
+// of the object default to those of the args.
+func (args dynamicCallArgs) unstructuredObject() (*unstructured.Unstructured, error) {
+	var unstructuredObj *unstructured.Unstructured
+
+	if err := json.Unmarshal([]byte(args.Object), &unstructuredObj); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal object: %w", err)
+	}
+
+	if unstructuredObj == nil {
+		return nil, fmt.Errorf("object is required for %v", args.Operation)
+	}
+
+	if unstructuredObj.GetName() == "" {
+		unstructuredObj.SetName(args.Name)
+	}
+
+	if unstructuredObj.GetNamespace() == "" {
+		unstructuredObj.SetNamespace(args.Namespace)
+	}
+
+	return unstructuredObj, nil
 }
 
 // RequiresExplaining returns whether the tool requires explaining after
@@ -0,0 +1,207 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kube-agent/kuery/pkg/tools/api"
+	"github.com/tmc/langchaingo/llms"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var deploymentsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+// callDynamicClient calls the tool with the operation on the web Deployment
+// and the given additional arguments.
+func callDynamicClient(tool *K8sDynamicClient, operation, extra string) (string, bool) {
+	arguments := fmt.Sprintf(`{"operation":%q,"group":"apps","version":"v1","resource":"deployments",`+
+		`"namespace":"default","name":"web"%s}`, operation, extra)
+	response, ok := tool.Call(context.Background(), &llms.ToolCall{FunctionCall: &llms.FunctionCall{
+		Name: tool.Name(), Arguments: arguments}})
+
+	return response.Content, ok
+}
+
+// getDeployment returns the web Deployment held by the client.
+func getDeployment(t *testing.T, client *dynamicfake.FakeDynamicClient) *unstructured.Unstructured {
+	t.Helper()
+
+	deployment, err := client.Resource(deploymentsGVR).Namespace("default").Get(context.Background(), "web",
+		metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the deployment: %v", err)
+	}
+
+	return deployment
+}
+
+func TestPolicyMatchesResolvedResource(t *testing.T) {
+	policy := &api.Policy{Rules: []api.PolicyRule{{
+		Resources: []string{"secrets"},
+		Action:    api.PolicyActionDeny,
+		Reason:    "no secrets",
+	}}}
+
+	tool := NewK8sDynamicClient(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())).
+		WithResolver(newTestResolver())
+	mgr := api.NewToolManager().WithPolicy(policy).WithTool(tool, 2)
+
+	for _, arguments := range []string{
+		`{"operation":"GET","resource":"secret","namespace":"default","name":"db"}`,
+		`{"operation":"GET","resource":"SECRETS","namespace":"default","name":"db"}`,
+		`{"operation":"GET","kind":"Secret","namespace":"default","name":"db"}`,
+		`{"operation":"LIST","kind":"secret","apiVersion":"v1","namespace":"default"}`,
+	} {
+		toolCall := &llms.ToolCall{FunctionCall: &llms.FunctionCall{Name: tool.Name(), Arguments: arguments}}
+		err := mgr.Preflight(context.Background(), toolCall)
+		if err == nil || !strings.Contains(err.Error(), "no secrets") {
+			t.Errorf("Preflight(%s) = %v, want denied by policy", arguments, err)
+		}
+	}
+
+	toolCall := &llms.ToolCall{FunctionCall: &llms.FunctionCall{Name: tool.Name(),
+		Arguments: `{"operation":"GET","resource":"cm","namespace":"default","name":"app"}`}}
+	if err := mgr.Preflight(context.Background(), toolCall); err != nil {
+		t.Errorf("Preflight(configmap) = %v, want nil", err)
+	}
+}
+
+func TestClusterScopedResourcesIgnoreNamespace(t *testing.T) {
+	namespace := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]any{"name": "prod"},
+	}}
+	tool := NewK8sDynamicClient(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), namespace)).
+		WithResolver(newTestResolver())
+
+	toolCall := &llms.ToolCall{FunctionCall: &llms.FunctionCall{Name: tool.Name(),
+		Arguments: `{"operation":"GET","kind":"Namespace","namespace":"default","name":"prod"}`}}
+
+	response, ok := tool.Call(context.Background(), toolCall)
+	if !ok || !strings.Contains(response.Content, "name: prod") {
+		t.Errorf("GET of a namespace in a namespace = %q, %v, want the namespace", response.Content, ok)
+	}
+
+	targets, err := tool.PolicyTargets(toolCall)
+	if err != nil || len(targets) != 1 || targets[0].Namespace != "" || targets[0].Kind != "Namespace" {
+		t.Errorf("PolicyTargets() = %+v, %v, want the namespace without a namespace", targets, err)
+	}
+}
+
+func TestUpdateAndPatch(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "web", "namespace": "default"},
+		"spec":       map[string]any{"replicas": int64(2)},
+	}})
+	tool := NewK8sDynamicClient(client)
+
+	deployment := getDeployment(t, client)
+	_ = unstructured.SetNestedField(deployment.Object, int64(4), "spec", "replicas")
+	object, _ := json.Marshal(deployment.Object)
+
+	if content, ok := callDynamicClient(tool, "PUT", fmt.Sprintf(`,"object":%q`, object)); !ok ||
+		!strings.Contains(content, "replicas: 4") {
+		t.Errorf("PUT = %q, %v, want the updated deployment", content, ok)
+	}
+
+	for _, tc := range []struct {
+		patchType, patch string
+		want             int64
+	}{
+		{patch: `{"spec":{"replicas":5}}`, want: 5},
+		{patchType: "merge", patch: `{"spec":{"replicas":6}}`, want: 6},
+		{patchType: "json", patch: `[{"op":"replace","path":"/spec/replicas","value":7}]`, want: 7},
+	} {
+		content, ok := callDynamicClient(tool, "PATCH", fmt.Sprintf(`,"patchType":%q,"object":%q`, tc.patchType,
+			tc.patch))
+		replicas, _, _ := unstructured.NestedInt64(getDeployment(t, client).Object, "spec", "replicas")
+		if !ok || replicas != tc.want {
+			t.Errorf("PATCH %q = %q, %v, want %d replicas, got %d", tc.patchType, content, ok, tc.want, replicas)
+		}
+	}
+
+	if content, ok := callDynamicClient(tool, "PATCH", `,"patchType":"yaml","object":"{}"`); ok ||
+		!strings.Contains(content, "unsupported patch type: yaml") {
+		t.Errorf("PATCH of an unknown type = %q, %v, want an error", content, ok)
+	}
+
+	client.PrependReactor("update", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewConflict(deploymentsGVR.GroupResource(), "web",
+			fmt.Errorf("the object has been modified"))
+	})
+	if content, ok := callDynamicClient(tool, "PUT", fmt.Sprintf(`,"object":%q`, object)); ok ||
+		!strings.Contains(content, "GET it again and re-apply your changes") {
+		t.Errorf("PUT of a stale object = %q, %v, want to be told to GET it again", content, ok)
+	}
+}
+
+func TestApply(t *testing.T) {
+	type request struct {
+		method, path, contentType, fieldManager, force string
+	}
+
+	var requests []request
+	conflict := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		requests = append(requests, request{req.Method, req.URL.Path, req.Header.Get("Content-Type"),
+			query.Get("fieldManager"), query.Get("force")})
+
+		w.Header().Set("Content-Type", "application/json")
+		if conflict && query.Get("force") != "true" {
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(apierrors.NewApplyConflict(nil, "conflict with \"kubectl\"").Status())
+			return
+		}
+
+		_, _ = io.Copy(w, req.Body) // the applied object
+	}))
+	defer server.Close()
+
+	client, err := dynamic.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := NewK8sDynamicClient(client)
+
+	object := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"},"spec":{"replicas":3}}`
+	content, ok := callDynamicClient(tool, "APPLY", fmt.Sprintf(`,"object":%q`, object))
+	if !ok || !strings.Contains(content, "replicas: 3") || !strings.Contains(content, "namespace: default") {
+		t.Errorf("APPLY = %q, %v, want the applied deployment in the default namespace", content, ok)
+	}
+
+	want := request{http.MethodPatch, "/apis/apps/v1/namespaces/default/deployments/web",
+		string(types.ApplyPatchType), fieldManager, "false"}
+	if len(requests) != 1 || requests[0] != want {
+		t.Errorf("APPLY requested %+v, want %+v", requests, want)
+	}
+
+	conflict = true
+	if content, ok := callDynamicClient(tool, "APPLY", fmt.Sprintf(`,"object":%q`, object)); ok ||
+		!strings.Contains(content, "ask the user whether to force the apply") {
+		t.Errorf("conflicting APPLY = %q, %v, want the user to be asked to force it", content, ok)
+	}
+
+	if content, ok := callDynamicClient(tool, "APPLY", fmt.Sprintf(`,"force":true,"object":%q`, object)); !ok ||
+		requests[len(requests)-1].force != "true" {
+		t.Errorf("forced APPLY = %q, %v, requested %+v, want it forced", content, ok, requests[len(requests)-1])
+	}
+}
@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// defaultListLimit is the page size of LIST when the model does not set one.
+const defaultListLimit = 50
+
+// listColumn is a column of LIST output, similar to those of
+// `kubectl get -o custom-columns`.
+type listColumn struct {
+	header string
+	path   *jsonpath.JSONPath
+}
+
+// list lists the resources addressed by args, and renders them as a table.
+func (k *K8sDynamicClient) list(ctx context.Context, args dynamicCallArgs) (string, error) {
+	columns, err := parseColumns(args.Columns)
+	if err != nil {
+		return "", err
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	unstructuredList, err := k.resource(args).List(ctx, metav1.ListOptions{
+		LabelSelector: args.LabelSelector,
+		FieldSelector: args.FieldSelector,
+		Limit:         limit,
+		Continue:      args.Continue,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	if len(unstructuredList.Items) == 0 {
+		return "no resources found", nil
+	}
+
+	var table strings.Builder
+	writer := tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+
+	allNamespaces := args.Namespace == metav1.NamespaceNone && unstructuredList.Items[0].GetNamespace() != ""
+	if columns == nil {
+		writeDefaultTable(writer, unstructuredList.Items, allNamespaces)
+	} else if err := writeCustomTable(writer, unstructuredList.Items, columns); err != nil {
+		return "", err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return "", fmt.Errorf("failed to render table: %w", err)
+	}
+
+	if token := unstructuredList.GetContinue(); token != "" {
+		remaining := ""
+		if count := unstructuredList.GetRemainingItemCount(); count != nil {
+			remaining = fmt.Sprintf(" (%d remaining)", *count)
+		}
+
+		fmt.Fprintf(&table, "more resources available%s, LIST again with continue: %s\n", remaining, token)
+	}
+
+	return table.String(), nil
+}
+
+// parseColumns parses a custom-columns spec, e.g.
+// "NAME:.metadata.name,PHASE:status.phase". An empty spec returns no columns.
+func parseColumns(spec string) ([]listColumn, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var columns []listColumn
+	for _, column := range strings.Split(spec, ",") {
+		header, path, ok := strings.Cut(column, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid column %q, expected HEADER:JSONPATH", column)
+		}
+
+		path = strings.TrimSpace(path)
+		if !strings.HasPrefix(path, "{") { // relaxed like kubectl's, e.g. spec.nodeName
+			path = "{." + strings.TrimPrefix(path, ".") + "}"
+		}
+
+		parser := jsonpath.New(header).AllowMissingKeys(true)
+		if err := parser.Parse(path); err != nil {
+			return nil, fmt.Errorf("invalid JSONPath in column %q: %w", column, err)
+		}
+
+		columns = append(columns, listColumn{header: strings.TrimSpace(header), path: parser})
+	}
+
+	return columns, nil
+}
+
+// writeDefaultTable writes the name (and namespace) and age of the items.
+func writeDefaultTable(writer *tabwriter.Writer, items []unstructured.Unstructured, allNamespaces bool) {
+	if allNamespaces {
+		fmt.Fprint(writer, "NAMESPACE\t")
+	}
+	fmt.Fprintln(writer, "NAME\tAGE")
+
+	for _, item := range items {
+		if allNamespaces {
+			fmt.Fprintf(writer, "%s\t", item.GetNamespace())
+		}
+
+		age := "<unknown>"
+		if created := item.GetCreationTimestamp(); !created.IsZero() {
+			age = duration.HumanDuration(time.Since(created.Time))
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\n", item.GetName(), age)
+	}
+}
+
+// writeCustomTable writes the given columns of the items.
+func writeCustomTable(writer *tabwriter.Writer, items []unstructured.Unstructured, columns []listColumn) error {
+	headers := make([]string, 0, len(columns))
+	for _, column := range columns {
+		headers = append(headers, column.header)
+	}
+	fmt.Fprintln(writer, strings.Join(headers, "\t"))
+
+	for _, item := range items {
+		values := make([]string, 0, len(columns))
+		for _, column := range columns {
+			var value strings.Builder
+			if err := column.path.Execute(&value, item.Object); err != nil {
+				return fmt.Errorf("failed to evaluate column %s: %w", column.header, err)
+			}
+
+			if value.Len() == 0 {
+				values = append(values, "<none>")
+			} else {
+				values = append(values, value.String())
+			}
+		}
+
+		fmt.Fprintln(writer, strings.Join(values, "\t"))
+	}
+
+	return nil
+}
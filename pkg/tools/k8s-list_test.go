@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var podsGVR = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+// testListPod returns a pod of the given app, in the given phase and on the
+// given node, if any.
+func testListPod(namespace, name, app, phase, node string) *unstructured.Unstructured {
+	pod := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]any{"name": name, "namespace": namespace, "labels": map[string]any{"app": app},
+			"creationTimestamp": "2026-01-01T00:00:00Z"},
+		"status": map[string]any{"phase": phase},
+	}}
+	if node != "" {
+		_ = unstructured.SetNestedField(pod.Object, node, "spec", "nodeName")
+	}
+
+	return pod
+}
+
+// newListClient returns a dynamic client holding pods of the web and db apps.
+func newListClient() *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{podsGVR: "PodList"},
+		testListPod("default", "web-1", "web", "Running", "node-1"),
+		testListPod("default", "web-2", "web", "Pending", ""),
+		testListPod("default", "db-1", "db", "Running", "node-2"),
+		testListPod("prod", "web-1", "web", "Running", "node-3"),
+	)
+}
+
+// callList lists pods with the given additional arguments.
+func callList(tool *K8sDynamicClient, extra string) (string, bool) {
+	response, ok := tool.Call(context.Background(), &llms.ToolCall{FunctionCall: &llms.FunctionCall{
+		Name: tool.Name(), Arguments: `{"operation":"LIST","version":"v1","resource":"pods"` + extra + `}`}})
+
+	return response.Content, ok
+}
+
+func TestListSelectsAndProjectsColumns(t *testing.T) {
+	client := newListClient()
+	var restrictions []k8stesting.ListRestrictions
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		restrictions = append(restrictions, action.(k8stesting.ListAction).GetListRestrictions())
+		return false, nil, nil
+	})
+
+	content, ok := callList(NewK8sDynamicClient(client), `,"namespace":"default","labelSelector":"app=web",`+
+		`"fieldSelector":"status.phase=Running","columns":"NAME:.metadata.name, PHASE:.status.phase,NODE:spec.nodeName"`)
+	if !ok {
+		t.Fatalf("LIST failed: %s", content)
+	}
+
+	want := "NAME   PHASE    NODE\n" +
+		"web-1  Running  node-1\n" +
+		"web-2  Pending  <none>\n"
+	if content != want {
+		t.Errorf("LIST =\n%s\nwant\n%s", content, want)
+	}
+
+	if len(restrictions) != 1 || restrictions[0].Labels.String() != "app=web" ||
+		restrictions[0].Fields.String() != "status.phase=Running" {
+		t.Errorf("LIST listed with %+v, want the selectors", restrictions)
+	}
+}
+
+func TestListAllNamespaces(t *testing.T) {
+	content, ok := callList(NewK8sDynamicClient(newListClient()), `,"labelSelector":"app=web"`)
+	if !ok || !strings.HasPrefix(content, "NAMESPACE  NAME   AGE\n") || !strings.Contains(content, "prod       web-1") {
+		t.Errorf("LIST of all namespaces =\n%s\nwant the namespace of every pod", content)
+	}
+
+	if content, ok := callList(NewK8sDynamicClient(newListClient()), `,"labelSelector":"app=cache"`); !ok ||
+		content != "no resources found" {
+		t.Errorf("LIST without matches = %q, %v, want no resources found", content, ok)
+	}
+
+	if content, ok := callList(NewK8sDynamicClient(newListClient()), `,"columns":"NAME"`); ok ||
+		!strings.Contains(content, `invalid column "NAME"`) {
+		t.Errorf("LIST of an invalid column = %q, %v, want an error", content, ok)
+	}
+}
+
+func TestListContinues(t *testing.T) {
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		queries = append(queries, query)
+
+		list := &unstructured.UnstructuredList{Object: map[string]any{"apiVersion": "v1", "kind": "PodList"}}
+		page := len(queries)
+		list.Items = []unstructured.Unstructured{
+			*testListPod("default", fmt.Sprintf("web-%d", 2*page-1), "web", "Running", ""),
+			*testListPod("default", fmt.Sprintf("web-%d", 2*page), "web", "Running", ""),
+		}
+		if query.Get("continue") == "" {
+			remaining := int64(2)
+			list.SetContinue("page-2")
+			list.SetRemainingItemCount(&remaining)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	}))
+	defer server.Close()
+
+	client, err := dynamic.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := NewK8sDynamicClient(client)
+
+	content, ok := callList(tool, `,"namespace":"default","limit":2`)
+	if !ok || !strings.HasSuffix(content, "more resources available (2 remaining), LIST again with continue: page-2\n") {
+		t.Errorf("first page of LIST =\n%s\nwant the continue token", content)
+	}
+
+	content, ok = callList(tool, `,"namespace":"default","limit":2,"continue":"page-2"`)
+	if !ok || !strings.Contains(content, "web-4") || strings.Contains(content, "more resources available") {
+		t.Errorf("last page of LIST =\n%s\nwant the last pods only", content)
+	}
+
+	if len(queries) != 2 || queries[0].Get("limit") != "2" || queries[0].Get("continue") != "" ||
+		queries[1].Get("continue") != "page-2" {
+		t.Errorf("LIST listed with %v, want a limit of 2, and no continue token then page-2", queries)
+	}
+
+	content, ok = callList(tool, `,"namespace":"default"`)
+	if limit := queries[len(queries)-1].Get("limit"); !ok || limit != fmt.Sprint(defaultListLimit) {
+		t.Errorf("LIST without a limit = %q, listed with limit %s, want %d", content, limit, defaultListLimit)
+	}
+}
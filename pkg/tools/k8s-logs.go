@@ -0,0 +1,337 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kube-agent/kuery/pkg/tools/api"
+
+	"github.com/tmc/langchaingo/llms"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// defaultLogTailLines is the number of lines read per container when the
+	// model does not set one.
+	defaultLogTailLines = 100
+	// maxLogPods is the maximum number of pods whose logs are aggregated.
+	maxLogPods = 10
+	// maxLogBytes is the size beyond which the output is truncated, keeping the
+	// most recent lines of every container.
+	maxLogBytes = 16 * 1024
+)
+
+var (
+	_ api.Tool    = &K8sLogsTool{}
+	_ api.Mutator = &K8sLogsTool{}
+)
+
+// K8sLogsTool is a tool that reads the logs of pods.
+type K8sLogsTool struct {
+	client corev1client.CoreV1Interface
+}
+
+// NewK8sLogsTool creates a new K8sLogsTool.
+func NewK8sLogsTool(client corev1client.CoreV1Interface) *K8sLogsTool {
+	return &K8sLogsTool{
+		client: client,
+	}
+}
+
+func (t *K8sLogsTool) Name() string {
+	return "K8sPodLogs"
+}
+
+func (t *K8sLogsTool) LLMTool() *llms.Tool {
+	desc := `Read the logs of a pod, or of all pods matching a label selector, like 'kubectl logs'.
+			Use this tool when troubleshooting workloads. Prefer a small tail and a grep pattern over reading everything.`
+
+	return &llms.Tool{
+		Type: functionToolType,
+		Function: &llms.FunctionDefinition{
+			Name:        t.Name(),
+			Description: api.AddApprovalRequirementToDescription(t, desc),
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"namespace": map[string]any{
+						"type":        "string",
+						"description": `The namespace of the pods.`,
+					},
+					"pod": map[string]any{
+						"type":        "string",
+						"description": `The name of the pod, or empty to read the logs of the pods matching labelSelector.`,
+					},
+					"labelSelector": map[string]any{
+						"type": "string",
+						"description": fmt.Sprintf(`A label selector of the pods to read the logs of, e.g. "app=web".
+										Logs of up to %d pods are aggregated.`, maxLogPods),
+					},
+					"container": map[string]any{
+						"type": "string",
+						"description": `The container to read the logs of, or empty for all containers.
+										Init and ephemeral (debug) containers are included.`,
+					},
+					"previous": map[string]any{
+						"type":        "boolean",
+						"description": `Whether to read the logs of the previous (e.g. crashed) instance of the containers.`,
+					},
+					"tailLines": map[string]any{
+						"type":        "integer",
+						"description": fmt.Sprintf(`The number of most recent lines to read per container, %d by default.`, defaultLogTailLines),
+					},
+					"sinceSeconds": map[string]any{
+						"type":        "integer",
+						"description": `Only read logs newer than this many seconds.`,
+					},
+					"grep": map[string]any{
+						"type": "string",
+						"description": `A regular expression (RE2) that lines must match to be returned, e.g. "(?i)error|panic".
+										Only the last tailLines lines of each container are filtered, raise tailLines to
+										search further back.`,
+					},
+				},
+				"required": []string{"namespace"},
+			},
+		},
+	}
+}
+
+type logsCallArgs struct {
+	Namespace     string `json:"namespace"`
+	Pod           string `json:"pod"`
+	LabelSelector string `json:"labelSelector"`
+	Container     string `json:"container"`
+	Previous      bool   `json:"previous"`
+	TailLines     int64  `json:"tailLines"`
+	SinceSeconds  int64  `json:"sinceSeconds"`
+	Grep          string `json:"grep"`
+}
+
+func (t *K8sLogsTool) Call(ctx context.Context, toolCall *llms.ToolCall) (llms.ToolCallResponse, bool) {
+	var args logsCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to unmarshal arguments: %v", err),
+		}, false
+	}
+
+	logs, err := t.readLogs(ctx, args)
+	if err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to read logs: %v", err),
+		}, false
+	}
+
+	return llms.ToolCallResponse{
+		ToolCallID: toolCall.ID,
+		Name:       toolCall.FunctionCall.Name,
+		Content:    logs,
+	}, true
+}
+
+// RequiresExplaining returns whether the tool requires explaining after
+// execution.
+func (t *K8sLogsTool) RequiresExplaining() bool {
+	return true
+}
+
+// RequiresApproval returns whether the tool requires approval before
+// execution.
+func (t *K8sLogsTool) RequiresApproval() bool { return false }
+
+// Mutates returns whether the tool call may modify the cluster.
+func (t *K8sLogsTool) Mutates(_ *llms.ToolCall) bool { return false }
+
+// containerLogs are the (filtered) log lines of a container.
+type containerLogs struct {
+	header string
+	lines  []string
+}
+
+// readLogs reads, filters and aggregates the logs of the pods addressed by
+// args.
+func (t *K8sLogsTool) readLogs(ctx context.Context, args logsCallArgs) (string, error) {
+	if t.client == nil {
+		return "", fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	var grep *regexp.Regexp
+	if args.Grep != "" {
+		var err error
+		if grep, err = regexp.Compile(args.Grep); err != nil {
+			return "", fmt.Errorf("invalid grep pattern: %w", err)
+		}
+	}
+
+	pods, podsCapped, err := t.pods(ctx, args)
+	if err != nil {
+		return "", err
+	}
+
+	if args.TailLines <= 0 {
+		args.TailLines = defaultLogTailLines
+	}
+
+	var logs []containerLogs
+	for _, pod := range pods {
+		for _, container := range podContainers(pod) {
+			if args.Container != "" && container.name != args.Container {
+				continue
+			}
+
+			lines, err := t.containerLines(ctx, pod.Name, container.name, args, grep)
+			header := fmt.Sprintf("==> pod %s, %s %s <==", pod.Name, container.kind, container.name)
+			if err != nil {
+				lines = []string{fmt.Sprintf("(failed to read logs: %v)", err)}
+			}
+
+			logs = append(logs, containerLogs{header: header, lines: lines})
+		}
+	}
+
+	if len(logs) == 0 {
+		return "", fmt.Errorf("no container %q found in the pods", args.Container)
+	}
+
+	output := renderLogs(logs, podsCapped)
+	if grep != nil { // lines are filtered after the tail is read, older matches are left out
+		output = fmt.Sprintf("(grep filtered the last %d lines of each container only)\n", args.TailLines) + output
+	}
+
+	return output, nil
+}
+
+// podContainer is a container of a pod, of the given kind (e.g., init
+// container).
+type podContainer struct {
+	name string
+	kind string
+}
+
+// podContainers returns the init, regular and ephemeral containers of the pod,
+// in the order they start.
+func podContainers(pod corev1.Pod) []podContainer {
+	containers := make([]podContainer, 0,
+		len(pod.Spec.InitContainers)+len(pod.Spec.Containers)+len(pod.Spec.EphemeralContainers))
+	for _, container := range pod.Spec.InitContainers {
+		containers = append(containers, podContainer{name: container.Name, kind: "init container"})
+	}
+	for _, container := range pod.Spec.Containers {
+		containers = append(containers, podContainer{name: container.Name, kind: "container"})
+	}
+	for _, container := range pod.Spec.EphemeralContainers {
+		containers = append(containers, podContainer{name: container.Name, kind: "ephemeral container"})
+	}
+
+	return containers
+}
+
+// pods returns the pods addressed by args, and whether more pods match than
+// the maxLogPods returned.
+func (t *K8sLogsTool) pods(ctx context.Context, args logsCallArgs) ([]corev1.Pod, bool, error) {
+	if args.Pod != "" {
+		pod, err := t.client.Pods(args.Namespace).Get(ctx, args.Pod, metav1.GetOptions{})
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get pod: %w", err)
+		}
+
+		return []corev1.Pod{*pod}, false, nil
+	}
+
+	if args.LabelSelector == "" {
+		return nil, false, fmt.Errorf("either pod or labelSelector is required")
+	}
+
+	pods, err := t.client.Pods(args.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: args.LabelSelector,
+		Limit:         maxLogPods,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	if len(pods.Items) == 0 {
+		return nil, false, fmt.Errorf("no pods match %q", args.LabelSelector)
+	}
+
+	return pods.Items, pods.Continue != "", nil
+}
+
+// containerLines reads the log lines of a container that match grep.
+func (t *K8sLogsTool) containerLines(ctx context.Context, pod, container string, args logsCallArgs,
+	grep *regexp.Regexp) ([]string, error) {
+	options := &corev1.PodLogOptions{
+		Container: container,
+		Previous:  args.Previous,
+		TailLines: &args.TailLines,
+	}
+	if args.SinceSeconds > 0 {
+		options.SinceSeconds = &args.SinceSeconds
+	}
+
+	stream, err := t.client.Pods(args.Namespace).GetLogs(pod, options).Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if grep == nil || grep.MatchString(scanner.Text()) {
+			lines = append(lines, scanner.Text())
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// renderLogs renders the logs of the containers, keeping the most recent lines
+// of each container within an equal share of maxLogBytes.
+func renderLogs(logs []containerLogs, podsCapped bool) string {
+	budget := maxLogBytes / len(logs)
+
+	var output strings.Builder
+	if podsCapped {
+		fmt.Fprintf(&output, "(showing the first %d matching pods only)\n", maxLogPods)
+	}
+
+	for _, container := range logs {
+		output.WriteString(container.header + "\n")
+		if len(container.lines) == 0 {
+			output.WriteString("(no matching lines)\n")
+			continue
+		}
+
+		size, first := 0, len(container.lines)
+		for first > 0 && size+len(container.lines[first-1])+1 <= budget {
+			first--
+			size += len(container.lines[first]) + 1
+		}
+
+		if first > 0 {
+			fmt.Fprintf(&output, "...[%d earlier lines truncated, narrow down with tailLines, sinceSeconds or grep]\n",
+				first)
+		}
+
+		for _, line := range container.lines[first:] {
+			output.WriteString(line + "\n")
+		}
+	}
+
+	return output.String()
+}
@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestReadLogsNotesCappedPodsAndGrepWindow(t *testing.T) {
+	var pods []runtime.Object
+	for idx := 0; idx < maxLogPods; idx++ {
+		pods = append(pods, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("web-%d", idx), Namespace: "default",
+				Labels: map[string]string{"app": "web"}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		})
+	}
+
+	for _, more := range []bool{false, true} {
+		client := fake.NewSimpleClientset(pods...)
+		client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			list := &corev1.PodList{}
+			for _, pod := range pods {
+				list.Items = append(list.Items, *pod.(*corev1.Pod))
+			}
+			if more { // exactly maxLogPods pods are returned either way
+				list.Continue = "next"
+			}
+
+			return true, list, nil
+		})
+
+		tool := NewK8sLogsTool(client.CoreV1())
+		output, err := tool.readLogs(context.Background(), logsCallArgs{Namespace: "default",
+			LabelSelector: "app=web", TailLines: 50, Grep: "fake"})
+		if err != nil {
+			t.Fatalf("readLogs() error = %v", err)
+		}
+
+		if capped := strings.Contains(output, "matching pods only"); capped != more {
+			t.Errorf("more pods: %v, readLogs() notes capped pods: %v\n%s", more, capped, output)
+		}
+
+		if !strings.HasPrefix(output, "(grep filtered the last 50 lines of each container only)") {
+			t.Errorf("readLogs() does not note the grep window:\n%s", output)
+		}
+	}
+}
+
+func TestReadLogsOfInitAndEphemeralContainers(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "migrate"}},
+			Containers:     []corev1.Container{{Name: "app"}},
+			EphemeralContainers: []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger"}},
+			},
+		},
+	}
+	tool := NewK8sLogsTool(fake.NewSimpleClientset(pod).CoreV1())
+
+	output, err := tool.readLogs(context.Background(), logsCallArgs{Namespace: "default", Pod: "web"})
+	if err != nil {
+		t.Fatalf("readLogs() error = %v", err)
+	}
+
+	headers := []string{
+		"==> pod web, init container migrate <==",
+		"==> pod web, container app <==",
+		"==> pod web, ephemeral container debugger <==",
+	}
+	position := -1
+	for _, header := range headers {
+		next := strings.Index(output, header)
+		if next <= position {
+			t.Errorf("readLogs() = %q, want %q after the previous containers", output, header)
+		}
+		position = next
+	}
+
+	for _, container := range []string{"migrate", "debugger"} {
+		output, err := tool.readLogs(context.Background(), logsCallArgs{Namespace: "default", Pod: "web",
+			Container: container})
+		if err != nil || !strings.Contains(output, container) || strings.Contains(output, "container app") {
+			t.Errorf("readLogs(%s) = %q, %v, want the logs of %s only", container, output, err, container)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kube-agent/kuery/pkg/tools/api"
+
+	"github.com/tmc/langchaingo/llms"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+var (
+	_ api.Tool    = &K8sPermissionsTool{}
+	_ api.Mutator = &K8sPermissionsTool{}
+)
+
+// K8sPermissionsTool is a tool that summarizes the effective RBAC permissions
+// of the identity Kuery acts as, using SelfSubjectRulesReviews.
+type K8sPermissionsTool struct {
+	client authorizationv1client.AuthorizationV1Interface
+}
+
+// NewK8sPermissionsTool creates a new K8sPermissionsTool.
+func NewK8sPermissionsTool(client authorizationv1client.AuthorizationV1Interface) *K8sPermissionsTool {
+	return &K8sPermissionsTool{
+		client: client,
+	}
+}
+
+func (t *K8sPermissionsTool) Name() string {
+	return "K8sPermissions"
+}
+
+func (t *K8sPermissionsTool) LLMTool() *llms.Tool {
+	desc := `Summarize what you are allowed to do in the Kubernetes cluster, per namespace.
+			Use this tool when the user asks what can be done in a namespace, or before planning
+			cluster-affecting calls in a namespace you are not sure you have access to.`
+
+	return &llms.Tool{
+		Type: functionToolType,
+		Function: &llms.FunctionDefinition{
+			Name:        t.Name(),
+			Description: api.AddApprovalRequirementToDescription(t, desc),
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"namespaces": map[string]any{
+						"type":        "array",
+						"description": `The namespaces to summarize permissions for.`,
+						"items": map[string]any{
+							"type": "string",
+						},
+					},
+				},
+				"required": []string{"namespaces"},
+			},
+		},
+	}
+}
+
+func (t *K8sPermissionsTool) Call(ctx context.Context, toolCall *llms.ToolCall) (llms.ToolCallResponse, bool) {
+	var args struct {
+		Namespaces []string `json:"namespaces"`
+	}
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to unmarshal arguments: %v", err),
+		}, false
+	}
+
+	if len(args.Namespaces) == 0 {
+		args.Namespaces = []string{metav1.NamespaceDefault}
+	}
+
+	var summary strings.Builder
+	for _, namespace := range args.Namespaces {
+		namespaceSummary, err := t.summarizeNamespace(ctx, namespace)
+		if err != nil {
+			return llms.ToolCallResponse{
+				ToolCallID: toolCall.ID,
+				Name:       toolCall.FunctionCall.Name,
+				Content:    fmt.Sprintf("failed to review permissions: %v", err),
+			}, false
+		}
+
+		summary.WriteString(namespaceSummary)
+	}
+
+	return llms.ToolCallResponse{
+		ToolCallID: toolCall.ID,
+		Name:       toolCall.FunctionCall.Name,
+		Content:    summary.String(),
+	}, true
+}
+
+// RequiresExplaining returns whether the tool requires explaining after
+// execution.
+func (t *K8sPermissionsTool) RequiresExplaining() bool {
+	return true
+}
+
+// RequiresApproval returns whether the tool requires approval before
+// execution.
+func (t *K8sPermissionsTool) RequiresApproval() bool { return false }
+
+// Mutates returns whether the tool call may modify the cluster.
+func (t *K8sPermissionsTool) Mutates(_ *llms.ToolCall) bool { return false }
+
+// summarizeNamespace returns a line per resource rule the identity has in the
+// namespace, e.g. "get,list,watch: apps/deployments".
+func (t *K8sPermissionsTool) summarizeNamespace(ctx context.Context, namespace string) (string, error) {
+	if t.client == nil {
+		return "", fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	review, err := t.client.SelfSubjectRulesReviews().Create(ctx, &authorizationv1.SelfSubjectRulesReview{
+		Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to review rules in namespace %s: %w", namespace, err)
+	}
+
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "namespace %s:\n", namespace)
+
+	for _, rule := range review.Status.ResourceRules {
+		resources := make([]string, 0, len(rule.Resources)*len(rule.APIGroups))
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				if group == "" {
+					resources = append(resources, resource)
+				} else {
+					resources = append(resources, group+"/"+resource)
+				}
+			}
+		}
+
+		fmt.Fprintf(&summary, "- %s: %s", strings.Join(rule.Verbs, ","), strings.Join(resources, ","))
+		if len(rule.ResourceNames) > 0 {
+			fmt.Fprintf(&summary, " (only %s)", strings.Join(rule.ResourceNames, ","))
+		}
+		summary.WriteString("\n")
+	}
+
+	if review.Status.Incomplete {
+		fmt.Fprintf(&summary, "(the list may be incomplete: %s)\n", review.Status.EvaluationError)
+	}
+
+	return summary.String(), nil
+}
@@ -0,0 +1,208 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+)
+
+// maxResolverSuggestions is the maximum number of suggestions given when a
+// resource cannot be resolved.
+const maxResolverSuggestions = 5
+
+// ResourceResolver resolves kinds, short names and resource names to their
+// GroupVersionResource using a cached discovery RESTMapper.
+// The cache is invalidated when a resource cannot be found, so that resources
+// of newly installed CRDs are resolved without restarting Kuery.
+type ResourceResolver struct {
+	mu        sync.Mutex
+	discovery discovery.CachedDiscoveryInterface
+	mapper    *restmapper.DeferredDiscoveryRESTMapper
+	expander  meta.RESTMapper
+}
+
+// ResolvedResource is a resource resolved by a ResourceResolver.
+type ResolvedResource struct {
+	GVR        schema.GroupVersionResource
+	GVK        schema.GroupVersionKind
+	Namespaced bool
+}
+
+// NewResourceResolver creates a new ResourceResolver.
+func NewResourceResolver(client discovery.DiscoveryInterface) *ResourceResolver {
+	cachedDiscovery := memory.NewMemCacheClient(client)
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(cachedDiscovery)
+
+	return &ResourceResolver{
+		discovery: cachedDiscovery,
+		mapper:    mapper,
+		expander:  restmapper.NewShortcutExpander(mapper, cachedDiscovery, nil),
+	}
+}
+
+// Resolve resolves a kind (e.g. Deployment), resource (e.g. deployments) or
+// short name (e.g. deploy) to a resource. The apiVersion (e.g. apps/v1) is
+// optional, and narrows the resolution down to its group and version.
+func (r *ResourceResolver) Resolve(apiVersion, name string) (*ResolvedResource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid apiVersion %q: %w", apiVersion, err)
+	}
+
+	resolved, err := r.resolve(gv, name)
+	if meta.IsNoMatchError(err) { // the resource may be new, retry with fresh discovery
+		r.mapper.Reset()
+		resolved, err = r.resolve(gv, name)
+	}
+
+	if meta.IsNoMatchError(err) {
+		if suggestions := r.suggest(name); len(suggestions) > 0 {
+			return nil, fmt.Errorf("no resource matches %q, did you mean one of: %s",
+				name, strings.Join(suggestions, ", "))
+		}
+
+		return nil, fmt.Errorf("no resource matches %q", name)
+	}
+
+	return resolved, err
+}
+
+// Invalidate drops the discovery cache, e.g. after a CRD was installed.
+func (r *ResourceResolver) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.mapper.Reset()
+}
+
+func (r *ResourceResolver) resolve(gv schema.GroupVersion, name string) (*ResolvedResource, error) {
+	var versions []string
+	if gv.Version != "" {
+		versions = append(versions, gv.Version)
+	}
+
+	mapping, kindErr := r.expander.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: name}, versions...)
+	if kindErr != nil { // not a kind, try as a resource or short name
+		gvr, err := r.expander.ResourceFor(gv.WithResource(strings.ToLower(name)))
+		if err != nil {
+			return nil, err
+		}
+
+		gvk, err := r.expander.KindFor(gvr)
+		if err != nil {
+			return nil, err
+		}
+
+		mapping, err = r.expander.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the kind of a mapping is the kind asked for, in whichever case it was asked
+	gvk, err := r.expander.KindFor(mapping.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResolvedResource{
+		GVR:        mapping.Resource,
+		GVK:        gvk,
+		Namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+	}, nil
+}
+
+// suggest returns the kinds whose names (resource, singular, short or kind)
+// are similar to name.
+func (r *ResourceResolver) suggest(name string) []string {
+	// partial results are fine for suggestions
+	resourceLists, _ := r.discovery.ServerPreferredResources()
+
+	name = strings.ToLower(name)
+	distances := make(map[string]int)
+	for _, resourceList := range resourceLists {
+		gv, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			continue
+		}
+
+		for _, resource := range resourceList.APIResources {
+			if strings.Contains(resource.Name, "/") { // subresource
+				continue
+			}
+
+			suggestion := fmt.Sprintf("%s (resource %s, apiVersion %s)", resource.Kind, resource.Name, gv.String())
+			names := append([]string{resource.Name, resource.SingularName, strings.ToLower(resource.Kind)},
+				resource.ShortNames...)
+			for _, candidate := range names {
+				if candidate == "" {
+					continue
+				}
+
+				distance := levenshtein(name, candidate)
+				if strings.Contains(candidate, name) || strings.Contains(name, candidate) {
+					distance = min(distance, 1)
+				}
+
+				if best, ok := distances[suggestion]; distance <= 2 && (!ok || distance < best) {
+					distances[suggestion] = distance
+				}
+			}
+		}
+	}
+
+	suggestions := make([]string, 0, len(distances))
+	for suggestion := range distances {
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if distances[suggestions[i]] != distances[suggestions[j]] {
+			return distances[suggestions[i]] < distances[suggestions[j]]
+		}
+
+		return suggestions[i] < suggestions[j]
+	})
+
+	if len(suggestions) > maxResolverSuggestions {
+		suggestions = suggestions[:maxResolverSuggestions]
+	}
+
+	return suggestions
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			substitution := previous[j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+		}
+
+		previous = current
+	}
+
+	return previous[len(b)]
+}
@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testAPIResources are the resources known to the resolvers of tests.
+var testAPIResources = []*metav1.APIResourceList{
+	{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "secrets", SingularName: "secret", Namespaced: true, Kind: "Secret"},
+			{Name: "configmaps", SingularName: "configmap", Namespaced: true, Kind: "ConfigMap", ShortNames: []string{"cm"}},
+			{Name: "namespaces", SingularName: "namespace", Kind: "Namespace", ShortNames: []string{"ns"}},
+			{Name: "pods", SingularName: "pod", Namespaced: true, Kind: "Pod", ShortNames: []string{"po"}},
+		},
+	},
+	{
+		GroupVersion: "apps/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "deployments", SingularName: "deployment", Namespaced: true, Kind: "Deployment",
+				ShortNames: []string{"deploy"}},
+		},
+	},
+}
+
+// newTestResolver returns a ResourceResolver of testAPIResources.
+func newTestResolver() *ResourceResolver {
+	client := fake.NewSimpleClientset()
+	client.Discovery().(*fakediscovery.FakeDiscovery).Resources = testAPIResources
+
+	return NewResourceResolver(client.Discovery())
+}
+
+func TestResolve(t *testing.T) {
+	resolver := newTestResolver()
+
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	namespaces := schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+	for _, tc := range []struct {
+		apiVersion, name string
+		want             schema.GroupVersionResource
+		wantKind         string
+		wantNamespaced   bool
+	}{
+		{name: "Deployment", want: deployments, wantKind: "Deployment", wantNamespaced: true},
+		{apiVersion: "apps/v1", name: "Deployment", want: deployments, wantKind: "Deployment", wantNamespaced: true},
+		{name: "deployments", want: deployments, wantKind: "Deployment", wantNamespaced: true},
+		{name: "deployment", want: deployments, wantKind: "Deployment", wantNamespaced: true},
+		{name: "deploy", want: deployments, wantKind: "Deployment", wantNamespaced: true},
+		{name: "Deployments", want: deployments, wantKind: "Deployment", wantNamespaced: true},
+		{name: "cm", want: configMaps, wantKind: "ConfigMap", wantNamespaced: true},
+		{apiVersion: "v1", name: "configmap", want: configMaps, wantKind: "ConfigMap", wantNamespaced: true},
+		{name: "configMap", want: configMaps, wantKind: "ConfigMap", wantNamespaced: true},
+		{name: "Namespace", want: namespaces, wantKind: "Namespace"},
+		{name: "ns", want: namespaces, wantKind: "Namespace"},
+	} {
+		resolved, err := resolver.Resolve(tc.apiVersion, tc.name)
+		if err != nil {
+			t.Errorf("Resolve(%q, %q) error = %v", tc.apiVersion, tc.name, err)
+			continue
+		}
+
+		if resolved.GVR != tc.want || resolved.GVK.Kind != tc.wantKind || resolved.Namespaced != tc.wantNamespaced {
+			t.Errorf("Resolve(%q, %q) = %+v, want %s of kind %s, namespaced: %v", tc.apiVersion, tc.name,
+				resolved, tc.want, tc.wantKind, tc.wantNamespaced)
+		}
+	}
+}
+
+func TestResolveSuggestsSimilarResources(t *testing.T) {
+	resolver := newTestResolver()
+
+	for _, tc := range []struct {
+		apiVersion, name, want string
+	}{
+		{name: "deploymnet", want: "did you mean one of: Deployment (resource deployments, apiVersion apps/v1)"},
+		{name: "secert", want: "Secret (resource secrets, apiVersion v1)"},
+		{apiVersion: "apps/v2", name: "Deployment", want: "Deployment (resource deployments, apiVersion apps/v1)"},
+		{name: "virtualmachines", want: `no resource matches "virtualmachines"`},
+	} {
+		_, err := resolver.Resolve(tc.apiVersion, tc.name)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Resolve(%q, %q) error = %v, want %q", tc.apiVersion, tc.name, err, tc.want)
+		}
+	}
+
+	if _, err := resolver.Resolve("apps/v1/extra", "Deployment"); err == nil ||
+		!strings.Contains(err.Error(), "invalid apiVersion") {
+		t.Errorf("Resolve() of an invalid apiVersion error = %v, want it rejected", err)
+	}
+}
+
+func TestResolveRefreshesDiscoveryOnNoMatch(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	discovery := client.Discovery().(*fakediscovery.FakeDiscovery)
+	discovery.Resources = testAPIResources
+	resolver := NewResourceResolver(discovery)
+
+	if _, err := resolver.Resolve("", "Widget"); err == nil {
+		t.Fatal("Resolve() of a resource that is not installed succeeded")
+	}
+
+	// the CRD of widgets is installed after the discovery was cached
+	discovery.Resources = append(slices.Clone(testAPIResources), &metav1.APIResourceList{
+		GroupVersion: "example.com/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "widgets", SingularName: "widget", Namespaced: true, Kind: "Widget", ShortNames: []string{"wd"}},
+		},
+	})
+
+	resolved, err := resolver.Resolve("", "wd")
+	if want := (schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}); err != nil ||
+		resolved.GVR != want {
+		t.Errorf("Resolve() after the CRD was installed = %+v, %v, want %s", resolved, err, want)
+	}
+}
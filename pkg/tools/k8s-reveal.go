@@ -0,0 +1,245 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kube-agent/kuery/pkg/tools/api"
+
+	"github.com/tmc/langchaingo/llms"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ValueRevealer stops redacting values in the tool responses of a session.
+type ValueRevealer interface {
+	// RevealValues stops redacting the given values.
+	RevealValues(values ...string)
+}
+
+var (
+	_ api.Tool             = &K8sRevealTool{}
+	_ api.Describer        = &K8sRevealTool{}
+	_ api.ApprovalEnforcer = &K8sRevealTool{}
+)
+
+// K8sRevealTool is a tool that reveals the values of specific keys of a
+// Secret (or ConfigMap) to the LLM, which are otherwise redacted from tool
+// responses. Every call requires the explicit approval of the user, and is
+// audited like the calls that affect the cluster.
+type K8sRevealTool struct {
+	client   corev1client.CoreV1Interface
+	revealer ValueRevealer
+}
+
+// NewK8sRevealTool creates a new K8sRevealTool revealing values through
+// revealer.
+func NewK8sRevealTool(client corev1client.CoreV1Interface, revealer ValueRevealer) *K8sRevealTool {
+	return &K8sRevealTool{
+		client:   client,
+		revealer: revealer,
+	}
+}
+
+type revealCallArgs struct {
+	Kind      string   `json:"kind"`
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Keys      []string `json:"keys"`
+	Reason    string   `json:"reason"`
+}
+
+func (t *K8sRevealTool) Name() string {
+	return "K8sRevealSecretValues"
+}
+
+func (t *K8sRevealTool) LLMTool() *llms.Tool {
+	desc := `Reveal the values of specific keys of a Secret (or ConfigMap) that are redacted from the responses of
+			all other tools, as <redacted>. Only use this tool when the user needs the values themselves, never to
+			troubleshoot what the keys and metadata already tell. Once revealed, the values are no longer redacted
+			in this session.`
+
+	return &llms.Tool{
+		Type: functionToolType,
+		Function: &llms.FunctionDefinition{
+			Name:        t.Name(),
+			Description: api.AddApprovalRequirementToDescription(t, desc),
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"kind": map[string]any{
+						"type":        "string",
+						"description": `The kind of the object: Secret (default) or ConfigMap.`,
+					},
+					"namespace": map[string]any{
+						"type":        "string",
+						"description": `The namespace of the object.`,
+					},
+					"name": map[string]any{
+						"type":        "string",
+						"description": `The name of the object.`,
+					},
+					"keys": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": `The keys of the data of the object to reveal the values of, as few as possible.`,
+					},
+					"reason": map[string]any{
+						"type":        "string",
+						"description": `Why the values must be revealed, shown to the user and audited.`,
+					},
+				},
+				"required": []string{"namespace", "name", "keys", "reason"},
+			},
+		},
+	}
+}
+
+func (t *K8sRevealTool) Call(ctx context.Context, toolCall *llms.ToolCall) (llms.ToolCallResponse, bool) {
+	args, err := parseRevealArgs(toolCall)
+	if err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    err.Error(),
+		}, false
+	}
+
+	data, err := t.data(ctx, args)
+	if err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to get %s %s/%s: %v", args.Kind, args.Namespace, args.Name, err),
+		}, false
+	}
+
+	values := make(map[string]string, len(args.Keys))
+	for _, key := range args.Keys {
+		value, ok := data[key]
+		if !ok {
+			keys := make([]string, 0, len(data))
+			for key := range data {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+
+			return llms.ToolCallResponse{
+				ToolCallID: toolCall.ID,
+				Name:       toolCall.FunctionCall.Name,
+				Content: fmt.Sprintf("%s %s/%s has no key %q, its keys are: %s", args.Kind, args.Namespace,
+					args.Name, key, strings.Join(keys, ", ")),
+			}, false
+		}
+
+		values[key] = value
+	}
+
+	revealed := make([]string, 0, len(values))
+	for _, value := range values {
+		revealed = append(revealed, value)
+	}
+	t.revealer.RevealValues(revealed...)
+
+	content, err := yaml.Marshal(map[string]any{ // rendered as an object for the redaction to keep its structure
+		"object": fmt.Sprintf("%s %s/%s", args.Kind, args.Namespace, args.Name),
+		"values": values,
+		"note":   "do not repeat the values unless the user asks to",
+	})
+	if err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to render values: %v", err),
+		}, false
+	}
+
+	return llms.ToolCallResponse{
+		ToolCallID: toolCall.ID,
+		Name:       toolCall.FunctionCall.Name,
+		Content:    string(content),
+	}, true
+}
+
+// data returns the data of the object addressed by args, with the values of
+// Secrets decoded.
+func (t *K8sRevealTool) data(ctx context.Context, args revealCallArgs) (map[string]string, error) {
+	data := make(map[string]string)
+
+	switch args.Kind {
+	case "Secret":
+		secret, err := t.client.Secrets(args.Namespace).Get(ctx, args.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range secret.Data {
+			data[key] = string(value)
+		}
+	case "ConfigMap":
+		configMap, err := t.client.ConfigMaps(args.Namespace).Get(ctx, args.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range configMap.Data {
+			data[key] = value
+		}
+	}
+
+	return data, nil
+}
+
+// Describe renders what the call reveals, and why, for the user to approve.
+func (t *K8sRevealTool) Describe(_ context.Context, toolCall *llms.ToolCall) (string, error) {
+	args, err := parseRevealArgs(toolCall)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Reveal the values of keys %s of %s %s/%s to the LLM provider.\nReason: %s",
+		strings.Join(args.Keys, ", "), args.Kind, args.Namespace, args.Name, args.Reason), nil
+}
+
+// parseRevealArgs parses and validates the arguments of a call.
+func parseRevealArgs(toolCall *llms.ToolCall) (revealCallArgs, error) {
+	var args revealCallArgs
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return args, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+
+	if args.Kind == "" {
+		args.Kind = "Secret"
+	}
+
+	switch {
+	case args.Kind != "Secret" && args.Kind != "ConfigMap":
+		return args, fmt.Errorf("invalid kind %q, expected Secret or ConfigMap", args.Kind)
+	case args.Namespace == "" || args.Name == "":
+		return args, fmt.Errorf("namespace and name are required")
+	case len(args.Keys) == 0:
+		return args, fmt.Errorf("at least one key is required")
+	case strings.TrimSpace(args.Reason) == "":
+		return args, fmt.Errorf("a reason is required")
+	}
+
+	return args, nil
+}
+
+// RequiresExplaining returns whether the tool requires explaining after
+// execution.
+func (t *K8sRevealTool) RequiresExplaining() bool {
+	return true
+}
+
+// RequiresApproval returns whether the tool requires approval before
+// execution. Revealing values always does, and is therefore audited.
+func (t *K8sRevealTool) RequiresApproval() bool { return true }
+
+// EnforcesApproval returns whether the tool call requires approval regardless
+// of the policy. Revealing values always does, the policy may only deny it.
+func (t *K8sRevealTool) EnforcesApproval(_ *llms.ToolCall) bool { return true }
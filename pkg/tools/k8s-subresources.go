@@ -0,0 +1,343 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kube-agent/kuery/pkg/render"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// restartedAtAnnotation is the pod template annotation that triggers a
+// rollout restart, as set by `kubectl rollout restart`.
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// subresources maps the operations of the tool that address a subresource
+// to it.
+var subresources = map[string]string{
+	"SCALE":  "scale",
+	"STATUS": "status",
+}
+
+// rolloutResources are the resources rollout operations apply to, and the
+// rollout operations each of them supports.
+var rolloutResources = map[schema.GroupResource]map[string]bool{
+	{Group: "apps", Resource: "deployments"}: {
+		"ROLLOUT_STATUS": true, "ROLLOUT_RESTART": true, "ROLLOUT_PAUSE": true, "ROLLOUT_RESUME": true,
+		"ROLLOUT_UNDO": true,
+	},
+	{Group: "apps", Resource: "statefulsets"}: {"ROLLOUT_STATUS": true, "ROLLOUT_RESTART": true},
+	{Group: "apps", Resource: "daemonsets"}:   {"ROLLOUT_STATUS": true, "ROLLOUT_RESTART": true},
+}
+
+var replicaSetsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}
+
+// subresourcePath returns the subresource path segments of the operation,
+// which are empty for operations on the main resource.
+func subresourcePath(operation string) []string {
+	if subresource, ok := subresources[operation]; ok {
+		return []string{subresource}
+	}
+
+	return nil
+}
+
+// isSubresourceOperation returns whether the operation is a mutating
+// subresource or rollout operation.
+func isSubresourceOperation(operation string) bool {
+	return operation == "SCALE" || (strings.HasPrefix(operation, "ROLLOUT_") && operation != "ROLLOUT_STATUS")
+}
+
+// getStatus returns the status of the resource addressed by args.
+func (k *K8sDynamicClient) getStatus(ctx context.Context, args dynamicCallArgs) (string, error) {
+	obj, err := k.resource(args).Get(ctx, args.Name, metav1.GetOptions{}, subresources["STATUS"])
+	if err != nil {
+		return "", fmt.Errorf("failed to get resource status (namespacedName=%s): %w",
+			args.Namespace+"/"+args.Name, err)
+	}
+
+	status, ok := obj.Object["status"]
+	if !ok {
+		return fmt.Sprintf("resource (namespacedName=%s) has no status", args.Namespace+"/"+args.Name), nil
+	}
+
+	return render.Object(&unstructured.Unstructured{Object: map[string]any{"status": status}},
+		render.DefaultOptions(args.Expand...))
+}
+
+// rolloutStatus summarizes the progress of the rollout of the workload
+// addressed by args, similarly to `kubectl rollout status`.
+func (k *K8sDynamicClient) rolloutStatus(ctx context.Context, args dynamicCallArgs) (string, error) {
+	if err := checkRolloutResource(args); err != nil {
+		return "", err
+	}
+
+	obj, err := k.resource(args).Get(ctx, args.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get resource (namespacedName=%s): %w", args.Namespace+"/"+args.Name, err)
+	}
+
+	status := func(fields ...string) int64 {
+		value, _, _ := unstructured.NestedInt64(obj.Object, append([]string{"status"}, fields...)...)
+		return value
+	}
+
+	if status("observedGeneration") < obj.GetGeneration() {
+		return "waiting for the rollout to be observed by the controller", nil
+	}
+
+	switch args.Resource {
+	case "deployments":
+		if paused, _, _ := unstructured.NestedBool(obj.Object, "spec", "paused"); paused {
+			return "the rollout is paused, resume it to continue", nil
+		}
+
+		conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		for _, condition := range conditions {
+			condition, _ := condition.(map[string]any)
+			if condition["type"] == "Progressing" && condition["reason"] == "ProgressDeadlineExceeded" {
+				return fmt.Sprintf("the rollout failed: %v", condition["message"]), nil
+			}
+		}
+
+		replicas := specReplicas(obj)
+		switch {
+		case status("updatedReplicas") < replicas:
+			return fmt.Sprintf("waiting for the rollout to finish: %d of %d new replicas have been updated",
+				status("updatedReplicas"), replicas), nil
+		case status("replicas") > status("updatedReplicas"):
+			return fmt.Sprintf("waiting for the rollout to finish: %d old replicas are pending termination",
+				status("replicas")-status("updatedReplicas")), nil
+		case status("availableReplicas") < status("updatedReplicas"):
+			return fmt.Sprintf("waiting for the rollout to finish: %d of %d updated replicas are available",
+				status("availableReplicas"), status("updatedReplicas")), nil
+		}
+	case "statefulsets":
+		replicas := specReplicas(obj)
+		switch {
+		case status("readyReplicas") < replicas:
+			return fmt.Sprintf("waiting for %d pods to be ready", replicas-status("readyReplicas")), nil
+		case status("updatedReplicas") < replicas:
+			return fmt.Sprintf("waiting for the rollout to finish: %d of %d pods have been updated",
+				status("updatedReplicas"), replicas), nil
+		}
+
+		current, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+		update, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+		if current != update {
+			return fmt.Sprintf("waiting for the rollout to finish: revision %s is rolling out", update), nil
+		}
+	case "daemonsets":
+		desired := status("desiredNumberScheduled")
+		switch {
+		case status("updatedNumberScheduled") < desired:
+			return fmt.Sprintf("waiting for the rollout to finish: %d of %d updated pods have been scheduled",
+				status("updatedNumberScheduled"), desired), nil
+		case status("numberAvailable") < desired:
+			return fmt.Sprintf("waiting for the rollout to finish: %d of %d updated pods are available",
+				status("numberAvailable"), desired), nil
+		}
+	}
+
+	return fmt.Sprintf("%s %q successfully rolled out", strings.TrimSuffix(args.Resource, "s"), args.Name), nil
+}
+
+// mutateSubresource performs the scale or rollout operation of args, and
+// returns the resulting object (the Scale for SCALE). If dryRun is set, the
+// operation is not persisted.
+func (k *K8sDynamicClient) mutateSubresource(ctx context.Context, args dynamicCallArgs,
+	dryRun []string) (*unstructured.Unstructured, error) {
+	if args.Operation == "SCALE" {
+		if args.Replicas == nil {
+			return nil, fmt.Errorf("replicas is required for SCALE")
+		}
+
+		patch := fmt.Sprintf(`{"spec":{"replicas":%d}}`, *args.Replicas)
+		obj, err := k.resource(args).Patch(ctx, args.Name, types.MergePatchType, []byte(patch),
+			metav1.PatchOptions{FieldManager: fieldManager, DryRun: dryRun}, subresources["SCALE"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to scale resource: %w", err)
+		}
+
+		return obj, nil
+	}
+
+	if err := checkRolloutResource(args); err != nil {
+		return nil, err
+	}
+
+	var (
+		patchType = types.MergePatchType
+		patch     []byte
+	)
+
+	switch args.Operation {
+	case "ROLLOUT_RESTART":
+		patch = []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+			restartedAtAnnotation, time.Now().Format(time.RFC3339)))
+	case "ROLLOUT_PAUSE":
+		patch = []byte(`{"spec":{"paused":true}}`)
+	case "ROLLOUT_RESUME":
+		patch = []byte(`{"spec":{"paused":null}}`)
+	case "ROLLOUT_UNDO":
+		var err error
+		if patch, err = k.undoPatch(ctx, args); err != nil {
+			return nil, err
+		}
+		patchType = types.JSONPatchType
+	}
+
+	obj, err := k.resource(args).Patch(ctx, args.Name, patchType, patch,
+		metav1.PatchOptions{FieldManager: fieldManager, DryRun: dryRun})
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s: %w", rolloutVerb(args.Operation), err)
+	}
+
+	return obj, nil
+}
+
+// subresourceOperation performs the scale or rollout operation of args and
+// summarizes its outcome.
+func (k *K8sDynamicClient) subresourceOperation(ctx context.Context, args dynamicCallArgs) (string, error) {
+	namespacedName := args.Namespace + "/" + args.Name
+
+	if args.Operation == "SCALE" {
+		current, err := k.resource(args).Get(ctx, args.Name, metav1.GetOptions{}, subresources["SCALE"])
+		if err != nil {
+			return "", fmt.Errorf("failed to get scale (namespacedName=%s): %w", namespacedName, err)
+		}
+
+		if _, err := k.mutateSubresource(ctx, args, nil); err != nil {
+			return "", err
+		}
+
+		replicas, _, _ := unstructured.NestedInt64(current.Object, "spec", "replicas")
+
+		return fmt.Sprintf("scaled resource (namespacedName=%s) from %d to %d replicas", namespacedName,
+			replicas, *args.Replicas), nil
+	}
+
+	if _, err := k.mutateSubresource(ctx, args, nil); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s of resource (namespacedName=%s) succeeded, use ROLLOUT_STATUS to follow it",
+		rolloutVerb(args.Operation), namespacedName), nil
+}
+
+// undoPatch returns a JSON patch rolling the Deployment addressed by args back
+// to the pod template of one of its ReplicaSets: the given revision, or the
+// one preceding the current revision.
+func (k *K8sDynamicClient) undoPatch(ctx context.Context, args dynamicCallArgs) ([]byte, error) {
+	deployment, err := k.resource(args).Get(ctx, args.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	if paused, _, _ := unstructured.NestedBool(deployment.Object, "spec", "paused"); paused {
+		return nil, fmt.Errorf("cannot undo the rollout of a paused deployment, resume it first")
+	}
+
+	selectorMap, _, _ := unstructured.NestedMap(deployment.Object, "spec", "selector")
+	var selector metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(selectorMap, &selector); err != nil {
+		return nil, fmt.Errorf("failed to convert the deployment selector: %w", err)
+	}
+
+	replicaSets, err := k.client.Resource(replicaSetsGVR).Namespace(args.Namespace).List(ctx,
+		metav1.ListOptions{LabelSelector: metav1.FormatLabelSelector(&selector)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets: %w", err)
+	}
+
+	revisions := map[int64]*unstructured.Unstructured{}
+	for i := range replicaSets.Items {
+		replicaSet := &replicaSets.Items[i]
+		if owner := metav1.GetControllerOf(replicaSet); owner == nil || owner.UID != deployment.GetUID() {
+			continue
+		}
+
+		if revision, err := strconv.ParseInt(replicaSet.GetAnnotations()[revisionAnnotation], 10, 64); err == nil {
+			revisions[revision] = replicaSet
+		}
+	}
+
+	current, _ := strconv.ParseInt(deployment.GetAnnotations()[revisionAnnotation], 10, 64)
+	target := args.Revision
+	if target == 0 {
+		var previous []int64
+		for revision := range revisions {
+			if revision < current {
+				previous = append(previous, revision)
+			}
+		}
+
+		if len(previous) == 0 {
+			return nil, fmt.Errorf("no rollout history found for deployment %q", args.Name)
+		}
+
+		sort.Slice(previous, func(i, j int) bool { return previous[i] > previous[j] })
+		target = previous[0]
+	}
+
+	replicaSet, ok := revisions[target]
+	if !ok {
+		available := make([]string, 0, len(revisions))
+		for revision := range revisions {
+			available = append(available, strconv.FormatInt(revision, 10))
+		}
+		sort.Strings(available)
+
+		return nil, fmt.Errorf("revision %d not found, available revisions: %s", target, strings.Join(available, ", "))
+	}
+
+	template, _, _ := unstructured.NestedMap(replicaSet.Object, "spec", "template")
+	unstructured.RemoveNestedField(template, "metadata", "labels", "pod-template-hash")
+
+	return json.Marshal([]map[string]any{{
+		"op":    "replace",
+		"path":  "/spec/template",
+		"value": template,
+	}})
+}
+
+// checkRolloutResource returns an error if the rollout operation of args is
+// not supported by its resource.
+func checkRolloutResource(args dynamicCallArgs) error {
+	operations, ok := rolloutResources[args.gvr().GroupResource()]
+	if !ok {
+		return fmt.Errorf("%v is only supported for deployments, statefulsets and daemonsets", args.Operation)
+	}
+
+	if !operations[args.Operation] {
+		return fmt.Errorf("%v is not supported for %s", args.Operation, args.Resource)
+	}
+
+	return nil
+}
+
+// rolloutVerb returns a human-readable name of a mutating operation.
+func rolloutVerb(operation string) string {
+	return strings.ReplaceAll(strings.ToLower(operation), "_", " ")
+}
+
+// specReplicas returns the desired replicas of a workload, which default
+// to 1.
+func specReplicas(obj *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+
+	return replicas
+}
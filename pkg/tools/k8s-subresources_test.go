@@ -0,0 +1,215 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kube-agent/kuery/pkg/tools/api"
+	"github.com/tmc/langchaingo/llms"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// testPodTemplate returns a pod template of the web Deployment running the
+// given image.
+func testPodTemplate(image string, labels map[string]any) map[string]any {
+	return map[string]any{
+		"metadata": map[string]any{"labels": labels},
+		"spec":     map[string]any{"containers": []any{map[string]any{"name": "web", "image": image}}},
+	}
+}
+
+// newRolloutClient returns a dynamic client holding the web Deployment at
+// revision 3, and the ReplicaSets of its revisions 1 to 3.
+func newRolloutClient(deploymentFields map[string]any) *dynamicfake.FakeDynamicClient {
+	deployment := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]any{
+			"name": "web", "namespace": "default", "uid": "deploy", "generation": int64(4),
+			"annotations": map[string]any{revisionAnnotation: "3"},
+		},
+		"spec": map[string]any{
+			"replicas": int64(2),
+			"selector": map[string]any{"matchLabels": map[string]any{"app": "web"}},
+			"template": testPodTemplate("web:v3", map[string]any{"app": "web"}),
+		},
+		"status": map[string]any{
+			"observedGeneration": int64(4), "replicas": int64(2), "updatedReplicas": int64(2),
+			"availableReplicas": int64(2),
+		},
+	}}
+	for field, value := range deploymentFields {
+		_ = unstructured.SetNestedField(deployment.Object, value, strings.Split(field, ".")...)
+	}
+
+	objects := []runtime.Object{deployment}
+	for revision := 1; revision <= 3; revision++ {
+		objects = append(objects, &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "ReplicaSet",
+			"metadata": map[string]any{
+				"name":        fmt.Sprintf("web-%d", revision),
+				"namespace":   "default",
+				"labels":      map[string]any{"app": "web"},
+				"annotations": map[string]any{revisionAnnotation: fmt.Sprint(revision)},
+				"ownerReferences": []any{map[string]any{
+					"apiVersion": "apps/v1", "kind": "Deployment", "name": "web", "uid": "deploy", "controller": true,
+				}},
+			},
+			"spec": map[string]any{
+				"template": testPodTemplate(fmt.Sprintf("web:v%d", revision),
+					map[string]any{"app": "web", "pod-template-hash": fmt.Sprintf("hash%d", revision)}),
+			},
+		}})
+	}
+
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{replicaSetsGVR: "ReplicaSetList"}, objects...)
+}
+
+func TestSubresourceOperations(t *testing.T) {
+	client := newRolloutClient(nil)
+	tool := NewK8sDynamicClient(client)
+
+	content, ok := callDynamicClient(tool, "SCALE", `,"replicas":5`)
+	if want := "scaled resource (namespacedName=default/web) from 2 to 5 replicas"; !ok || content != want {
+		t.Errorf("SCALE = %q, %v, want %q", content, ok, want)
+	}
+	if replicas := specReplicas(getDeployment(t, client)); replicas != 5 {
+		t.Errorf("replicas after SCALE = %d, want 5", replicas)
+	}
+
+	if content, ok := callDynamicClient(tool, "SCALE", ""); ok || !strings.Contains(content, "replicas is required") {
+		t.Errorf("SCALE without replicas = %q, %v, want an error", content, ok)
+	}
+
+	content, ok = callDynamicClient(tool, "STATUS", "")
+	if !ok || !strings.Contains(content, "status:") || !strings.Contains(content, "updatedReplicas: 2") ||
+		strings.Contains(content, "template") {
+		t.Errorf("STATUS = %q, %v, want the status only", content, ok)
+	}
+
+	if _, ok := callDynamicClient(tool, "ROLLOUT_RESTART", ""); !ok {
+		t.Error("ROLLOUT_RESTART failed")
+	}
+	annotations, _, _ := unstructured.NestedStringMap(getDeployment(t, client).Object,
+		"spec", "template", "metadata", "annotations")
+	if annotations[restartedAtAnnotation] == "" {
+		t.Errorf("template annotations after ROLLOUT_RESTART = %v, want %s", annotations, restartedAtAnnotation)
+	}
+
+	for _, operation := range []string{"ROLLOUT_PAUSE", "ROLLOUT_RESUME", "ROLLOUT_PAUSE"} {
+		if _, ok := callDynamicClient(tool, operation, ""); !ok {
+			t.Fatalf("%s failed", operation)
+		}
+
+		paused, _, _ := unstructured.NestedBool(getDeployment(t, client).Object, "spec", "paused")
+		if want := operation == "ROLLOUT_PAUSE"; paused != want {
+			t.Errorf("paused after %s = %v, want %v", operation, paused, want)
+		}
+	}
+
+	if content, ok := callDynamicClient(tool, "ROLLOUT_UNDO", ""); ok || !strings.Contains(content, "resume it first") {
+		t.Errorf("ROLLOUT_UNDO of a paused deployment = %q, %v, want an error", content, ok)
+	}
+}
+
+func TestRolloutUndo(t *testing.T) {
+	for _, tc := range []struct {
+		name, arguments, wantImage, wantErr string
+	}{
+		{name: "previous revision", wantImage: "web:v2"},
+		{name: "given revision", arguments: `,"revision":1`, wantImage: "web:v1"},
+		{name: "unknown revision", arguments: `,"revision":7`, wantImage: "web:v3",
+			wantErr: "revision 7 not found, available revisions: 1, 2, 3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newRolloutClient(nil)
+
+			content, ok := callDynamicClient(NewK8sDynamicClient(client), "ROLLOUT_UNDO", tc.arguments)
+			if ok != (tc.wantErr == "") || !strings.Contains(content, tc.wantErr) {
+				t.Errorf("ROLLOUT_UNDO = %q, %v, want error %q", content, ok, tc.wantErr)
+			}
+
+			template, _, _ := unstructured.NestedMap(getDeployment(t, client).Object, "spec", "template")
+			containers, _, _ := unstructured.NestedSlice(template, "spec", "containers")
+			if image := containers[0].(map[string]any)["image"]; image != tc.wantImage {
+				t.Errorf("image after ROLLOUT_UNDO = %v, want %s", image, tc.wantImage)
+			}
+
+			// the ReplicaSet's pod-template-hash must not leak into the deployment's template
+			if labels, _, _ := unstructured.NestedStringMap(template, "metadata", "labels"); len(labels) != 1 {
+				t.Errorf("template labels after ROLLOUT_UNDO = %v, want only app", labels)
+			}
+		})
+	}
+}
+
+func TestRolloutStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		fields map[string]any
+		want   string
+	}{
+		{name: "rolled out", want: `deployment "web" successfully rolled out`},
+		{name: "not observed", fields: map[string]any{"status.observedGeneration": int64(3)},
+			want: "waiting for the rollout to be observed by the controller"},
+		{name: "paused", fields: map[string]any{"spec.paused": true},
+			want: "the rollout is paused, resume it to continue"},
+		{name: "updating", fields: map[string]any{"status.updatedReplicas": int64(1)},
+			want: "waiting for the rollout to finish: 1 of 2 new replicas have been updated"},
+		{name: "unavailable", fields: map[string]any{"status.availableReplicas": int64(1)},
+			want: "waiting for the rollout to finish: 1 of 2 updated replicas are available"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			content, ok := callDynamicClient(NewK8sDynamicClient(newRolloutClient(tc.fields)), "ROLLOUT_STATUS", "")
+			if !ok || content != tc.want {
+				t.Errorf("ROLLOUT_STATUS = %q, %v, want %q", content, ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestSubresourceOperationsApprovalClassification(t *testing.T) {
+	tool := NewK8sDynamicClient(newRolloutClient(nil))
+	mgr := api.NewToolManager().WithReadOnly(true).WithTool(tool, 1)
+
+	if !tool.RequiresApproval() {
+		t.Error("RequiresApproval() = false, want the tool's calls to require approval unless a policy allows them")
+	}
+
+	for operation, mutates := range map[string]bool{
+		"STATUS":          false,
+		"ROLLOUT_STATUS":  false,
+		"SCALE":           true,
+		"ROLLOUT_RESTART": true,
+		"ROLLOUT_PAUSE":   true,
+		"ROLLOUT_RESUME":  true,
+		"ROLLOUT_UNDO":    true,
+	} {
+		toolCall := &llms.ToolCall{FunctionCall: &llms.FunctionCall{Name: tool.Name(), Arguments: fmt.Sprintf(
+			`{"operation":%q,"group":"apps","version":"v1","resource":"deployments","namespace":"default",`+
+				`"name":"web","replicas":1}`, operation)}}
+
+		if got := tool.Mutates(toolCall); got != mutates {
+			t.Errorf("Mutates(%s) = %v, want %v", operation, got, mutates)
+		}
+
+		if err := mgr.Preflight(context.Background(), toolCall); (err != nil) != mutates {
+			t.Errorf("read-only Preflight(%s) = %v, want refused: %v", operation, err, mutates)
+		}
+
+		if verb, ok := mutatingVerbs[operation]; ok != mutates || (mutates && verb != "patch") {
+			t.Errorf("RBAC verb of %s = %q, want patch for mutating operations only", operation, verb)
+		}
+	}
+
+	if content, ok := callDynamicClient(tool.WithReadOnly(true), "SCALE", `,"replicas":1`); ok {
+		t.Errorf("SCALE in read-only mode = %q, want it refused", content)
+	}
+}
@@ -0,0 +1,429 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kube-agent/kuery/pkg/tools/api"
+
+	"github.com/tmc/langchaingo/llms"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// defaultWatchTimeout is the duration of a watch when the model does not
+	// set one.
+	defaultWatchTimeout = time.Minute
+	// maxWatchTimeout bounds the duration of foreground watches, during which
+	// the user waits.
+	maxWatchTimeout = 5 * time.Minute
+	// maxBackgroundWatchTimeout bounds the duration of background watches.
+	maxBackgroundWatchTimeout = 30 * time.Minute
+)
+
+var (
+	_ api.Tool           = &K8sWatchTool{}
+	_ api.Mutator        = &K8sWatchTool{}
+	_ api.PolicyTargeter = &K8sWatchTool{}
+)
+
+// K8sWatchTool is a tool that watches resources for a bounded time and
+// summarizes their state transitions, optionally in the background.
+type K8sWatchTool struct {
+	client     dynamic.Interface
+	resolver   *ResourceResolver
+	background *BackgroundTasks
+}
+
+// NewK8sWatchTool creates a new K8sWatchTool.
+func NewK8sWatchTool(client dynamic.Interface, resolver *ResourceResolver) *K8sWatchTool {
+	return &K8sWatchTool{
+		client:   client,
+		resolver: resolver,
+	}
+}
+
+// WithBackgroundTasks sets the tasks background watches run as, which
+// bound them to the session, notify the user when they end and report their
+// summaries to the model. Without
+// them, watches cannot run in the background.
+func (t *K8sWatchTool) WithBackgroundTasks(background *BackgroundTasks) *K8sWatchTool {
+	t.background = background
+	return t
+}
+
+func (t *K8sWatchTool) Name() string {
+	return "K8sWatch"
+}
+
+func (t *K8sWatchTool) LLMTool() *llms.Tool {
+	desc := `Watch Kubernetes resources for changes for a bounded time, and get a summary of their state transitions.
+			Use this tool instead of repeated GETs when the user wants to wait for, or be told when, resources
+			reach a state (e.g. "tell me when my Kafka cluster is ready").
+			In the background, the user can keep chatting meanwhile, is notified in the terminal once the watch ends,
+			and you are given the summary of the watch in the first turn after it ends.`
+
+	return &llms.Tool{
+		Type: functionToolType,
+		Function: &llms.FunctionDefinition{
+			Name:        t.Name(),
+			Description: api.AddApprovalRequirementToDescription(t, desc),
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"kind": map[string]any{
+						"type":        "string",
+						"description": `The kind, resource or short name of the resources to watch (e.g. Deployment or pods).`,
+					},
+					"apiVersion": map[string]any{
+						"type":        "string",
+						"description": `The apiVersion of the kind (e.g. apps/v1), optional.`,
+					},
+					"namespace": map[string]any{
+						"type":        "string",
+						"description": `The namespace of the resources to watch, or empty for all namespaces.`,
+					},
+					"name": map[string]any{
+						"type":        "string",
+						"description": `The name of the resource to watch, or empty to watch all matching resources.`,
+					},
+					"labelSelector": map[string]any{
+						"type":        "string",
+						"description": `A label selector to filter the watched resources by.`,
+					},
+					"until": map[string]any{
+						"type": "string",
+						"description": `A condition type (e.g. Ready, Available) or phase (e.g. Running, Succeeded) that ends
+										the watch once all watched resources reach it. Empty to watch for the full timeout.`,
+					},
+					"timeoutSeconds": map[string]any{
+						"type": "integer",
+						"description": fmt.Sprintf(`How long to watch for, %d seconds by default, up to %d seconds
+										(or %d seconds in the background).`, int(defaultWatchTimeout.Seconds()),
+							int(maxWatchTimeout.Seconds()), int(maxBackgroundWatchTimeout.Seconds())),
+					},
+					"background": map[string]any{
+						"type": "boolean",
+						"description": `Whether to watch in the background, notifying the user in the terminal when done
+										and giving you the summary in a later turn, instead of waiting for the watch to end.`,
+					},
+				},
+				"required": []string{"kind", "namespace"},
+			},
+		},
+	}
+}
+
+type watchCallArgs struct {
+	Kind           string `json:"kind"`
+	APIVersion     string `json:"apiVersion"`
+	Namespace      string `json:"namespace"`
+	Name           string `json:"name"`
+	LabelSelector  string `json:"labelSelector"`
+	Until          string `json:"until"`
+	TimeoutSeconds int    `json:"timeoutSeconds"`
+	Background     bool   `json:"background"`
+}
+
+// PolicyTargets returns the resources the tool call watches, with their kind
+// resolved to their resource, for policies to match on as a WATCH operation.
+func (t *K8sWatchTool) PolicyTargets(toolCall *llms.ToolCall) ([]api.PolicyTarget, error) {
+	var args watchCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+
+	if t.resolver == nil {
+		return nil, fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	resource, err := t.resolver.Resolve(args.APIVersion, args.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	return []api.PolicyTarget{{
+		Operation: "WATCH",
+		Group:     resource.GVR.Group,
+		Version:   resource.GVR.Version,
+		Resource:  resource.GVR.Resource,
+		Namespace: args.Namespace,
+		Name:      args.Name,
+		Kind:      resource.GVK.Kind,
+	}}, nil
+}
+
+func (t *K8sWatchTool) Call(ctx context.Context, toolCall *llms.ToolCall) (llms.ToolCallResponse, bool) {
+	var args watchCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to unmarshal arguments: %v", err),
+		}, false
+	}
+
+	if t.client == nil || t.resolver == nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    "kubernetes client is not initialized",
+		}, false
+	}
+
+	resource, err := t.resolver.Resolve(args.APIVersion, args.Kind)
+	if err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to resolve resource: %v", err),
+		}, false
+	}
+
+	maxTimeout := maxWatchTimeout
+	if args.Background {
+		maxTimeout = maxBackgroundWatchTimeout
+	}
+
+	timeout := time.Duration(args.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWatchTimeout
+	}
+	timeout = min(timeout, maxTimeout)
+
+	if args.Background {
+		if t.background == nil {
+			return llms.ToolCallResponse{
+				ToolCallID: toolCall.ID,
+				Name:       toolCall.FunctionCall.Name,
+				Content:    "background watches are not available, watch in the foreground instead",
+			}, false
+		}
+
+		// the watch outlives the tool call, hence is bound to the session rather than to the call
+		logger := klog.FromContext(ctx)
+		t.background.Go(toolCall, func(ctx context.Context) string {
+			summary, err := t.watch(klog.NewContext(ctx, logger), resource.GVR, args, timeout)
+			if err != nil {
+				summary = fmt.Sprintf("failed to watch: %v", err)
+			}
+
+			return fmt.Sprintf("The background watch of %s (tool-call %s) ended:\n%s", resource.GVR.Resource,
+				toolCall.ID, summary)
+		})
+
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content: fmt.Sprintf("watching %s in the background for up to %s, the user will be notified in the "+
+				"terminal when it ends, and you will be given its summary in the first turn after", resource.GVR.Resource,
+				timeout),
+		}, true
+	}
+
+	summary, err := t.watch(ctx, resource.GVR, args, timeout)
+	if err != nil {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    fmt.Sprintf("failed to watch: %v", err),
+		}, false
+	}
+
+	return llms.ToolCallResponse{
+		ToolCallID: toolCall.ID,
+		Name:       toolCall.FunctionCall.Name,
+		Content:    summary,
+	}, true
+}
+
+// RequiresExplaining returns whether the tool requires explaining after
+// execution.
+func (t *K8sWatchTool) RequiresExplaining() bool {
+	return true
+}
+
+// RequiresApproval returns whether the tool requires approval before
+// execution.
+func (t *K8sWatchTool) RequiresApproval() bool { return false }
+
+// Mutates returns whether the tool call may modify the cluster.
+func (t *K8sWatchTool) Mutates(_ *llms.ToolCall) bool { return false }
+
+// watchedState is the state of a watched resource, as far as the summary goes.
+type watchedState struct {
+	state   string
+	reached bool
+}
+
+// watch watches the resources for up to timeout, or until all of them reach
+// args.Until, and summarizes their state transitions.
+func (t *K8sWatchTool) watch(ctx context.Context, gvr schema.GroupVersionResource, args watchCallArgs,
+	timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	listOptions := metav1.ListOptions{LabelSelector: args.LabelSelector}
+	if args.Name != "" {
+		listOptions.FieldSelector = fields.OneTermEqualSelector("metadata.name", args.Name).String()
+	}
+
+	var resource dynamic.ResourceInterface = t.client.Resource(gvr)
+	if args.Namespace != metav1.NamespaceNone {
+		resource = t.client.Resource(gvr).Namespace(args.Namespace)
+	}
+
+	watcher, err := resource.Watch(ctx, listOptions)
+	if err != nil {
+		return "", fmt.Errorf("failed to watch %s: %w", gvr.Resource, err)
+	}
+	defer watcher.Stop()
+
+	start := time.Now()
+	states := make(map[string]*watchedState)
+	var transitions []string
+
+	summarize := func(ending string) string {
+		var summary strings.Builder
+		fmt.Fprintf(&summary, "watched %s for %s, %s.\n", gvr.Resource,
+			time.Since(start).Round(time.Second), ending)
+
+		if len(transitions) == 0 {
+			summary.WriteString("no changes observed\n")
+		} else {
+			summary.WriteString("transitions:\n" + strings.Join(transitions, "\n") + "\n")
+		}
+
+		names := make([]string, 0, len(states))
+		for name := range states {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		summary.WriteString("current states:\n")
+		for _, name := range names {
+			fmt.Fprintf(&summary, "- %s: %s\n", name, states[name].state)
+		}
+
+		return summary.String()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return summarize("timed out"), nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return summarize("the watch was closed by the server"), nil
+			}
+
+			if event.Type == watch.Error {
+				return "", fmt.Errorf("watch failed: %w", apierrors.FromObject(event.Object))
+			}
+
+			obj, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+
+			name := obj.GetName()
+			if obj.GetNamespace() != "" {
+				name = obj.GetNamespace() + "/" + name
+			}
+
+			state := resourceState(obj)
+			if event.Type == watch.Deleted {
+				state = "deleted"
+			}
+
+			previous, seen := states[name]
+			if !seen || previous.state != state {
+				from := "(new)"
+				if seen {
+					from = previous.state
+				}
+
+				transitions = append(transitions, fmt.Sprintf("+%s %s: %s -> %s",
+					time.Since(start).Round(time.Second), name, from, state))
+			}
+			states[name] = &watchedState{state: state, reached: reachedState(obj, args.Until)}
+
+			allReached := args.Until != ""
+			for _, watched := range states {
+				allReached = allReached && watched.reached
+			}
+
+			if allReached {
+				return summarize("all resources reached " + args.Until), nil
+			}
+		}
+	}
+}
+
+// resourceState summarizes the state of a resource by its phase and
+// conditions, e.g. "Running (Ready=True, Initialized=True)".
+func resourceState(obj *unstructured.Unstructured) string {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+
+	var states []string
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		states = append(states, fmt.Sprintf("%v=%v", conditionMap["type"], conditionMap["status"]))
+	}
+
+	switch {
+	case phase == "" && len(states) == 0:
+		return "no status"
+	case len(states) == 0:
+		return phase
+	case phase == "":
+		return strings.Join(states, ", ")
+	default:
+		return fmt.Sprintf("%s (%s)", phase, strings.Join(states, ", "))
+	}
+}
+
+// reachedState returns whether the resource has the given phase, or the given
+// condition with a True status.
+func reachedState(obj *unstructured.Unstructured, until string) bool {
+	if until == "" {
+		return false
+	}
+
+	if phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase"); strings.EqualFold(phase, until) {
+		return true
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if strings.EqualFold(fmt.Sprint(conditionMap["type"]), until) && conditionMap["status"] == "True" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -13,9 +13,13 @@ import (
 
 	corev1alpha1 "github.com/kube-agent/kuery/api/core/v1alpha1"
 	clientset "github.com/kube-agent/kuery/pkg/generated/clientset/versioned"
+	"github.com/kube-agent/kuery/pkg/tracing"
 )
 
-var _ api.Tool = &ExportKueryFlowTool{}
+var (
+	_ api.Tool    = &ExportKueryFlowTool{}
+	_ api.Mutator = &ExportKueryFlowTool{}
+)
 
 // ExportKueryFlowTool is a tool that can can export a KueryFlow from a
 // conversation.
@@ -23,6 +27,9 @@ type ExportKueryFlowTool struct {
 	client clientset.Interface
 	// toolCallGetter is a function that can get a tool-call by ID.
 	toolCallGetter func(string) (*llms.ToolCall, bool)
+	// clusterGetter is a function that can get the cluster a tool-call
+	// targeted by ID.
+	clusterGetter func(string) string
 }
 
 // NewExportKueryFlowTool creates a new ExportKueryFlowTool.
@@ -34,6 +41,13 @@ func NewExportKueryFlowTool(client clientset.Interface,
 	}
 }
 
+// WithClusterGetter sets the function getting the cluster a tool-call
+// targeted by ID, with which exported steps are tagged.
+func (t *ExportKueryFlowTool) WithClusterGetter(clusterGetter func(string) string) *ExportKueryFlowTool {
+	t.clusterGetter = clusterGetter
+	return t
+}
+
 func (t *ExportKueryFlowTool) Name() string {
 	return "exportKueryFlow"
 }
@@ -141,6 +155,10 @@ func (t *ExportKueryFlowTool) RequiresExplaining() bool {
 // RequiresApproval returns whether the tool requires approval before
 // execution.
 func (t *ExportKueryFlowTool) RequiresApproval() bool { return true }
+
+// Mutates returns whether the tool call may modify the cluster.
+func (t *ExportKueryFlowTool) Mutates(_ *llms.ToolCall) bool { return true }
+
 func (t *ExportKueryFlowTool) createOrUpdateKueryFlow(ctx context.Context, args *exportCallArgs) error {
 	var kfSteps []corev1alpha1.Step
 
@@ -150,10 +168,15 @@ func (t *ExportKueryFlowTool) createOrUpdateKueryFlow(ctx context.Context, args
 			return fmt.Errorf("tool call not found: %v", step.ID)
 		}
 
-		kfSteps = append(kfSteps, corev1alpha1.Step{
+		kfStep := corev1alpha1.Step{
 			FunctionCall:      call.FunctionCall,
 			ArgsToRecalculate: step.ArgsToRecalculate,
-		})
+		}
+		if t.clusterGetter != nil {
+			kfStep.Cluster = t.clusterGetter(step.ID)
+		}
+
+		kfSteps = append(kfSteps, kfStep)
 	}
 
 	kueryFlow := &corev1alpha1.KueryFlow{
@@ -165,6 +188,9 @@ func (t *ExportKueryFlowTool) createOrUpdateKueryFlow(ctx context.Context, args
 			Steps: kfSteps,
 		},
 	}
+	if traceParent := tracing.TraceParent(ctx); traceParent != "" { // runs of the KueryFlow link to this trace
+		kueryFlow.Annotations = map[string]string{tracing.TraceParentAnnotation: traceParent}
+	}
 
 	_, err := t.client.CoreV1alpha1().KueryFlows(args.Namespace).Create(ctx, kueryFlow, metav1.CreateOptions{})
 	if err != nil {
@@ -8,6 +8,7 @@ import (
 	"github.com/kube-agent/kuery/pkg/tools/api"
 
 	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel/trace"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -16,14 +17,28 @@ import (
 	clientset "github.com/kube-agent/kuery/pkg/generated/clientset/versioned"
 )
 
+// KueryFlowRunner tracks the runs of KueryFlows in a session.
+type KueryFlowRunner interface {
+	// StartRun starts a run of the KueryFlow, ending the run in progress, if
+	// any, and returns the span context the steps of the run are parented by.
+	StartRun(ctx context.Context, kueryFlow *corev1alpha1.KueryFlow) trace.SpanContext
+}
+
+var (
+	_ api.Tool    = &ImportKueryFlowTool{}
+	_ api.Mutator = &ImportKueryFlowTool{}
+)
+
 // ImportKueryFlowTool is a tool that can get or execute a KueryFlow object.
 // TODO: Add side-quests for recalculating missing step args.
 // TODO: Right now the model gets "execute X call" for simplicity, in the future the model should not be involved
 type ImportKueryFlowTool struct {
-	client  clientset.Interface
-	chain   flows.Chain
-	toolMgr *api.ToolManager
-	llm     llms.Model
+	client   clientset.Interface
+	chain    flows.Chain
+	toolMgr  *api.ToolManager
+	llm      llms.Model
+	readOnly bool
+	runner   KueryFlowRunner
 }
 
 // NewImportKueryFlowTool creates a new ImportKueryFlowTool.
@@ -37,6 +52,20 @@ func NewImportKueryFlowTool(client clientset.Interface, chain flows.Chain,
 	}
 }
 
+// WithReadOnly sets whether the tool is restricted to reading KueryFlows.
+// In read-only mode, KueryFlows cannot be executed.
+func (t *ImportKueryFlowTool) WithReadOnly(readOnly bool) *ImportKueryFlowTool {
+	t.readOnly = readOnly
+	return t
+}
+
+// WithRunner sets the runner tracking the KueryFlow runs the tool starts.
+// Without one, runs are neither measured nor traced.
+func (t *ImportKueryFlowTool) WithRunner(runner KueryFlowRunner) *ImportKueryFlowTool {
+	t.runner = runner
+	return t
+}
+
 func (t *ImportKueryFlowTool) Name() string {
 	return "ImportKueryFlow"
 }
@@ -54,11 +83,8 @@ func (t *ImportKueryFlowTool) LLMTool() *llms.Tool {
 				"type": "object",
 				"properties": map[string]interface{}{
 					"operation": map[string]interface{}{
-						"type": "string",
-						"description": `The operation to perform: LIST, GET, EXECUTE
-										LIST: Get KueryFlow objects in a namespace.
-										GET: Get a KueryFlow object by namespaced name.
-										EXECUTE: Execute a KueryFlow object by namespaced name.`,
+						"type":        "string",
+						"description": t.operationDescription(),
 					},
 					"name": map[string]interface{}{
 						"type":        "string",
@@ -75,6 +101,22 @@ func (t *ImportKueryFlowTool) LLMTool() *llms.Tool {
 	}
 }
 
+// operationDescription returns the description of the operations available
+// to the model.
+func (t *ImportKueryFlowTool) operationDescription() string {
+	if t.readOnly {
+		return `The operation to perform: LIST, GET
+				LIST: Get KueryFlow objects in a namespace.
+				GET: Get a KueryFlow object by namespaced name.
+				Kuery is in read-only mode, KueryFlows cannot be executed.`
+	}
+
+	return `The operation to perform: LIST, GET, EXECUTE
+			LIST: Get KueryFlow objects in a namespace.
+			GET: Get a KueryFlow object by namespaced name.
+			EXECUTE: Execute a KueryFlow object by namespaced name.`
+}
+
 type importCallArgs struct {
 	Operation string `json:"operation"`
 	Name      string `json:"name"`
@@ -124,6 +166,14 @@ func (t *ImportKueryFlowTool) Call(ctx context.Context, toolCall *llms.ToolCall)
 			Content:    fmt.Sprintf("KueryFlow: %v", kueryFlow),
 		}, true
 	case "EXECUTE":
+		if t.readOnly {
+			return llms.ToolCallResponse{
+				ToolCallID: toolCall.ID,
+				Name:       toolCall.FunctionCall.Name,
+				Content:    "executing KueryFlows is not available in read-only mode",
+			}, false
+		}
+
 		if t.chain == nil || t.llm == nil {
 			return llms.ToolCallResponse{
 				ToolCallID: toolCall.ID,
@@ -141,7 +191,12 @@ func (t *ImportKueryFlowTool) Call(ctx context.Context, toolCall *llms.ToolCall)
 			}, false
 		}
 
-		t.appendKueryFlowToChain(kueryFlow)
+		var runSpan trace.SpanContext
+		if t.runner != nil {
+			runSpan = t.runner.StartRun(ctx, kueryFlow)
+		}
+
+		t.appendKueryFlowToChain(kueryFlow, runSpan)
 		return llms.ToolCallResponse{
 			ToolCallID: toolCall.ID,
 			Name:       toolCall.FunctionCall.Name,
@@ -167,6 +222,18 @@ func (t *ImportKueryFlowTool) RequiresExplaining() bool {
 // execution.
 func (t *ImportKueryFlowTool) RequiresApproval() bool { return true }
 
+// Mutates returns whether the tool call may modify the cluster.
+// Only executing a KueryFlow may, through the tool-calls it is made of.
+func (t *ImportKueryFlowTool) Mutates(toolCall *llms.ToolCall) bool {
+	var args importCallArgs
+
+	if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
+		return true
+	}
+
+	return args.Operation != "LIST" && args.Operation != "GET"
+}
+
 func (t *ImportKueryFlowTool) listKueryFlows(ctx context.Context, namespace string) ([]corev1alpha1.KueryFlow, error) {
 	kueryFlows, err := t.client.CoreV1alpha1().KueryFlows(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
@@ -185,12 +252,20 @@ func (t *ImportKueryFlowTool) getKueryFlow(ctx context.Context, namespace, name
 	return kueryFlow, nil
 }
 
-func (t *ImportKueryFlowTool) appendKueryFlowToChain(kueryFlow *corev1alpha1.KueryFlow) {
+// appendKueryFlowToChain pushes the steps of the KueryFlow to the chain, with
+// the span of the run, if valid, as the parent of their spans.
+func (t *ImportKueryFlowTool) appendKueryFlowToChain(kueryFlow *corev1alpha1.KueryFlow, runSpan trace.SpanContext) {
 	// iterate in reverse order to append steps in the correct order
 	for i := len(kueryFlow.Spec.Steps) - 1; i >= 0; i-- {
 		step := kueryFlow.Spec.Steps[i]
-		t.chain.PushNext(steps.NewLLMStep(t.llm), true) // LLM step to handle the tool step
-		t.chain.PushNext(t.createToolStep(step), true)  // this will execute before the above
+		var llmStep steps.Step = steps.NewLLMStep(t.llm)
+		toolStep := t.createToolStep(kueryFlow, step)
+		if runSpan.IsValid() {
+			llmStep = steps.WithParentSpan(llmStep, runSpan)
+			toolStep = steps.WithParentSpan(toolStep, runSpan)
+		}
+		t.chain.PushNext(llmStep, true)  // LLM step to handle the tool step
+		t.chain.PushNext(toolStep, true) // this will execute before the above
 	}
 }
 
@@ -199,7 +274,12 @@ const toolStepContext = `You are required to run the following tool-call (part o
 						Use the 'AddStep' tool in order to instruct your self further to figure out the correct values.
 						If required, you may ask the user to help you figure them out.`
 
-func (t *ImportKueryFlowTool) createToolStep(step corev1alpha1.Step) steps.Step {
+const toolStepClusterContext = `The following tool-call (part of a KueryFlow) targets cluster %s, while the active
+						cluster is %s. Ask the user whether to switch to cluster %[1]s using the 'K8sContext' tool and run it
+						there, run it on the active cluster instead, or skip it:
+						%[3]v`
+
+func (t *ImportKueryFlowTool) createToolStep(kueryFlow *corev1alpha1.KueryFlow, step corev1alpha1.Step) steps.Step {
 	if len(step.ArgsToRecalculate) > 0 {
 		// in this case we need to add an instructional AI step to possibly start a chain of recalculations
 		// to figure out the correct values for the arguments
@@ -208,9 +288,20 @@ func (t *ImportKueryFlowTool) createToolStep(step corev1alpha1.Step) steps.Step
 		})
 	}
 
-	t.toolMgr.ApproveTools([]string{step.FunctionCall.Name}) // approve the tool to be executed
+	if step.Cluster != "" && step.Cluster != t.toolMgr.Cluster() {
+		// never execute a step on another cluster than the one it was exported from without the user knowing
+		return steps.NewHumanStep(func(_ context.Context) string {
+			return fmt.Sprintf(toolStepClusterContext, step.Cluster, t.toolMgr.Cluster(), *step.FunctionCall)
+		})
+	}
+
 	// in this case we can simply create a tool step
 	return steps.NewHumanStep(func(_ context.Context) string {
+		// approve the exact call, as part of the KueryFlow the user approved executing,
+		// in the turn of the step since approvals expire with the turn that follows them
+		t.toolMgr.ApproveToolCall(step.FunctionCall.Name, step.FunctionCall.Arguments,
+			fmt.Sprintf("executing KueryFlow %s/%s", kueryFlow.Namespace, kueryFlow.Name))
+
 		return fmt.Sprintf("Execute the following tool-call:\n%v", *step.FunctionCall)
 	})
 }
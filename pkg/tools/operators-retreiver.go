@@ -13,7 +13,10 @@ import (
 
 const functionToolType = "function"
 
-var _ api.Tool = &OperatorsRAGTool{}
+var (
+	_ api.Tool    = &OperatorsRAGTool{}
+	_ api.Mutator = &OperatorsRAGTool{}
+)
 
 // OperatorsRAGTool is a tool that retrieves the operator schema that is most relevant to the prompt.
 type OperatorsRAGTool struct {
@@ -36,7 +39,8 @@ func (ort *OperatorsRAGTool) LLMTool() *llms.Tool {
 			This tool is used to retrieve kubernetes operators information before answering a relevant user prompt.
 			This tool should be used before generating answers from nothing. Do not over-use with the same prompt.
 
-			To install an operator, you must POST the Subscription specified in a schema to the dynamic K8s client.`
+			To install an operator, you must apply the setup manifests (e.g. the Subscription) specified in a schema,
+			preferably with the K8sApplyManifests tool, or else by POSTing them to the dynamic K8s client.`
 
 	return &llms.Tool{
 		Type: functionToolType,
@@ -96,3 +100,6 @@ func (ort *OperatorsRAGTool) RequiresExplaining() bool {
 // RequiresApproval returns whether the tool requires approval before
 // execution.
 func (ort *OperatorsRAGTool) RequiresApproval() bool { return false }
+
+// Mutates returns whether the tool call may modify the cluster.
+func (ort *OperatorsRAGTool) Mutates(_ *llms.ToolCall) bool { return false }
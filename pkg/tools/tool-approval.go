@@ -8,14 +8,20 @@ import (
 	"github.com/kube-agent/kuery/pkg/tools/api"
 	"strings"
 
+	"github.com/fatih/color"
 	"github.com/tmc/langchaingo/llms"
 
 	"github.com/kube-agent/kuery/pkg/flows/steps"
+	"github.com/kube-agent/kuery/pkg/metrics"
 )
 
-var _ api.Tool = &ToolApprovalTool{}
+var (
+	_ api.Tool    = &ToolApprovalTool{}
+	_ api.Mutator = &ToolApprovalTool{}
+)
 
-// ToolApprovalTool is a tool that the LLM can use to request for explicit approval on a tool-use.
+// ToolApprovalTool is a tool that the LLM can use to request for explicit approval on tool-calls.
+// An approval is bound to the exact tool-call (tool name and arguments) presented to the user.
 type ToolApprovalTool struct {
 	chain   flows.Chain
 	llm     llms.Model
@@ -41,32 +47,52 @@ func (t *ToolApprovalTool) LLMTool() *llms.Tool {
 		Function: &llms.FunctionDefinition{
 			Name: t.Name(),
 			Description: `RequestApprovalForTool is a tool that is used to request for explicit approval before
-						  executing tools that require approval.
-							An approval is valid until successful execution.`,
+						  executing tool-calls that require approval.
+							An approval is bound to the exact tool name and arguments requested, and is valid until
+							successful execution. A call with any other arguments requires a new approval.`,
 			Parameters: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"toolNames": map[string]any{
+					"toolCalls": map[string]any{
 						"type":        "array",
-						"description": "The names of the tools to request approval for.",
+						"description": "The tool-calls to request approval for.",
 						"items": map[string]any{
-							"type": "string",
+							"type": "object",
+							"properties": map[string]any{
+								"name": map[string]any{
+									"type":        "string",
+									"description": "The name of the tool to call.",
+								},
+								"arguments": map[string]any{
+									"type":        "string",
+									"description": "The exact JSON arguments the tool will be called with.",
+								},
+							},
+							"required": []string{"name", "arguments"},
 						},
 					},
 				},
-				"required": []string{"toolNames"},
+				"required": []string{"toolCalls"},
 			},
 		},
 	}
 }
 
-const toolApprovalText = `The human will be prompted for approval after your next turn.
-						  Explain to the user that they should explicitly write 'yes' to approve the tools to be ran.
-							Be transparent and let them know exactly what they're approving.`
+const toolApprovalText = `The human will be prompted for approval of the following tool-calls after your next turn:
+%s
+They are shown exactly what will be executed, and may answer 'yes', 'no' or 'edit' followed by the changes they want.
+Briefly explain the calls to the user. Once approved, call the tools with the EXACT same arguments in your
+following turn, any change invalidates the approval and approvals expire with the turn after they are given.`
+
+// pendingToolCall is a tool-call awaiting approval.
+type pendingToolCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
 
 func (t *ToolApprovalTool) Call(ctx context.Context, toolCall *llms.ToolCall) (llms.ToolCallResponse, bool) {
 	var args struct {
-		ToolNames []string `json:"toolNames"`
+		ToolCalls []pendingToolCall `json:"toolCalls"`
 	}
 
 	if t.toolMgr == nil || t.llm == nil || t.chain == nil {
@@ -85,11 +111,64 @@ func (t *ToolApprovalTool) Call(ctx context.Context, toolCall *llms.ToolCall) (l
 		}, false
 	}
 
-	// push a human step that sets the approval flag FOLLOWED by an AI step to continue the flow
+	if len(args.ToolCalls) == 0 {
+		return llms.ToolCallResponse{
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.FunctionCall.Name,
+			Content:    "no tool-calls to approve",
+		}, false
+	}
+
+	// vet and render the calls before bothering the user with them
+	var summary strings.Builder
+	for idx, pending := range args.ToolCalls {
+		call := &llms.ToolCall{FunctionCall: &llms.FunctionCall{Name: pending.Name, Arguments: pending.Arguments}}
+		if err := t.toolMgr.Preflight(ctx, call); err != nil {
+			return llms.ToolCallResponse{
+				ToolCallID: toolCall.ID,
+				Name:       toolCall.FunctionCall.Name,
+				Content:    fmt.Sprintf("tool-call %s would be rejected, do not request its approval: %v", pending.Name, err),
+			}, false
+		}
+
+		fmt.Fprintf(&summary, "[%d] %s\n", idx+1, t.toolMgr.DescribeToolCall(ctx, call))
+	}
+
+	// a new request supersedes the approvals of previous ones that were not used
+	t.toolMgr.ClearApprovals()
+
+	// push a human step that approves the calls FOLLOWED by an AI step to continue the flow
+	cluster := t.toolMgr.Cluster()
 	step := steps.NewHumanStep(func(ctx context.Context) string {
-		humanInput := steps.ReadFromSTDIN(ctx)
-		if strings.ToLower(humanInput) == "yes" {
-			t.toolMgr.ApproveTools(args.ToolNames)
+		if cluster != "" {
+			color.New(color.FgHiRed, color.Bold).Printf("Target cluster: %s\n", cluster)
+		}
+		color.New(color.FgHiYellow).Printf("Kuery requests approval for the following tool-calls:\n%s", summary.String())
+
+		humanInput := steps.PromptSTDIN(ctx, "Approve? [yes/no/edit]: ")
+		changes, edit := parseEditAnswer(humanInput)
+		switch {
+		case strings.EqualFold(strings.TrimSpace(humanInput), "yes"):
+			if t.toolMgr.Cluster() != cluster { // approvals are bound to the active cluster
+				t.observeApprovals(args.ToolCalls, metrics.ApprovalDenied)
+				return fmt.Sprintf("I cannot approve the tool-calls, they were requested for cluster %s "+
+					"but the active cluster is now %s", cluster, t.toolMgr.Cluster())
+			}
+
+			for _, pending := range args.ToolCalls {
+				t.toolMgr.ApproveToolCall(pending.Name, pending.Arguments, humanInput)
+			}
+			t.observeApprovals(args.ToolCalls, metrics.ApprovalGranted)
+		case edit:
+			t.toolMgr.ClearApprovals()
+			t.observeApprovals(args.ToolCalls, metrics.ApprovalDenied)
+			if changes == "" {
+				changes = steps.PromptSTDIN(ctx, "Describe the changes: ")
+			}
+			return fmt.Sprintf("I do not approve the tool-calls as they are, change them as follows: %s", changes)
+		default:
+			t.toolMgr.ClearApprovals()
+			t.observeApprovals(args.ToolCalls, metrics.ApprovalDenied)
 		}
 
 		return humanInput
@@ -101,10 +180,41 @@ func (t *ToolApprovalTool) Call(ctx context.Context, toolCall *llms.ToolCall) (l
 	return llms.ToolCallResponse{
 		ToolCallID: toolCall.ID,
 		Name:       toolCall.FunctionCall.Name,
-		Content:    toolApprovalText,
+		Content:    fmt.Sprintf(toolApprovalText, summary.String()),
 	}, true
 }
 
+// parseEditAnswer returns whether the answer of the user asks to edit the tool
+// calls, i.e. is 'edit' optionally followed by the changes (e.g. "edit: use 3
+// replicas"), along with the changes if any.
+func parseEditAnswer(answer string) (string, bool) {
+	answer = strings.TrimSpace(answer)
+	if len(answer) < len("edit") || !strings.EqualFold(answer[:len("edit")], "edit") {
+		return "", false
+	}
+
+	changes := answer[len("edit"):]
+	if changes != "" && !strings.ContainsAny(changes[:1], ": \t") {
+		return "", false // e.g. "edited", which is no answer to the prompt
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(changes, ":")), true
+}
+
+// observeApprovals records the decision of the user on the approval of the
+// given tool calls. Calls to unknown tools are not labeled by name, which the
+// LLM may make up.
+func (t *ToolApprovalTool) observeApprovals(toolCalls []pendingToolCall, decision string) {
+	for _, pending := range toolCalls {
+		name := pending.Name
+		if !t.toolMgr.HasTool(name) {
+			name = "unknown"
+		}
+
+		metrics.Approvals.WithLabelValues(name, decision).Inc()
+	}
+}
+
 // RequiresExplaining returns whether the tool requires explaining after
 // execution.
 func (t *ToolApprovalTool) RequiresExplaining() bool {
@@ -114,3 +224,6 @@ func (t *ToolApprovalTool) RequiresExplaining() bool {
 // RequiresApproval returns whether the tool requires approval before
 // execution.
 func (t *ToolApprovalTool) RequiresApproval() bool { return false }
+
+// Mutates returns whether the tool call may modify the cluster.
+func (t *ToolApprovalTool) Mutates(_ *llms.ToolCall) bool { return false }
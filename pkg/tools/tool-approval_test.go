@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kube-agent/kuery/pkg/flows"
+	"github.com/kube-agent/kuery/pkg/metrics"
+	"github.com/kube-agent/kuery/pkg/tools/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tmc/langchaingo/llms"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestParseEditAnswer(t *testing.T) {
+	for _, tc := range []struct {
+		answer, changes string
+		edit            bool
+	}{
+		{"edit", "", true},
+		{"  Edit \n", "", true},
+		{"edit use 3 replicas", "use 3 replicas", true},
+		{"EDIT: use 3 replicas ", "use 3 replicas", true},
+		{"edited", "", false},
+		{"yes", "", false},
+		{"no, edit nothing", "", false},
+	} {
+		changes, edit := parseEditAnswer(tc.answer)
+		if changes != tc.changes || edit != tc.edit {
+			t.Errorf("parseEditAnswer(%q) = %q, %v, want %q, %v", tc.answer, changes, edit, tc.changes, tc.edit)
+		}
+	}
+}
+
+// withStdin makes the given input the standard input of the test.
+func withStdin(t *testing.T, input string) {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	stdin := os.Stdin
+	os.Stdin = reader
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		reader.Close()
+	})
+}
+
+// unusedModel is an LLM the tests never call.
+type unusedModel struct {
+	llms.Model
+}
+
+func TestApprovalRequestsClearUnusedApprovals(t *testing.T) {
+	const replicaSet = `{"operation":"GET","group":"apps","version":"v1","resource":"replicasets",` +
+		`"namespace":"default","name":"web-3"}`
+	const web = `{"operation":"GET","group":"apps","version":"v1","resource":"deployments",` +
+		`"namespace":"default","name":"web"}`
+
+	objects := []runtime.Object{
+		&unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web", "namespace": "default"},
+		}},
+		&unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "apps/v1", "kind": "ReplicaSet", "metadata": map[string]any{"name": "web-3", "namespace": "default"},
+		}},
+	}
+
+	for _, tc := range []struct {
+		answer                  string
+		wantWeb, wantReplicaSet bool
+	}{
+		{answer: "yes\n", wantWeb: true, wantReplicaSet: true},
+		{answer: "no\n"},
+		{answer: "edit: get the replicas only\n"},
+	} {
+		t.Run(strings.TrimSpace(tc.answer), func(t *testing.T) {
+			chain := flows.NewChain(nil)
+			client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+			mgr := api.NewToolManager().WithTool(NewK8sDynamicClient(client), 3)
+			tool := NewToolApprovalTool(chain, unusedModel{}, mgr)
+
+			// the user approved a call the LLM never made, then the LLM requests another one
+			mgr.ApproveToolCall("K8sDynamicClient", replicaSet, "yes")
+			arguments := `{"toolCalls":[{"name":"K8sDynamicClient","arguments":` + strconv.Quote(web) + `}]}`
+			if response, ok := tool.Call(context.Background(), &llms.ToolCall{FunctionCall: &llms.FunctionCall{
+				Name: tool.Name(), Arguments: arguments}}); !ok {
+				t.Fatalf("Call() = %q, want the approval to be requested", response.Content)
+			}
+
+			if executed(mgr, replicaSet) {
+				t.Fatal("the previous approval survived a new approval request")
+			}
+
+			// approvals granted meanwhile remain only if the user approves the request too
+			mgr.ApproveToolCall("K8sDynamicClient", replicaSet, "yes")
+			withStdin(t, tc.answer)
+			if _, err := chain.Next().Execute(context.Background()); err != nil {
+				t.Fatalf("Execute() of the approval step error = %v", err)
+			}
+
+			gotWeb, gotReplicaSet := executed(mgr, web), executed(mgr, replicaSet)
+			if gotWeb != tc.wantWeb || gotReplicaSet != tc.wantReplicaSet {
+				t.Errorf("answering %q: requested call approved = %v, other call approved = %v, want %v, %v",
+					tc.answer, gotWeb, gotReplicaSet, tc.wantWeb, tc.wantReplicaSet)
+			}
+		})
+	}
+}
+
+// executed returns whether the tool manager executes the K8sDynamicClient call
+// with the given arguments, i.e. whether it was approved.
+func executed(mgr *api.ToolManager, arguments string) bool {
+	messages, _ := mgr.ExecuteToolCalls(context.Background(), &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		ToolCalls: []llms.ToolCall{{ID: "1", Type: "function", FunctionCall: &llms.FunctionCall{
+			Name: "K8sDynamicClient", Arguments: arguments}}},
+	}}})
+	response := messages[len(messages)-1].Parts[0].(llms.ToolCallResponse)
+
+	return !strings.Contains(response.Content, "requires explicit user approval")
+}
+
+func TestObserveApprovalsLabelsUnknownTools(t *testing.T) {
+	mgr := api.NewToolManager()
+	tool := NewToolApprovalTool(nil, nil, mgr)
+	mgr.WithTool(tool, 1)
+
+	known := metrics.Approvals.WithLabelValues(tool.Name(), metrics.ApprovalDenied)
+	unknown := metrics.Approvals.WithLabelValues("unknown", metrics.ApprovalDenied)
+	knownBefore, unknownBefore := testutil.ToFloat64(known), testutil.ToFloat64(unknown)
+
+	tool.observeApprovals([]pendingToolCall{{Name: tool.Name()}, {Name: "MadeUpTool"}}, metrics.ApprovalDenied)
+
+	if got := testutil.ToFloat64(known) - knownBefore; got != 1 {
+		t.Errorf("approvals of %s = %v, want 1", tool.Name(), got)
+	}
+
+	if got := testutil.ToFloat64(unknown) - unknownBefore; got != 1 {
+		t.Errorf("approvals of unknown tools = %v, want 1", got)
+	}
+}
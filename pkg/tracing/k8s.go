@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/client-go/rest"
+)
+
+// Kubernetes API request span attribute keys.
+const (
+	K8sGroupKey       = attribute.Key("k8s.group")
+	K8sVersionKey     = attribute.Key("k8s.version")
+	K8sResourceKey    = attribute.Key("k8s.resource")
+	K8sSubresourceKey = attribute.Key("k8s.subresource")
+	K8sNamespaceKey   = attribute.Key("k8s.namespace.name")
+	K8sNameKey        = attribute.Key("k8s.object.name")
+
+	httpMethodKey     = attribute.Key("http.request.method")
+	httpStatusCodeKey = attribute.Key("http.response.status_code")
+	urlPathKey        = attribute.Key("url.path")
+)
+
+// WrapConfig returns a copy of cfg whose Kubernetes API requests are traced,
+// as children of the span in the context of the request, with the resource
+// they target as attributes. The trace context is propagated to the API
+// server.
+func WrapConfig(cfg *rest.Config) *rest.Config {
+	if cfg == nil {
+		return nil
+	}
+
+	cfg = rest.CopyConfig(cfg)
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &roundTripper{next: rt}
+	})
+
+	return cfg
+}
+
+// roundTripper traces the requests it round trips.
+type roundTripper struct {
+	next http.RoundTripper
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := parseAPIPath(req.URL.Path)
+
+	name := "K8s " + req.Method
+	if target.resource != "" {
+		name += " " + target.resource
+		if target.subresource != "" {
+			name += "/" + target.subresource
+		}
+	}
+
+	ctx, span := Tracer().Start(req.Context(), name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			httpMethodKey.String(req.Method),
+			urlPathKey.String(req.URL.Path),
+			K8sGroupKey.String(target.group),
+			K8sVersionKey.String(target.version),
+			K8sResourceKey.String(target.resource),
+			K8sSubresourceKey.String(target.subresource),
+			K8sNamespaceKey.String(target.namespace),
+			K8sNameKey.String(target.name),
+		))
+	defer span.End()
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+
+	span.SetAttributes(httpStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// apiTarget is the resource a Kubernetes API request targets.
+type apiTarget struct {
+	group, version, namespace, resource, name, subresource string
+}
+
+// parseAPIPath parses the target of a Kubernetes API request from its path,
+// e.g. /apis/apps/v1/namespaces/default/deployments/web/scale. Paths outside
+// the resource API (e.g., discovery) yield a partial target.
+func parseAPIPath(path string) apiTarget {
+	var target apiTarget
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		target.version = segments[1]
+		segments = segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		target.group, target.version = segments[1], segments[2]
+		segments = segments[3:]
+	default:
+		return target
+	}
+
+	if len(segments) >= 3 && segments[0] == "namespaces" {
+		target.namespace = segments[1]
+		segments = segments[2:]
+	}
+
+	for i, field := range []*string{&target.resource, &target.name, &target.subresource} {
+		if i < len(segments) {
+			*field = segments[i]
+		}
+	}
+
+	return target
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceParentAnnotation is the annotation of a KueryFlow holding the W3C trace
+// context of the session that exported it, which its runs link to.
+const TraceParentAnnotation = "kuery.io/traceparent"
+
+// runSpans holds the spans of the active KueryFlow runs, by run.
+var runSpans sync.Map
+
+// TraceParent returns the W3C trace context of the span in ctx, or an empty
+// string if there is none.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return carrier.Get("traceparent")
+}
+
+// StartKueryFlowRun starts the span of a KueryFlow run, as a child of the span
+// in ctx and linked to the trace of the session that exported the KueryFlow
+// (see TraceParentAnnotation), and returns its span context for the steps of
+// the run to be parented by. The span lasts until EndKueryFlowRun.
+func StartKueryFlowRun(ctx context.Context, run, namespace, name string,
+	annotations map[string]string) trace.SpanContext {
+	opts := []trace.SpanStartOption{
+		trace.WithAttributes(
+			KueryFlowRunKey.String(run),
+			KueryFlowNamespaceKey.String(namespace),
+			KueryFlowNameKey.String(name),
+		),
+	}
+
+	if traceParent := annotations[TraceParentAnnotation]; traceParent != "" {
+		exported := propagation.TraceContext{}.Extract(context.Background(),
+			propagation.MapCarrier{"traceparent": traceParent})
+		if exportedSpan := trace.SpanContextFromContext(exported); exportedSpan.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: exportedSpan}))
+		}
+	}
+
+	_, span := Tracer().Start(ctx, "KueryFlow run "+namespace+"/"+name, opts...)
+	runSpans.Store(run, span)
+
+	return span.SpanContext()
+}
+
+// EndKueryFlowRun records err (if any) on the span of the KueryFlow run and
+// ends it.
+func EndKueryFlowRun(run string, err error) {
+	if span, ok := runSpans.LoadAndDelete(run); ok {
+		EndSpan(span.(trace.Span), err)
+	}
+}
@@ -0,0 +1,92 @@
+// Package tracing traces Kuery with OpenTelemetry: the steps of flows, the
+// LLM calls and tool calls they make, and the Kubernetes API requests of the
+// tools. Spans are exported via OTLP once Setup is called, and are no-ops
+// otherwise.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer of Kuery.
+const TracerName = "github.com/kube-agent/kuery"
+
+// Span attribute keys.
+const (
+	SessionIDKey = attribute.Key("kuery.session.id")
+	ClusterKey   = attribute.Key("kuery.cluster")
+	StepTypeKey  = attribute.Key("kuery.step.type")
+
+	ToolNameKey    = attribute.Key("kuery.tool.name")
+	ToolCallIDKey  = attribute.Key("kuery.tool.call_id")
+	ToolOutcomeKey = attribute.Key("kuery.tool.outcome")
+
+	LLMProviderKey         = attribute.Key("gen_ai.system")
+	LLMModelKey            = attribute.Key("gen_ai.request.model")
+	LLMAttemptKey          = attribute.Key("kuery.llm.attempt")
+	LLMPromptTokensKey     = attribute.Key("gen_ai.usage.input_tokens")
+	LLMCompletionTokensKey = attribute.Key("gen_ai.usage.output_tokens")
+
+	KueryFlowRunKey       = attribute.Key("kuery.kueryflow.run")
+	KueryFlowNameKey      = attribute.Key("kuery.kueryflow.name")
+	KueryFlowNamespaceKey = attribute.Key("kuery.kueryflow.namespace")
+)
+
+// Tracer returns the tracer of Kuery, from the global TracerProvider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Setup installs a global TracerProvider exporting spans via OTLP over HTTP,
+// configured by the given options and the standard OTEL_EXPORTER_OTLP_*
+// environment variables, and propagates W3C trace context.
+// The returned function flushes the pending spans and shuts the provider down.
+func Setup(ctx context.Context, opts ...otlptracehttp.Option) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	return SetupWithExporter(exporter), nil
+}
+
+// SetupWithExporter installs a global TracerProvider exporting spans with the
+// given exporter (e.g., an in-memory one), and propagates W3C trace context.
+// The returned function flushes the pending spans and shuts the provider down.
+func SetupWithExporter(exporter sdktrace.SpanExporter) func(context.Context) error {
+	res, err := resource.Merge(resource.NewSchemaless(attribute.String("service.name", "kuery")),
+		resource.Environment()) // OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+	if err != nil {
+		res = resource.NewSchemaless(attribute.String("service.name", "kuery"))
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown
+}
+
+// EndSpan records err (if any) on the span and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
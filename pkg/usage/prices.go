@@ -0,0 +1,83 @@
+package usage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Price is the price of a model, in USD per million tokens.
+type Price struct {
+	// Input is the price of a million input (prompt) tokens.
+	Input float64 `json:"input"`
+	// Output is the price of a million output (completion) tokens.
+	Output float64 `json:"output"`
+}
+
+// Cost returns the cost of the usage, in USD.
+func (p Price) Cost(u Usage) float64 {
+	return (float64(u.PromptTokens)*p.Input + float64(u.CompletionTokens)*p.Output) / 1e6
+}
+
+// PriceTable maps model names to their prices.
+type PriceTable map[string]Price
+
+// DefaultPriceTable returns the prices of common models of the hosted
+// providers.
+func DefaultPriceTable() PriceTable {
+	return PriceTable{
+		"gpt-4-1106-preview":         {Input: 10, Output: 30},
+		"gpt-4o":                     {Input: 2.5, Output: 10},
+		"gpt-4o-mini":                {Input: 0.15, Output: 0.6},
+		"claude-3-5-sonnet-20241022": {Input: 3, Output: 15},
+		"claude-3-5-haiku-20241022":  {Input: 0.8, Output: 4},
+	}
+}
+
+// LoadPriceTable reads a YAML (or JSON) price table from the given file, e.g.
+//
+//	gpt-4o: {input: 2.5, output: 10}
+func LoadPriceTable(file string) (PriceTable, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table file: %w", err)
+	}
+
+	var prices PriceTable
+	if err := yaml.UnmarshalStrict(data, &prices); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal price table: %w", err)
+	}
+
+	return prices, nil
+}
+
+// Merge returns a copy of t with the prices of override added or replacing
+// its own.
+func (t PriceTable) Merge(override PriceTable) PriceTable {
+	merged := make(PriceTable, len(t)+len(override))
+	for model, price := range t {
+		merged[model] = price
+	}
+	for model, price := range override {
+		merged[model] = price
+	}
+
+	return merged
+}
+
+// Lookup returns the price of the given model, which may be qualified by its
+// provider (e.g., openai/gpt-4o).
+func (t PriceTable) Lookup(model string) (Price, bool) {
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		price, ok := t[model[i+1:]]
+		return price, ok
+	}
+
+	return Price{}, false
+}
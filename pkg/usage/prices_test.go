@@ -0,0 +1,76 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPriceTableMerge(t *testing.T) {
+	defaults := DefaultPriceTable()
+	merged := defaults.Merge(PriceTable{
+		"gpt-4o":      {Input: 1, Output: 2},
+		"local-llama": {},
+	})
+
+	if price := merged["gpt-4o"]; price != (Price{Input: 1, Output: 2}) {
+		t.Errorf("merged price of gpt-4o = %+v, want the override", price)
+	}
+	if _, ok := merged["local-llama"]; !ok {
+		t.Error("merged table is missing local-llama, want the added model")
+	}
+	if price := merged["gpt-4o-mini"]; price != defaults["gpt-4o-mini"] {
+		t.Errorf("merged price of gpt-4o-mini = %+v, want the default %+v", price, defaults["gpt-4o-mini"])
+	}
+
+	if price := defaults["gpt-4o"]; price != (Price{Input: 2.5, Output: 10}) {
+		t.Errorf("default price of gpt-4o = %+v after Merge, want it untouched", price)
+	}
+}
+
+func TestPriceTableLookup(t *testing.T) {
+	prices := PriceTable{"gpt-4o": {Input: 2.5, Output: 10}, "openai/gpt-4o-mini": {Input: 0.15, Output: 0.6}}
+
+	for _, tc := range []struct {
+		model string
+		want  Price
+		found bool
+	}{
+		{model: "gpt-4o", want: Price{Input: 2.5, Output: 10}, found: true},
+		{model: "openai/gpt-4o", want: Price{Input: 2.5, Output: 10}, found: true},
+		{model: "openai/gpt-4o-mini", want: Price{Input: 0.15, Output: 0.6}, found: true},
+		{model: "gpt-4o-mini"},
+		{model: "anthropic/claude-3-opus"},
+		{model: ""},
+	} {
+		if price, ok := prices.Lookup(tc.model); ok != tc.found || price != tc.want {
+			t.Errorf("Lookup(%q) = %+v, %v, want %+v, %v", tc.model, price, ok, tc.want, tc.found)
+		}
+	}
+}
+
+func TestLoadPriceTable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prices.yaml")
+	if err := os.WriteFile(file, []byte("gpt-4o: {input: 1.25, output: 5}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	prices, err := LoadPriceTable(file)
+	if err != nil || prices["gpt-4o"] != (Price{Input: 1.25, Output: 5}) {
+		t.Errorf("LoadPriceTable() = %+v, %v, want the price of gpt-4o", prices, err)
+	}
+
+	if err := os.WriteFile(file, []byte("gpt-4o: {input: 1.25, outptu: 5}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPriceTable(file); err == nil {
+		t.Error("LoadPriceTable() of a misspelled field succeeded, want an error")
+	}
+}
+
+func TestPriceCost(t *testing.T) {
+	cost := Price{Input: 3, Output: 15}.Cost(Usage{PromptTokens: 1_000_000, CompletionTokens: 100_000})
+	if cost != 4.5 {
+		t.Errorf("Cost() = %v, want 4.5", cost)
+	}
+}
@@ -0,0 +1,232 @@
+package usage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ErrBudgetExceeded is returned once a session used up its budget.
+var ErrBudgetExceeded = errors.New("session budget exceeded")
+
+// Budget limits the usage of a session. Zero values mean no limit.
+type Budget struct {
+	// MaxTokens is the maximum number of tokens.
+	MaxTokens int
+	// MaxCost is the maximum cost, in USD.
+	MaxCost float64
+}
+
+// Record is the usage of a single LLM step.
+type Record struct {
+	// Model is the model that served the step, if known.
+	Model string
+	// Run is the KueryFlow run the step is part of, if any.
+	Run string
+	// Usage is the number of tokens the step consumed.
+	Usage Usage
+	// Cost is the cost of the step in USD, zero if the model has no price.
+	Cost float64
+	// Priced is whether the model has a price.
+	Priced bool
+}
+
+// Totals is accumulated usage.
+type Totals struct {
+	// Steps is the number of LLM steps.
+	Steps int
+	// Usage is the number of tokens consumed.
+	Usage Usage
+	// Cost is the cost in USD of the steps of priced models.
+	Cost float64
+	// Unpriced is the number of steps of models without a price.
+	Unpriced int
+}
+
+func (t *Totals) add(record Record) {
+	t.Steps++
+	t.Usage = t.Usage.Add(record.Usage)
+	t.Cost += record.Cost
+	if !record.Priced {
+		t.Unpriced++
+	}
+}
+
+// Tracker accounts for the token usage and cost of a session, and of the
+// KueryFlow runs within it. Tracker is safe for concurrent use.
+type Tracker struct {
+	mu sync.Mutex
+
+	prices PriceTable
+	budget Budget
+
+	records   []Record
+	session   Totals
+	runs      map[string]*Totals
+	runOrder  []string
+	activeRun string
+}
+
+// NewTracker creates a Tracker pricing usage with the given price table.
+func NewTracker(prices PriceTable) *Tracker {
+	return &Tracker{
+		prices: prices,
+		runs:   make(map[string]*Totals),
+	}
+}
+
+// WithBudget sets the budget of the session.
+func (t *Tracker) WithBudget(budget Budget) *Tracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.budget = budget
+	return t
+}
+
+// WithPrices sets the price table usage is priced with.
+func (t *Tracker) WithPrices(prices PriceTable) *Tracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prices = prices
+	return t
+}
+
+// Record accounts for the usage reported by an LLM step response, towards
+// the session and the active KueryFlow run, if any.
+func (t *Tracker) Record(response *llms.ContentResponse) Record {
+	usage, model := FromResponse(response)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	record := Record{
+		Model: model,
+		Run:   t.activeRun,
+		Usage: usage,
+	}
+	if price, ok := t.prices.Lookup(model); ok {
+		record.Cost = price.Cost(usage)
+		record.Priced = true
+	}
+
+	t.records = append(t.records, record)
+	t.session.add(record)
+	if record.Run != "" {
+		t.runs[record.Run].add(record)
+	}
+
+	return record
+}
+
+// StartRun attributes the usage recorded until EndRun to the given KueryFlow
+// run, in addition to the session. The active run, if any, ends.
+func (t *Tracker) StartRun(run string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.runs[run]; !ok {
+		t.runs[run] = &Totals{}
+		t.runOrder = append(t.runOrder, run)
+	}
+
+	t.activeRun = run
+}
+
+// EndRun ends the active KueryFlow run, if any, and returns it.
+func (t *Tracker) EndRun() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	run := t.activeRun
+	t.activeRun = ""
+	return run
+}
+
+// Session returns the totals of the session.
+func (t *Tracker) Session() Totals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.session
+}
+
+// Run returns the totals of the given KueryFlow run.
+func (t *Tracker) Run(run string) (Totals, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	totals, ok := t.runs[run]
+	if !ok {
+		return Totals{}, false
+	}
+
+	return *totals, true
+}
+
+// Records returns the usage of every LLM step of the session, in order.
+func (t *Tracker) Records() []Record {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Record{}, t.records...)
+}
+
+// CheckBudget returns ErrBudgetExceeded if the session used up its budget.
+func (t *Tracker) CheckBudget() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.budget.MaxTokens > 0 && t.session.Usage.TotalTokens() >= t.budget.MaxTokens {
+		return fmt.Errorf("%w: used %d tokens of %d", ErrBudgetExceeded, t.session.Usage.TotalTokens(),
+			t.budget.MaxTokens)
+	}
+
+	if t.budget.MaxCost > 0 && t.session.Cost >= t.budget.MaxCost {
+		return fmt.Errorf("%w: spent $%.4f of $%.4f", ErrBudgetExceeded, t.session.Cost, t.budget.MaxCost)
+	}
+
+	return nil
+}
+
+// Report returns a human-readable report of the usage of the session, its
+// KueryFlow runs and its last step.
+func (t *Tracker) Report() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "Session: %s\n", formatTotals(t.session))
+	if t.budget.MaxTokens > 0 {
+		fmt.Fprintf(&report, "  token budget: %d/%d\n", t.session.Usage.TotalTokens(), t.budget.MaxTokens)
+	}
+	if t.budget.MaxCost > 0 {
+		fmt.Fprintf(&report, "  cost budget: $%.4f/$%.4f\n", t.session.Cost, t.budget.MaxCost)
+	}
+
+	for _, run := range t.runOrder {
+		fmt.Fprintf(&report, "KueryFlow run %s: %s\n", run, formatTotals(*t.runs[run]))
+	}
+
+	if len(t.records) > 0 {
+		last := t.records[len(t.records)-1]
+		fmt.Fprintf(&report, "Last step (%s): %d prompt + %d completion tokens, $%.4f\n", last.Model,
+			last.Usage.PromptTokens, last.Usage.CompletionTokens, last.Cost)
+	}
+
+	return report.String()
+}
+
+func formatTotals(totals Totals) string {
+	formatted := fmt.Sprintf("%d LLM steps, %d prompt + %d completion tokens, $%.4f", totals.Steps,
+		totals.Usage.PromptTokens, totals.Usage.CompletionTokens, totals.Cost)
+	if totals.Unpriced > 0 {
+		formatted += fmt.Sprintf(" (%d steps of unpriced models)", totals.Unpriced)
+	}
+
+	return formatted
+}
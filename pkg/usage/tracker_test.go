@@ -0,0 +1,105 @@
+package usage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// response returns an LLM response of the given model reporting the given
+// usage, the way OpenAI does.
+func response(model string, prompt, completion int) *llms.ContentResponse {
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{GenerationInfo: map[string]any{
+		"PromptTokens": prompt, "CompletionTokens": completion, ModelInfoKey: model,
+	}}}}
+}
+
+func TestTrackerAccountsForRuns(t *testing.T) {
+	tracker := NewTracker(PriceTable{"gpt-4o": {Input: 2, Output: 10}})
+
+	tracker.Record(response("openai/gpt-4o", 1000, 100)) // before any run
+	tracker.StartRun("run-1")
+	tracker.Record(response("openai/gpt-4o", 2000, 200))
+	tracker.Record(response("local-llama", 500, 50))
+	if run := tracker.EndRun(); run != "run-1" {
+		t.Errorf("EndRun() = %q, want run-1", run)
+	}
+	tracker.StartRun("run-2")
+	record := tracker.Record(response("gpt-4o", 3000, 300))
+	tracker.EndRun()
+
+	if want := (Record{Model: "gpt-4o", Run: "run-2", Usage: Usage{PromptTokens: 3000, CompletionTokens: 300},
+		Cost: 0.009, Priced: true}); record != want {
+		t.Errorf("Record() = %+v, want %+v", record, want)
+	}
+
+	session := tracker.Session()
+	if session.Steps != 4 || session.Usage != (Usage{PromptTokens: 6500, CompletionTokens: 650}) ||
+		session.Unpriced != 1 || !approximately(session.Cost, 0.018) {
+		t.Errorf("Session() = %+v, want 4 steps, 6500+650 tokens, $0.018 and 1 unpriced step", session)
+	}
+
+	run, ok := tracker.Run("run-1")
+	if !ok || run.Steps != 2 || run.Usage != (Usage{PromptTokens: 2500, CompletionTokens: 250}) ||
+		run.Unpriced != 1 || !approximately(run.Cost, 0.006) {
+		t.Errorf("Run(run-1) = %+v, %v, want 2 steps, 2500+250 tokens, $0.006 and 1 unpriced step", run, ok)
+	}
+
+	if _, ok := tracker.Run("run-3"); ok {
+		t.Error("Run(run-3) found a run that never started")
+	}
+
+	if records := tracker.Records(); len(records) != 4 || records[0].Run != "" || records[2].Priced {
+		t.Errorf("Records() = %+v, want the 4 steps in order", records)
+	}
+
+	report := tracker.Report()
+	for _, want := range []string{
+		"Session: 4 LLM steps, 6500 prompt + 650 completion tokens, $0.0180 (1 steps of unpriced models)",
+		"KueryFlow run run-1: 2 LLM steps",
+		"KueryFlow run run-2: 1 LLM steps",
+		"Last step (gpt-4o): 3000 prompt + 300 completion tokens, $0.0090",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("Report() = %q, want it to contain %q", report, want)
+		}
+	}
+}
+
+func TestTrackerCheckBudget(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		budget  Budget
+		wantErr string
+	}{
+		{name: "no budget"},
+		{name: "within the token budget", budget: Budget{MaxTokens: 1101}},
+		{name: "token budget used up", budget: Budget{MaxTokens: 1100}, wantErr: "used 1100 tokens of 1100"},
+		{name: "within the cost budget", budget: Budget{MaxCost: 0.01}},
+		{name: "cost budget used up", budget: Budget{MaxCost: 0.003}, wantErr: "spent $0.0030 of $0.0030"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tracker := NewTracker(PriceTable{"gpt-4o": {Input: 2, Output: 10}}).WithBudget(tc.budget)
+			if err := tracker.CheckBudget(); err != nil {
+				t.Fatalf("CheckBudget() of an unused session = %v", err)
+			}
+
+			tracker.Record(response("gpt-4o", 1000, 100))
+
+			err := tracker.CheckBudget()
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("CheckBudget() = %v, want no error", err)
+			}
+			if tc.wantErr != "" && (!errors.Is(err, ErrBudgetExceeded) || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("CheckBudget() = %v, want %v: %s", err, ErrBudgetExceeded, tc.wantErr)
+			}
+		})
+	}
+}
+
+// approximately returns whether the costs are equal up to rounding errors.
+func approximately(cost, want float64) bool {
+	return cost > want-1e-9 && cost < want+1e-9
+}
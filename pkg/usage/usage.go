@@ -0,0 +1,81 @@
+package usage
+
+import (
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ModelInfoKey is the GenerationInfo key of the model that generated a
+// choice, set by models that may route calls to more than one model (e.g.,
+// with a fallback).
+const ModelInfoKey = "Model"
+
+// Usage is the number of tokens consumed by LLM calls.
+type Usage struct {
+	// PromptTokens is the number of input tokens.
+	PromptTokens int `json:"promptTokens"`
+	// CompletionTokens is the number of output tokens.
+	CompletionTokens int `json:"completionTokens"`
+}
+
+// TotalTokens returns the number of input and output tokens.
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Add returns the sum of u and other.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+	}
+}
+
+// FromResponse extracts the usage of the call that generated the response
+// from its GenerationInfo, along with the model that generated it if known.
+// Providers repeat the usage of the call in every choice, therefore only the
+// first choice that reports usage is counted.
+func FromResponse(response *llms.ContentResponse) (Usage, string) {
+	if response == nil {
+		return Usage{}, ""
+	}
+
+	for _, choice := range response.Choices {
+		if choice == nil || choice.GenerationInfo == nil {
+			continue
+		}
+
+		info := choice.GenerationInfo
+		model, _ := info[ModelInfoKey].(string)
+
+		// OpenAI (and compatible) servers
+		if prompt, ok := toInt(info["PromptTokens"]); ok {
+			completion, _ := toInt(info["CompletionTokens"])
+			return Usage{PromptTokens: prompt, CompletionTokens: completion}, model
+		}
+
+		// Anthropic
+		if input, ok := toInt(info["InputTokens"]); ok {
+			output, _ := toInt(info["OutputTokens"])
+			return Usage{PromptTokens: input, CompletionTokens: output}, model
+		}
+	}
+
+	return Usage{}, ""
+}
+
+// toInt converts a token count to an int. Counts are ints when they come from
+// the provider, and may be other numbers when replayed from a cassette.
+func toInt(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,64 @@
+package usage
+
+import (
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestFromResponse(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		response  *llms.ContentResponse
+		want      Usage
+		wantModel string
+	}{
+		{name: "nil response"},
+		{name: "no generation info", response: &llms.ContentResponse{Choices: []*llms.ContentChoice{{}}}},
+		{
+			name: "openai",
+			response: &llms.ContentResponse{Choices: []*llms.ContentChoice{{GenerationInfo: map[string]any{
+				"PromptTokens": 120, "CompletionTokens": 30, "TotalTokens": 150,
+			}}}},
+			want: Usage{PromptTokens: 120, CompletionTokens: 30},
+		},
+		{
+			name: "anthropic",
+			response: &llms.ContentResponse{Choices: []*llms.ContentChoice{{GenerationInfo: map[string]any{
+				"InputTokens": int64(200), "OutputTokens": int64(50),
+			}}}},
+			want: Usage{PromptTokens: 200, CompletionTokens: 50},
+		},
+		{
+			name: "replayed from a cassette",
+			response: &llms.ContentResponse{Choices: []*llms.ContentChoice{{GenerationInfo: map[string]any{
+				"PromptTokens": float64(10), "CompletionTokens": float64(5),
+			}}}},
+			want: Usage{PromptTokens: 10, CompletionTokens: 5},
+		},
+		{
+			name: "model of a fallback",
+			response: &llms.ContentResponse{Choices: []*llms.ContentChoice{{GenerationInfo: map[string]any{
+				"InputTokens": 7, "OutputTokens": 3, ModelInfoKey: "anthropic/claude-3-5-haiku-20241022",
+			}}}},
+			want:      Usage{PromptTokens: 7, CompletionTokens: 3},
+			wantModel: "anthropic/claude-3-5-haiku-20241022",
+		},
+		{
+			name: "usage repeated in every choice",
+			response: &llms.ContentResponse{Choices: []*llms.ContentChoice{
+				nil,
+				{GenerationInfo: map[string]any{"PromptTokens": 100, "CompletionTokens": 20}},
+				{GenerationInfo: map[string]any{"PromptTokens": 100, "CompletionTokens": 20}},
+			}},
+			want: Usage{PromptTokens: 100, CompletionTokens: 20},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			usage, model := FromResponse(tc.response)
+			if usage != tc.want || model != tc.wantModel {
+				t.Errorf("FromResponse() = %+v, %q, want %+v, %q", usage, model, tc.want, tc.wantModel)
+			}
+		})
+	}
+}